@@ -0,0 +1,158 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/authorization"
+	"github.com/mariadb-operator/agent/pkg/kubeclientset"
+	"github.com/mariadb-operator/agent/pkg/kubernetesauth"
+)
+
+const (
+	authModeNone       = "none"
+	authModeKubernetes = "kubernetes"
+	authModeToken      = "token"
+	authModeHMAC       = "hmac"
+	authModeTLS        = "tls"
+
+	authorizationModeTrusted             = "trusted"
+	authorizationModeAuthenticated       = "authenticated"
+	authorizationModeSubjectAccessReview = "subjectaccessreview"
+	authorizationModePolicy              = "policy"
+
+	// kubernetesAuthCacheVar is the expvar variable that reports the TokenReview cache stats.
+	kubernetesAuthCacheVar = "kubernetesauth_cache"
+)
+
+func newAuth(clientset *kubeclientset.LazyClientset, logger logr.Logger) (authentication.Authenticator, authorization.Authorizer, error) {
+	trusted := trustedServiceAccount()
+	mode := resolveAuthMode(trusted)
+	if mode == authModeNone {
+		return nil, nil, nil
+	}
+
+	authorizer, err := newAuthorizer(clientset, trusted)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating authorizer: %v", err)
+	}
+	authenticator, err := newAuthenticator(mode, clientset, logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating authenticator: %v", err)
+	}
+	return authenticator, authorizer, nil
+}
+
+func trustedServiceAccount() *kubernetesauth.Trusted {
+	if kubernetesTrustedName == "" || kubernetesTrustedNamespace == "" {
+		return nil
+	}
+	return &kubernetesauth.Trusted{
+		ServiceAccountName:      kubernetesTrustedName,
+		ServiceAccountNamespace: kubernetesTrustedNamespace,
+	}
+}
+
+func resolveAuthMode(trusted *kubernetesauth.Trusted) string {
+	if authMode != "" {
+		return authMode
+	}
+	explicitAuthorization := authorizationMode != "" && authorizationMode != authorizationModeTrusted
+	if kubernetesAuth && (trusted != nil || explicitAuthorization) {
+		return authModeKubernetes
+	}
+	return authModeNone
+}
+
+func newAuthenticator(mode string, clientset *kubeclientset.LazyClientset, logger logr.Logger) (authentication.Authenticator, error) {
+	switch mode {
+	case authModeKubernetes:
+		return newKubernetesAuth(clientset, logger)
+	case authModeToken:
+		return authentication.NewStaticTokenAuthenticator(authTokenFile)
+	case authModeHMAC:
+		return authentication.NewHMACAuthenticatorFromFile(
+			authHMACKeysFile,
+			authentication.WithMaxClockSkew(authHMACMaxClockSkew),
+		)
+	case authModeTLS:
+		if tlsCertFile == "" || tlsKeyFile == "" || tlsClientCAFile == "" {
+			return nil, fmt.Errorf("TLS certificate, key and client CA must be provided in '%s' auth mode", authModeTLS)
+		}
+		return authentication.NewTLSAuthenticator(), nil
+	default:
+		return nil, fmt.Errorf("unsupported auth mode '%s'", mode)
+	}
+}
+
+func newKubernetesAuth(lazyClientset *kubeclientset.LazyClientset, logger logr.Logger) (*kubernetesauth.KubernetesAuth, error) {
+	clientset, err := lazyClientset.Get()
+	if err != nil {
+		return nil, fmt.Errorf("error creating Kubernetes clientset: %v", err)
+	}
+	opts := []kubernetesauth.Option{
+		kubernetesauth.WithCache(kubernetesCacheSize, kubernetesCacheTTL, kubernetesCacheNegativeTTL),
+	}
+	audiences := []string{kubernetesauth.DefaultAudience}
+	if kubernetesAudiences != "" {
+		audiences = strings.Split(kubernetesAudiences, ",")
+	}
+	opts = append(opts, kubernetesauth.WithAudiences(audiences))
+	if kubernetesJWTValidation {
+		jwksSource := kubernetesauth.APIServerJWKS(clientset)
+		if kubernetesJWKSFile != "" {
+			jwksSource = kubernetesauth.FileJWKS(kubernetesJWKSFile)
+		}
+		validator, err := kubernetesauth.NewTokenValidator(
+			kubernetesJWTIssuer,
+			audiences,
+			jwksSource,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating token validator: %v", err)
+		}
+		opts = append(opts, kubernetesauth.WithTokenValidator(validator, kubernetesJWTFallback))
+	}
+	auth := kubernetesauth.NewKubernetesAuth(clientset, nil, logger.WithName("kubernetesauth"), opts...)
+	expvar.Publish(kubernetesAuthCacheVar, auth.CacheStatsVar())
+	return auth, nil
+}
+
+func newAuthorizer(lazyClientset *kubeclientset.LazyClientset, trusted *kubernetesauth.Trusted) (authorization.Authorizer, error) {
+	mode := authorizationMode
+	if mode == "" {
+		mode = authorizationModeAuthenticated
+		if trusted != nil {
+			mode = authorizationModeTrusted
+		}
+	}
+
+	switch mode {
+	case authorizationModeTrusted:
+		if trusted == nil {
+			return nil, fmt.Errorf("trusted ServiceAccount name and namespace must be provided in '%s' authorization mode",
+				authorizationModeTrusted)
+		}
+		return trusted, nil
+	case authorizationModeAuthenticated:
+		return authorization.NewAuthenticatedAuthorizer(), nil
+	case authorizationModeSubjectAccessReview:
+		clientset, err := lazyClientset.Get()
+		if err != nil {
+			return nil, fmt.Errorf("error creating Kubernetes clientset: %v", err)
+		}
+		return authorization.NewSubjectAccessReviewAuthorizer(
+			clientset,
+			authorization.WithGroup(authorizationGroup),
+			authorization.WithNamespace(authorizationNamespace),
+			authorization.WithName(authorizationName),
+		), nil
+	case authorizationModePolicy:
+		return authorization.NewPolicyAuthorizerFromFile(authorizationPolicyFile)
+	default:
+		return nil, fmt.Errorf("unsupported authorization mode '%s'", mode)
+	}
+}
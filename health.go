@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+	"github.com/mariadb-operator/agent/pkg/health"
+	"github.com/mariadb-operator/agent/pkg/kubeclientset"
+	"k8s.io/client-go/kubernetes"
+)
+
+func newHealthChecker(lazyClientset *kubeclientset.LazyClientset, fsys filesystem.FS) *health.Checker {
+	opts := []health.Option{
+		health.WithTimeout(healthCheckTimeout),
+		health.WithCheck("config-dir", health.DirCheck(fsys, configDir)),
+		health.WithCheck("state-dir", health.DirCheck(fsys, stateDir)),
+	}
+	if resolveAuthMode(trustedServiceAccount()) == authModeKubernetes ||
+		authorizationMode == authorizationModeSubjectAccessReview {
+		opts = append(opts, health.WithCheck("kubernetes", health.KubernetesCheck(func() (kubernetes.Interface, error) {
+			return lazyClientset.Get()
+		})))
+	}
+	if tlsCertFile != "" && tlsKeyFile != "" {
+		opts = append(opts, health.WithCheck("tls", health.TLSCertCheck(tlsCertFile, tlsKeyFile)))
+	}
+	if mariadbSocket != "" {
+		opts = append(opts, health.WithCheck("mariadb", health.MariaDBSocketCheck(mariadbSocket)))
+	}
+	return health.NewChecker(opts...)
+}
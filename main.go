@@ -2,108 +2,344 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/authorization"
 	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/galera"
 	"github.com/mariadb-operator/agent/pkg/handler"
 	"github.com/mariadb-operator/agent/pkg/kubeclientset"
 	"github.com/mariadb-operator/agent/pkg/kubernetesauth"
 	"github.com/mariadb-operator/agent/pkg/logger"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
 	"github.com/mariadb-operator/agent/pkg/router"
 	"github.com/mariadb-operator/agent/pkg/server"
+	"go.uber.org/zap/zapcore"
 )
 
 var (
-	addr      string
-	configDir string
-	stateDir  string
+	addr       string
+	probesAddr string
+	adminAddr  string
+	configDir  string
+	stateDir   string
+	fileMode   string
+	fileUID    int
+	fileGID    int
+
+	galeraStateHistoryDir  string
+	galeraStateHistorySize int
 
 	compressLevel              int
 	rateLimitRequests          int
 	rateLimitDuration          time.Duration
+	callerRateLimitRequests    int
+	callerRateLimitDuration    time.Duration
+	concurrencyLimits          string
+	concurrencyRetryAfter      time.Duration
+	authMode                   string
+	authTokenFile              string
+	authHMACKeysFile           string
+	authHMACMaxClockSkew       time.Duration
+	tlsCertFile                string
+	tlsKeyFile                 string
+	tlsClientCAFile            string
+	unixSocket                 string
+	unixSocketMode             string
 	kubernetesAuth             bool
 	kubernetesTrustedName      string
 	kubernetesTrustedNamespace string
+	kubernetesCacheSize        int
+	kubernetesCacheTTL         time.Duration
+	kubernetesCacheNegativeTTL time.Duration
+	kubernetesJWTValidation    bool
+	kubernetesJWTIssuer        string
+	kubernetesAudiences        string
+	kubernetesJWKSFile         string
+	kubernetesJWTFallback      bool
+	authorizationMode          string
+	authorizationPolicyFile    string
+	authorizationGroup         string
+	authorizationNamespace     string
+	authorizationName          string
 	recoveryTimeout            time.Duration
+	recoveryPollInterval       time.Duration
+	wsrepRecover               bool
+	wsrepRecoverBinary         string
+	wsrepRecoverArgs           string
+	healthCheckTimeout         time.Duration
+	mariadbSocket              string
+	mariadbPIDFile             string
+	mariadbProcDir             string
 	gracefulShutdownTimeout    time.Duration
 
-	logLevel       string
-	logTimeEncoder string
-	logDev         bool
+	logLevel          string
+	logLevelOverrides string
+	logLevelSignals   bool
+	logTimeEncoder    string
+	logDev            bool
 )
 
 func main() {
 	flag.StringVar(&addr, "addr", ":5555", "The address that the HTTP server binds to")
+	flag.StringVar(&probesAddr, "probes-addr", "", "The address that the unauthenticated probes and metrics HTTP server "+
+		"binds to. If not provided, only the health endpoint is served by the API server")
+	flag.StringVar(&adminAddr, "admin-addr", "", "The address that the authenticated admin and debug HTTP server "+
+		"binds to. If not provided, it is disabled. It requires an authentication mode other than none")
 	flag.StringVar(&configDir, "config-dir", "/etc/mysql/mariadb.conf.d", "The directory that contains MariaDB configuration files")
 	flag.StringVar(&stateDir, "state-dir", "/var/lib/mysql", "The directory that contains MariaDB state files")
 
+	flag.StringVar(&fileMode, "file-mode", "", "File mode in octal of the configuration and state files written by the agent. "+
+		"If not provided, the mode of the replaced file is kept, and new files are created with 0644")
+	flag.IntVar(&fileUID, "file-uid", -1, "Owner user ID of the files written by the agent. "+
+		"If negative, the user of the replaced file is kept, and new files are owned by the user of the agent process")
+	flag.IntVar(&fileGID, "file-gid", -1, "Owner group ID of the files written by the agent. "+
+		"If negative, the group of the replaced file is kept, and new files are owned by the group of the agent process")
+
+	flag.StringVar(&galeraStateHistoryDir, "galera-state-history-dir", "", "The directory to keep the previous "+
+		"versions of the Galera state in. It must be outside of the state directory, as MariaDB considers its subdirectories "+
+		"to be databases and a SST wipes them. If not provided, the history is disabled")
+	flag.IntVar(&galeraStateHistorySize, "galera-state-history-size", 10, "Number of previous versions of the "+
+		"Galera state to keep. Set to 0 to disable")
+
 	flag.IntVar(&compressLevel, "compress-level", 5, "HTTP compression level")
 	flag.IntVar(&rateLimitRequests, "rate-limit-requests", 0, "Number of requests to be used as rate limit")
 	flag.DurationVar(&rateLimitDuration, "rate-limit-duration", 0, "Duration to be used as rate limit")
+	flag.IntVar(&callerRateLimitRequests, "caller-rate-limit-requests", 0, "Number of requests to be used as rate limit "+
+		"for each authenticated caller, or client IP when authentication is disabled")
+	flag.DurationVar(&callerRateLimitDuration, "caller-rate-limit-duration", 0, "Duration to be used as rate limit "+
+		"for each authenticated caller")
+	flag.StringVar(&concurrencyLimits, "concurrency-limits", "recovery=1", "Comma separated list of maximum concurrent "+
+		"requests per route, for example: recovery=1,bootstrap=1. Only the operations that recover or mutate the galera "+
+		"state are limited: POST recovery, PUT bootstrap and POST galerastate rollback")
+	flag.DurationVar(&concurrencyRetryAfter, "concurrency-retry-after", 5*time.Second, "Retry-After duration returned "+
+		"when a concurrency limit is exceeded")
+	flag.StringVar(&authMode, "auth-mode", "", "Authentication mode to use, one of: "+
+		"none, kubernetes, token, hmac or tls. If not provided, it is derived from --kubernetes-auth")
+	flag.StringVar(&authTokenFile, "auth-token-file", "", "CSV file containing static bearer tokens with the format: "+
+		"token,username,uid,\"group1,group2\". Used when authentication mode is token")
+	flag.StringVar(&authHMACKeysFile, "auth-hmac-keys-file", "", "File containing the HMAC keys used to verify signed "+
+		"requests. Used when authentication mode is hmac")
+	flag.DurationVar(&authHMACMaxClockSkew, "auth-hmac-max-clock-skew", 5*time.Minute, "Maximum allowed clock skew "+
+		"between the HMAC signed request timestamp and the server time")
+	flag.StringVar(&tlsCertFile, "tls-cert-file", "", "File containing the TLS certificate of the HTTP server")
+	flag.StringVar(&tlsKeyFile, "tls-key-file", "", "File containing the TLS private key of the HTTP server")
+	flag.StringVar(&tlsClientCAFile, "tls-client-ca-file", "", "File containing the CA used to verify client "+
+		"certificates. Required when authentication mode is tls")
+	flag.StringVar(&unixSocket, "unix-socket", "", "Path of the unix domain socket to serve the API on. Requests received "+
+		"through it are trusted based on the socket file permissions instead of being authenticated")
+	flag.StringVar(&unixSocketMode, "unix-socket-mode", "0600", "File mode of the unix domain socket in octal")
 	flag.BoolVar(&kubernetesAuth, "kubernetes-auth", false, "Enable Kubernetes authentication via the TokenReview API")
 	flag.StringVar(&kubernetesTrustedName, "kubernetes-trusted-name", "", "Trusted Kubernetes ServiceAccount name to be verified")
 	flag.StringVar(&kubernetesTrustedNamespace, "kubernetes-trusted-namespace", "", "Trusted Kubernetes ServiceAccount "+
 		"namespace to be verified")
+	flag.StringVar(&kubernetesAudiences, "kubernetes-audiences", kubernetesauth.DefaultAudience, "Comma separated list of "+
+		"accepted audiences of the ServiceAccount tokens. Tokens for the API server audience, like the default Pod token, are "+
+		"rejected with 401 unless it is listed")
+	flag.IntVar(&kubernetesCacheSize, "kubernetes-cache-size", 1024, "Maximum number of TokenReview results to be cached")
+	flag.DurationVar(&kubernetesCacheTTL, "kubernetes-cache-ttl", 1*time.Minute, "Duration to cache authenticated "+
+		"TokenReview results, bounded by the token expiry. Set to 0 to disable")
+	flag.DurationVar(&kubernetesCacheNegativeTTL, "kubernetes-cache-negative-ttl", 5*time.Second, "Duration to cache "+
+		"unauthenticated TokenReview results. Set to 0 to disable")
+	flag.BoolVar(&kubernetesJWTValidation, "kubernetes-jwt-validation", false, "Validate ServiceAccount tokens locally "+
+		"using the cluster issuer JWKS before using the TokenReview API")
+	flag.StringVar(&kubernetesJWTIssuer, "kubernetes-jwt-issuer", "https://kubernetes.default.svc.cluster.local",
+		"Expected issuer of the ServiceAccount tokens")
+	flag.StringVar(&kubernetesJWKSFile, "kubernetes-jwks-file", "", "File containing the cluster issuer JWKS. "+
+		"If not provided, it is fetched from the Kubernetes API server")
+	flag.BoolVar(&kubernetesJWTFallback, "kubernetes-jwt-fallback", true, "Fall back to the TokenReview API when "+
+		"the local token validation fails")
+	flag.StringVar(&authorizationMode, "authorization-mode", "", "Authorization mode to use, one of: "+
+		"trusted, authenticated, subjectaccessreview or policy. If not provided, trusted is used when a trusted "+
+		"ServiceAccount is configured, otherwise authenticated")
+	flag.StringVar(&authorizationPolicyFile, "authorization-policy-file", "", "File containing the authorization policy. "+
+		"Used when authorization mode is policy")
+	flag.StringVar(&authorizationGroup, "authorization-group", authorization.DefaultGroup, "API group used in "+
+		"SubjectAccessReviews. Used when authorization mode is subjectaccessreview")
+	flag.StringVar(&authorizationNamespace, "authorization-namespace", "", "Namespace used in SubjectAccessReviews. "+
+		"Used when authorization mode is subjectaccessreview")
+	flag.StringVar(&authorizationName, "authorization-name", "", "Resource name used in SubjectAccessReviews. "+
+		"Used when authorization mode is subjectaccessreview")
 	flag.DurationVar(&recoveryTimeout, "recovery-timeout", 1*time.Minute, "Timeout to obtain sequence number "+
 		"during the Galera cluster recovery process")
+	flag.DurationVar(&recoveryPollInterval, "recovery-poll-interval", 1*time.Second, "Interval to read the recovery "+
+		"log when no change is notified by the filesystem")
+	flag.BoolVar(&wsrepRecover, "wsrep-recover", false, "Enable running mariadbd with --wsrep-recover as a subprocess "+
+		"of the agent to recover the Galera position, without restarting the container. It requires --mariadb-socket, "+
+		"or --mariadb-proc-dir sharing the process namespace with mariadbd, as the recovery is refused while mariadbd is running")
+	flag.StringVar(&wsrepRecoverBinary, "wsrep-recover-binary", "mariadbd", "MariaDB server binary run to recover "+
+		"the Galera position")
+	flag.StringVar(&wsrepRecoverArgs, "wsrep-recover-args", "", "Comma separated list of extra arguments passed to "+
+		"the MariaDB server binary when recovering the Galera position, for example: --defaults-file=/etc/mysql/my.cnf")
+	flag.DurationVar(&healthCheckTimeout, "health-check-timeout", 5*time.Second, "Timeout of each of the checks "+
+		"performed by the detailed health endpoint")
+	flag.StringVar(&mariadbSocket, "mariadb-socket", "", "Path of the MariaDB unix socket to be checked by the detailed "+
+		"health endpoint, for example: /run/mysqld/mysqld.sock. If not provided, it is not checked. "+
+		"It is also used to detect a running mariadbd, which blocks the bootstrap and recovery operations unless forced")
+	flag.StringVar(&mariadbPIDFile, "mariadb-pid-file", "", "Path of the MariaDB pid file used to detect a running "+
+		"mariadbd, for example: /var/lib/mysql/mariadb.pid. If not provided, it is not checked")
+	flag.StringVar(&mariadbProcDir, "mariadb-proc-dir", "", "Process table where a running mariadbd is looked for, "+
+		"for example: /proc. It requires sharing the process namespace with mariadbd, otherwise only the pid file and "+
+		"the socket are trusted. If not provided, the process table is not checked")
 	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 5*time.Second, "Timeout to gracefully terminate "+
 		"in-flight requests")
 
 	flag.StringVar(&logLevel, "log-level", "info", "Log level to use, one of: "+
 		"debug, info, warn, error, dpanic, panic, fatal.")
+	flag.StringVar(&logLevelOverrides, "log-level-overrides", "", "Comma separated list of log levels per logger name, "+
+		"for example: handler=debug,server=info,recovery=debug")
+	flag.BoolVar(&logLevelSignals, "log-level-signals", false, "Increase the log verbosity on SIGUSR1 and reset the "+
+		"log levels to their initial values on SIGUSR2")
 	flag.StringVar(&logTimeEncoder, "log-time-encoder", "epoch", "Log time encoder to use, one of: "+
 		"epoch, millis, nano, iso8601, rfc3339 or rfc3339nano")
 	flag.BoolVar(&logDev, "log-dev", false, "Enable development logs.")
 
 	flag.Parse()
 
+	overrides, err := parseLogLevelOverrides(logLevelOverrides)
+	if err != nil {
+		log.Fatalf("error parsing log level overrides: %v", err)
+	}
+	levels, err := logger.NewLevels(logLevel, overrides)
+	if err != nil {
+		log.Fatalf("error parsing log level: %v", err)
+	}
+
 	logger, err := logger.NewLogger(
-		logger.WithLogLevel(logLevel),
+		logger.WithLevels(levels),
 		logger.WithTimeEncoder(logTimeEncoder),
 		logger.WithDevelopment(logDev),
 	)
 	if err != nil {
 		log.Fatalf("error creating logger: %v", err)
 	}
+	if logLevelSignals {
+		levels.HandleSignals(context.Background(), logger)
+	}
 
-	clientset, err := kubeclientset.NewKubeclientSet()
-	if err != nil {
-		logger.Error(err, "error creating Kubernetes clientset")
+	clientset := kubeclientset.NewLazyClientset()
+
+	fileManagerOpts := []filemanager.Option{
+		filemanager.WithFileOwner(fileUID, fileGID),
+	}
+	if fileMode != "" {
+		mode, err := strconv.ParseUint(fileMode, 8, 32)
+		if err != nil {
+			logger.Error(err, "error parsing file mode")
+			os.Exit(1)
+		}
+		fileManagerOpts = append(fileManagerOpts, filemanager.WithFileMode(fs.FileMode(mode)))
+	}
+	if galeraStateHistoryDir != "" && isSubdir(galeraStateHistoryDir, stateDir) {
+		logger.Error(errors.New("invalid galera state history directory"), "--galera-state-history-dir must be "+
+			"outside of the state directory", "dir", galeraStateHistoryDir, "stateDir", stateDir)
 		os.Exit(1)
 	}
-
-	fileManager, err := filemanager.NewFileManager(configDir, stateDir)
+	fileManagerOpts = append(fileManagerOpts,
+		filemanager.WithStateFileHistory(galeraStateHistoryDir, galeraStateHistorySize))
+	fileManager, err := filemanager.NewFileManager(configDir, stateDir, fileManagerOpts...)
 	if err != nil {
 		logger.Error(err, "error creating file manager")
 		os.Exit(1)
 	}
+	recovered, err := fileManager.RecoverTransaction()
+	if err != nil {
+		logger.Error(err, "error recovering interrupted file transaction")
+		os.Exit(1)
+	}
+	if recovered {
+		logger.Info("rolled back file transaction interrupted by a previous crash")
+	}
 
+	logLevelLogger := logger.WithName("loglevel")
+	logLevelHandler := handler.NewLogLevel(levels, responsewriter.NewResponseWriter(&logLevelLogger), &logLevelLogger)
+
+	healthLogger := logger.WithName("health")
+	healthHandler := handler.NewHealth(
+		newHealthChecker(clientset, fileManager.FS()),
+		responsewriter.NewResponseWriter(&healthLogger),
+		&healthLogger,
+	)
+
+	if recoveryPollInterval <= 0 {
+		logger.Error(errors.New("invalid recovery poll interval"), "--recovery-poll-interval must be positive",
+			"interval", recoveryPollInterval)
+		os.Exit(1)
+	}
+	serverDetector := newServerDetector()
+	if wsrepRecover {
+		if err := verifyServerDetection(serverDetector); err != nil {
+			logger.Error(err, "--wsrep-recover requires --mariadb-socket, or --mariadb-proc-dir sharing the process "+
+				"namespace with mariadbd, to check that mariadbd is stopped")
+			os.Exit(1)
+		}
+	}
 	handlerLogger := logger.WithName("handler")
 	handler := handler.NewHandler(
 		fileManager,
+		serverDetector,
 		&handlerLogger,
 		handler.WithRecoveryTimeout(recoveryTimeout),
+		handler.WithRecoveryPollInterval(recoveryPollInterval),
+		handler.WithWsrepRecover(newWsrepRecover()),
 	)
 
+	routeConcurrencyLimits, err := parseConcurrencyLimits(concurrencyLimits)
+	if err != nil {
+		logger.Error(err, "error parsing concurrency limits")
+		os.Exit(1)
+	}
 	routerOpts := []router.Option{
 		router.WithCompressLevel(compressLevel),
 		router.WithRateLimit(rateLimitRequests, rateLimitDuration),
+		router.WithCallerRateLimit(callerRateLimitRequests, callerRateLimitDuration),
+		router.WithConcurrencyLimits(routeConcurrencyLimits, concurrencyRetryAfter),
+		router.WithHealth(healthHandler),
 	}
-	if kubernetesAuth && kubernetesTrustedName != "" && kubernetesTrustedNamespace != "" {
-		routerOpts = append(routerOpts, router.WithKubernetesAuth(
-			kubernetesAuth,
-			&kubernetesauth.Trusted{
-				ServiceAccountName:      kubernetesTrustedName,
-				ServiceAccountNamespace: kubernetesTrustedNamespace,
-			},
-		))
+	socketMode, err := strconv.ParseUint(unixSocketMode, 8, 32)
+	if err != nil {
+		logger.Error(err, "error parsing unix socket mode")
+		os.Exit(1)
 	}
+	unixSocketRouter := router.NewRouter(
+		handler,
+		logger,
+		append(
+			routerOpts,
+			router.WithAuth(authentication.NewUnixSocketAuthenticator(), authorization.NewAuthenticatedAuthorizer()),
+		)...,
+	)
+
+	authenticator, authorizer, err := newAuth(clientset, logger)
+	if err != nil {
+		logger.Error(err, "error configuring auth")
+		os.Exit(1)
+	}
+	if adminAddr != "" && authenticator == nil {
+		logger.Error(errors.New("no authenticator configured"), "--admin-addr requires authentication, "+
+			"as it serves the pprof and log level endpoints")
+		os.Exit(1)
+	}
+	var adminRouterOpts []router.Option
+	if authenticator != nil {
+		routerOpts = append(routerOpts, router.WithAuth(authenticator, authorizer))
+		adminRouterOpts = append(adminRouterOpts, router.WithAuth(authenticator, authorizer))
+	}
+	probesRouter := router.NewProbesRouter()
+	adminRouter := router.NewAdminRouter(logLevelHandler, logger, adminRouterOpts...)
 	router := router.NewRouter(
 		handler,
-		clientset,
 		logger,
 		routerOpts...,
 	)
@@ -114,9 +350,114 @@ func main() {
 		router,
 		&serverLogger,
 		server.WithGracefulShutdownTimeout(gracefulShutdownTimeout),
+		server.WithTLS(tlsCertFile, tlsKeyFile),
+		server.WithTLSClientCA(tlsClientCAFile),
+		server.WithUnixSocket(unixSocket, fs.FileMode(socketMode), unixSocketRouter),
+		server.WithProbesListener(probesAddr, probesRouter),
+		server.WithAdminListener(adminAddr, adminRouter),
 	)
 	if err := server.Start(context.Background()); err != nil {
 		logger.Error(err, "server error")
 		os.Exit(1)
 	}
 }
+
+func newServerDetector() *mariadb.ServerDetector {
+	var opts []mariadb.ServerDetectorOption
+	if mariadbPIDFile != "" {
+		opts = append(opts, mariadb.WithPIDFile(mariadbPIDFile))
+	}
+	if mariadbProcDir != "" {
+		opts = append(opts, mariadb.WithProcessTable(mariadbProcDir))
+	}
+	if mariadbSocket != "" {
+		opts = append(opts, mariadb.WithSocket(mariadbSocket))
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+	return mariadb.NewServerDetector(opts...)
+}
+
+// verifyServerDetection checks that a running mariadbd is detected before enabling the agent recovery, which would
+// otherwise run a second mariadbd against the live datadir. The pid file alone is not enough: it cannot tell a
+// mariadbd running in another process namespace from a stale pid file.
+func verifyServerDetection(detector *mariadb.ServerDetector) error {
+	if detector == nil {
+		return errors.New("mariadbd detection disabled")
+	}
+	if mariadbSocket != "" {
+		return nil
+	}
+	shared, err := detector.SharesProcessTable()
+	if err != nil {
+		return fmt.Errorf("error checking process table: %v", err)
+	}
+	if !shared {
+		return errors.New("process namespace not shared with mariadbd")
+	}
+	return nil
+}
+
+func newWsrepRecover() *mariadb.WsrepRecover {
+	if !wsrepRecover {
+		return nil
+	}
+	var args []string
+	if wsrepRecoverArgs != "" {
+		args = strings.Split(wsrepRecoverArgs, ",")
+	}
+	return mariadb.NewWsrepRecover(
+		stateDir,
+		filepath.Join(stateDir, galera.RecoveryLogFileName),
+		mariadb.WithWsrepRecoverBinary(wsrepRecoverBinary),
+		mariadb.WithWsrepRecoverArgs(args),
+	)
+}
+
+func parseConcurrencyLimits(limits string) (map[string]int, error) {
+	concurrencyLimits := make(map[string]int)
+	if limits == "" {
+		return concurrencyLimits, nil
+	}
+	for _, limit := range strings.Split(limits, ",") {
+		parts := strings.Split(limit, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid concurrency limit '%s'", limit)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid concurrency limit '%s': %v", limit, err)
+		}
+		concurrencyLimits[strings.TrimSpace(parts[0])] = n
+	}
+	return concurrencyLimits, nil
+}
+
+func parseLogLevelOverrides(overrides string) (map[string]zapcore.Level, error) {
+	levels := make(map[string]zapcore.Level)
+	if overrides == "" {
+		return levels, nil
+	}
+	for _, override := range strings.Split(overrides, ",") {
+		parts := strings.Split(override, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid log level override '%s'", override)
+		}
+		level, err := logger.ParseLevel(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level override '%s': %v", override, err)
+		}
+		levels[strings.TrimSpace(parts[0])] = level
+	}
+	return levels, nil
+}
+
+// isSubdir returns whether dir is parent or one of its subdirectories.
+func isSubdir(dir, parent string) bool {
+	rel, err := filepath.Rel(filepath.Clean(parent), filepath.Clean(dir))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,317 @@
+// Package agenttest provides an in-process agent to test consumers of the agent client without real directories
+// nor a running MariaDB. It serves the real API over an in-memory filesystem.
+package agenttest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	middleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/client"
+	"github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/galera"
+	"github.com/mariadb-operator/agent/pkg/handler"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+	"github.com/mariadb-operator/agent/pkg/router"
+)
+
+type Route struct {
+	Method string
+	Path   string
+}
+
+var (
+	RouteEnableBootstrap  = Route{Method: http.MethodPut, Path: "/api/bootstrap"}
+	RouteDisableBootstrap = Route{Method: http.MethodDelete, Path: "/api/bootstrap"}
+	RouteGetGaleraState   = Route{Method: http.MethodGet, Path: "/api/galerastate"}
+	RouteEnableRecovery   = Route{Method: http.MethodPut, Path: "/api/recovery"}
+	RouteStartRecovery    = Route{Method: http.MethodPost, Path: "/api/recovery"}
+	RouteRunRecovery      = Route{Method: http.MethodPost, Path: "/api/recovery/run"}
+	RouteRecoveryResult   = Route{Method: http.MethodGet, Path: "/api/recovery/result"}
+	RouteDisableRecovery  = Route{Method: http.MethodDelete, Path: "/api/recovery"}
+)
+
+// Failure is returned instead of calling the agent handler. Times limits the number of requests that fail,
+// zero means that every request fails until the failure is cleared.
+type Failure struct {
+	StatusCode int
+	Message    string
+	Times      int
+}
+
+type Call struct {
+	Route
+	Header     http.Header
+	Body       []byte
+	StatusCode int
+	Time       time.Time
+}
+
+type Option func(*Server)
+
+func WithGaleraState(galeraState *galera.GaleraState) Option {
+	return func(s *Server) {
+		s.initialGaleraState = galeraState
+	}
+}
+
+func WithLatency(latency time.Duration) Option {
+	return func(s *Server) {
+		s.latency = latency
+	}
+}
+
+func WithRecoveryOptions(opts ...handler.RecoveryOption) Option {
+	return func(s *Server) {
+		s.recoveryOpts = append(s.recoveryOpts, opts...)
+	}
+}
+
+// Server serves the agent API routes and handlers over an in-memory filesystem. The latency, failures and calls
+// of every route can be programmed and inspected.
+type Server struct {
+	*httptest.Server
+
+	fs                 *FS
+	initialGaleraState *galera.GaleraState
+	recoveryOpts       []handler.RecoveryOption
+	responseWriter     *responsewriter.ResponseWriter
+
+	mux            sync.Mutex
+	latency        time.Duration
+	routeLatencies map[Route]time.Duration
+	failures       map[Route]*Failure
+	calls          []Call
+}
+
+// NewServer starts a fake agent. The caller should call Close when finished, to shut it down.
+func NewServer(opts ...Option) (*Server, error) {
+	fs, err := newFS()
+	if err != nil {
+		return nil, fmt.Errorf("error creating filesystem: %v", err)
+	}
+	logger := logr.Discard()
+	server := &Server{
+		fs:             fs,
+		responseWriter: responsewriter.NewResponseWriter(&logger),
+		routeLatencies: make(map[Route]time.Duration),
+		failures:       make(map[Route]*Failure),
+	}
+	for _, setOpt := range opts {
+		setOpt(server)
+	}
+	if server.initialGaleraState != nil {
+		if err := server.SetGaleraState(server.initialGaleraState); err != nil {
+			return nil, fmt.Errorf("error setting galera state: %v", err)
+		}
+	}
+
+	fileManager, err := filemanager.NewFileManager(configDir, stateDir, filemanager.WithFS(fs.memory))
+	if err != nil {
+		return nil, fmt.Errorf("error creating file manager: %v", err)
+	}
+	serverDetector := mariadb.NewServerDetector(mariadb.WithPIDFile(pidFile), mariadb.WithFS(fs.memory))
+	agentHandler := handler.NewHandler(fileManager, serverDetector, &logger, server.recoveryOpts...)
+
+	server.Server = httptest.NewServer(server.record(server.delay(server.fail(router.NewRouter(agentHandler, logger)))))
+	return server, nil
+}
+
+func (s *Server) Client(opts ...client.Option) (*client.Client, error) {
+	return client.NewClient(s.URL, opts...)
+}
+
+func (s *Server) FS() *FS {
+	return s.fs
+}
+
+// SetGaleraState writes the grastate.dat file. A nil state deletes it.
+func (s *Server) SetGaleraState(galeraState *galera.GaleraState) error {
+	if galeraState == nil {
+		if err := s.fs.DeleteStateFile(galera.GaleraStateFileName); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	bytes, err := galeraState.Marshal()
+	if err != nil {
+		return err
+	}
+	return s.fs.WriteStateFile(galera.GaleraStateFileName, bytes)
+}
+
+func (s *Server) GaleraState() (*galera.GaleraState, error) {
+	bytes, err := s.fs.ReadStateFile(galera.GaleraStateFileName)
+	if err != nil {
+		return nil, err
+	}
+	var galeraState galera.GaleraState
+	if err := galeraState.Unmarshal(bytes); err != nil {
+		return nil, err
+	}
+	return &galeraState, nil
+}
+
+// SetRecoveryLog writes the log that mariadbd leaves behind when started in recovery mode.
+// Enabling the recovery deletes it, so it should be set afterwards.
+func (s *Server) SetRecoveryLog(log []byte) error {
+	return s.fs.WriteStateFile(galera.RecoveryLogFileName, log)
+}
+
+// SetServerRunning writes or deletes the mariadbd pid file, making the agent detect mariadbd as running or stopped.
+func (s *Server) SetServerRunning(running bool) error {
+	if !running {
+		if err := s.fs.memory.Remove(pidFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return s.fs.memory.WriteFile(pidFile, []byte("1\n"), 0644)
+}
+
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.latency = latency
+}
+
+func (s *Server) SetRouteLatency(route Route, latency time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.routeLatencies[route] = latency
+}
+
+func (s *Server) InjectFailure(route Route, failure Failure) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if failure.StatusCode == 0 {
+		failure.StatusCode = http.StatusInternalServerError
+	}
+	if failure.Message == "" {
+		failure.Message = http.StatusText(failure.StatusCode)
+	}
+	s.failures[route] = &failure
+}
+
+func (s *Server) ClearFailures() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.failures = make(map[Route]*Failure)
+}
+
+func (s *Server) Calls() []Call {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+func (s *Server) CallsTo(route Route) []Call {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if call.Route == route {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (s *Server) ResetCalls() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.calls = nil
+}
+
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		call := Call{
+			Route: Route{
+				Method: r.Method,
+				Path:   r.URL.Path,
+			},
+			Header: r.Header.Clone(),
+			Body:   body,
+			Time:   time.Now(),
+		}
+		next.ServeHTTP(ww, r)
+
+		call.StatusCode = ww.Status()
+		if call.StatusCode == 0 {
+			call.StatusCode = http.StatusOK
+		}
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		s.calls = append(s.calls, call)
+	})
+}
+
+func (s *Server) delay(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mux.Lock()
+		latency, ok := s.routeLatencies[routeOf(r)]
+		if !ok {
+			latency = s.latency
+		}
+		s.mux.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				s.responseWriter.Write(w, errors.NewAPIError("request canceled"), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) fail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+		s.mux.Lock()
+		failure, ok := s.failures[route]
+		var statusCode int
+		var message string
+		if ok {
+			statusCode = failure.StatusCode
+			message = failure.Message
+			if failure.Times > 0 {
+				failure.Times--
+				if failure.Times == 0 {
+					delete(s.failures, route)
+				}
+			}
+		}
+		s.mux.Unlock()
+
+		if ok {
+			s.responseWriter.Write(w, errors.NewAPIError(message), statusCode)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func routeOf(r *http.Request) Route {
+	return Route{
+		Method: r.Method,
+		Path:   r.URL.Path,
+	}
+}
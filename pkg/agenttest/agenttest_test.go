@@ -0,0 +1,136 @@
+package agenttest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/client"
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+func TestServer(t *testing.T) {
+	uuid := "15d9a0ef-02b1-11ee-9499-decd8e34642e"
+	server, err := NewServer(WithGaleraState(&galera.GaleraState{
+		Version: "2.1",
+		UUID:    uuid,
+		Seqno:   -1,
+	}))
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	defer server.Close()
+
+	c, err := server.Client()
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := c.Recovery.Enable(ctx); err != nil {
+		t.Fatalf("error enabling recovery: %v", err)
+	}
+	if !server.FS().ConfigFileExists(galera.RecoveryFileName) {
+		t.Fatal("expected recovery config to exist")
+	}
+
+	if err := server.SetRecoveryLog([]byte("2023-06-04  8:24:23 0 [Note] WSREP: Recovered position: " + uuid + ":3\n")); err != nil {
+		t.Fatalf("error setting recovery log: %v", err)
+	}
+	bootstrap, err := c.Recovery.Start(ctx)
+	if err != nil {
+		t.Fatalf("error starting recovery: %v", err)
+	}
+	if bootstrap.Seqno != 3 {
+		t.Fatalf("unexpected seqno: expected 3, got %d", bootstrap.Seqno)
+	}
+
+	if err := c.Bootstrap.Enable(ctx, bootstrap); err != nil {
+		t.Fatalf("error enabling bootstrap: %v", err)
+	}
+	galeraState, err := c.GaleraState.Get(ctx)
+	if err != nil {
+		t.Fatalf("error getting galera state: %v", err)
+	}
+	if !galeraState.SafeToBootstrap || galeraState.Seqno != 3 {
+		t.Fatalf("unexpected galera state: %+v", galeraState)
+	}
+	if server.FS().ConfigFileExists(galera.RecoveryFileName) {
+		t.Fatal("expected recovery config to be deleted")
+	}
+
+	if n := len(server.CallsTo(RouteStartRecovery)); n != 1 {
+		t.Fatalf("unexpected number of recovery calls: expected 1, got %d", n)
+	}
+	if n := len(server.Calls()); n != 4 {
+		t.Fatalf("unexpected number of calls: expected 4, got %d", n)
+	}
+}
+
+func TestServerFailures(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	defer server.Close()
+
+	c, err := server.Client()
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := c.GaleraState.Get(ctx); !client.IsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	server.InjectFailure(RouteEnableRecovery, Failure{StatusCode: http.StatusServiceUnavailable, Times: 1})
+	if err := c.Recovery.Enable(ctx); err == nil {
+		t.Fatal("expected injected failure, got nil")
+	}
+	if err := c.Recovery.Enable(ctx); err != nil {
+		t.Fatalf("error unexpected after failure was consumed, got %v", err)
+	}
+	calls := server.CallsTo(RouteEnableRecovery)
+	if len(calls) != 2 || calls[0].StatusCode != http.StatusServiceUnavailable || calls[1].StatusCode != http.StatusOK {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+
+	server.SetRouteLatency(RouteStartRecovery, time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Recovery.Start(timeoutCtx); err == nil {
+		t.Fatal("expected timeout error, got nil")
+	}
+}
+
+func TestServerRunning(t *testing.T) {
+	server, err := NewServer()
+	if err != nil {
+		t.Fatalf("error creating server: %v", err)
+	}
+	defer server.Close()
+	if err := server.SetServerRunning(true); err != nil {
+		t.Fatalf("error setting server running: %v", err)
+	}
+
+	c, err := server.Client()
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := c.Recovery.Enable(ctx); err == nil {
+		t.Fatal("expected conflict error, got nil")
+	}
+	if calls := server.CallsTo(RouteEnableRecovery); len(calls) != 1 || calls[0].StatusCode != http.StatusConflict {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+	if err := c.Recovery.Enable(ctx, client.WithForce()); err != nil {
+		t.Fatalf("error enabling recovery with force: %v", err)
+	}
+	if !server.FS().ConfigFileExists(galera.RecoveryFileName) {
+		t.Fatal("expected recovery config to exist")
+	}
+}
@@ -0,0 +1,100 @@
+package agenttest
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+)
+
+const (
+	configDir = "/etc/mysql/mariadb.conf.d"
+	stateDir  = "/var/lib/mysql"
+	pidFile   = "/run/mysqld/mariadbd.pid"
+)
+
+// FS gives access to the config and state directories of the fake agent, which are kept in memory.
+type FS struct {
+	memory *filesystem.Memory
+}
+
+func newFS() (*FS, error) {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{configDir, stateDir, filepath.Dir(pidFile)} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &FS{
+		memory: memory,
+	}, nil
+}
+
+// Memory returns the filesystem backing the fake agent.
+func (f *FS) Memory() *filesystem.Memory {
+	return f.memory
+}
+
+func (f *FS) WriteConfigFile(name string, bytes []byte) error {
+	return f.memory.WriteFile(filepath.Join(configDir, name), bytes, 0644)
+}
+
+func (f *FS) ReadConfigFile(name string) ([]byte, error) {
+	return f.memory.ReadFile(filepath.Join(configDir, name))
+}
+
+func (f *FS) DeleteConfigFile(name string) error {
+	return f.memory.Remove(filepath.Join(configDir, name))
+}
+
+func (f *FS) ConfigFileExists(name string) bool {
+	_, err := f.memory.Stat(filepath.Join(configDir, name))
+	return err == nil
+}
+
+func (f *FS) ConfigFiles() []string {
+	return f.names(configDir)
+}
+
+func (f *FS) WriteStateFile(name string, bytes []byte) error {
+	return f.memory.WriteFile(filepath.Join(stateDir, name), bytes, 0644)
+}
+
+// AppendStateFile appends to a state file, as mariadbd does when writing the recovery log.
+func (f *FS) AppendStateFile(name string, bytes []byte) error {
+	return f.memory.AppendFile(filepath.Join(stateDir, name), bytes, 0644)
+}
+
+func (f *FS) ReadStateFile(name string) ([]byte, error) {
+	return f.memory.ReadFile(filepath.Join(stateDir, name))
+}
+
+func (f *FS) DeleteStateFile(name string) error {
+	return f.memory.Remove(filepath.Join(stateDir, name))
+}
+
+func (f *FS) StateFileExists(name string) bool {
+	_, err := f.memory.Stat(filepath.Join(stateDir, name))
+	return err == nil
+}
+
+func (f *FS) StateFiles() []string {
+	return f.names(stateDir)
+}
+
+func (f *FS) names(dir string) []string {
+	entries, err := f.memory.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		// Temporary files and journals of the file manager are hidden.
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,93 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authorization"
+	agenterrors "github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (*authv1.UserInfo, error)
+}
+
+type userContextKey struct{}
+
+func WithUser(ctx context.Context, user *authv1.UserInfo) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+func UserFromContext(ctx context.Context) (*authv1.UserInfo, bool) {
+	user, ok := ctx.Value(userContextKey{}).(*authv1.UserInfo)
+	return user, ok && user != nil
+}
+
+type Middleware struct {
+	authenticator  Authenticator
+	authorizer     authorization.Authorizer
+	responseWriter *responsewriter.ResponseWriter
+	logger         logr.Logger
+}
+
+func NewMiddleware(authenticator Authenticator, authorizer authorization.Authorizer, logger logr.Logger) *Middleware {
+	return &Middleware{
+		authenticator:  authenticator,
+		authorizer:     authorizer,
+		responseWriter: responsewriter.NewResponseWriter(&logger),
+		logger:         logger,
+	}
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user, err := m.authenticator.Authenticate(r)
+		if err != nil {
+			m.logger.V(1).Info("Error authenticating request", "err", err)
+			m.responseWriter.Write(w, agenterrors.NewAPIError("unauthorized"), http.StatusUnauthorized)
+			return
+		}
+		if user == nil || user.Username == "" {
+			m.logger.V(1).Info("Username not found")
+			m.responseWriter.Write(w, agenterrors.NewAPIError("unauthorized"), http.StatusUnauthorized)
+			return
+		}
+		if m.authorizer == nil {
+			m.logger.V(1).Info("Authorizer not configured")
+			m.responseWriter.Write(w, agenterrors.NewAPIError("forbidden"), http.StatusForbidden)
+			return
+		}
+		attrs := authorization.NewAttributes(r, user)
+		allowed, err := m.authorizer.Authorize(r.Context(), attrs)
+		if err != nil {
+			m.logger.Error(err, "Error authorizing request", "username", user.Username)
+			m.responseWriter.Write(w, agenterrors.NewAPIError("forbidden"), http.StatusForbidden)
+			return
+		}
+		if !allowed {
+			m.logger.V(1).Info("Username not allowed", "username", user.Username, "verb", attrs.Verb,
+				"resource", attrs.Resource)
+			m.responseWriter.Write(w, agenterrors.NewAPIError("forbidden"), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	}
+	return http.HandlerFunc(fn)
+}
+
+func BearerToken(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "", errors.New("Authorization header not found")
+	}
+	parts := strings.Split(auth, "Bearer ")
+	if len(parts) != 2 {
+		return "", errors.New("invalid Authorization header")
+	}
+	return parts[1], nil
+}
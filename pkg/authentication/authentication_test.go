@@ -0,0 +1,273 @@
+package authentication
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStaticTokenAuthenticator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	tokens := `# token,username,uid,groups
+operator-token,mariadb-operator,1,"operators,admins"
+dashboard-token,dashboard
+`
+	if err := os.WriteFile(path, []byte(tokens), 0600); err != nil {
+		t.Fatalf("error writing token file: %v", err)
+	}
+	authenticator, err := NewStaticTokenAuthenticator(path)
+	if err != nil {
+		t.Fatalf("error creating authenticator: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		wantUser   string
+		wantGroups int
+		wantErr    bool
+	}{
+		{
+			name:       "operator",
+			header:     "Bearer operator-token",
+			wantUser:   "mariadb-operator",
+			wantGroups: 2,
+		},
+		{
+			name:     "dashboard",
+			header:   "Bearer dashboard-token",
+			wantUser: "dashboard",
+		},
+		{
+			name:    "invalid token",
+			header:  "Bearer foo",
+			wantErr: true,
+		},
+		{
+			name:    "no header",
+			header:  "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/galerastate", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			user, err := authenticator.Authenticate(req)
+			if tt.wantErr && err == nil {
+				t.Fatal("error expected, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("error unexpected, got %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if user.Username != tt.wantUser {
+				t.Fatalf("unexpected username: expected %s, got %s", tt.wantUser, user.Username)
+			}
+			if len(user.Groups) != tt.wantGroups {
+				t.Fatalf("unexpected groups: expected %d, got %v", tt.wantGroups, user.Groups)
+			}
+		})
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	jwt := func(payload string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2ln"
+	}
+	tests := []struct {
+		name       string
+		token      string
+		wantExpiry time.Time
+		wantOK     bool
+	}{
+		{
+			name:       "expiry",
+			token:      jwt(`{"exp":1700000000}`),
+			wantExpiry: time.Unix(1700000000, 0),
+			wantOK:     true,
+		},
+		{
+			name:   "no expiry",
+			token:  jwt(`{"sub":"system:serviceaccount:default:mariadb"}`),
+			wantOK: false,
+		},
+		{
+			name:   "not a jwt",
+			token:  "operator-token",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiry, ok := TokenExpiry(tt.token)
+			if ok != tt.wantOK {
+				t.Fatalf("unexpected ok: expected %v, got %v", tt.wantOK, ok)
+			}
+			if !expiry.Equal(tt.wantExpiry) {
+				t.Fatalf("unexpected expiry: expected %v, got %v", tt.wantExpiry, expiry)
+			}
+		})
+	}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	authenticator, err := NewHMACAuthenticator([]HMACKey{
+		{
+			ID:       "operator",
+			Secret:   string(secret),
+			Username: "mariadb-operator",
+		},
+	}, WithMaxBodySize(1024))
+	if err != nil {
+		t.Fatalf("error creating authenticator: %v", err)
+	}
+	now := time.Now()
+	body := []byte(`{"uuid":"05f061bd-02a3-11ee-857c-aa370ff6666b","seqno":1}`)
+	largeBody := bytes.Repeat([]byte("a"), 2048)
+
+	tests := []struct {
+		name      string
+		target    string
+		keyID     string
+		timestamp int64
+		nonce     string
+		signature string
+		body      []byte
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			target:    "/api/bootstrap",
+			keyID:     "operator",
+			timestamp: now.Unix(),
+			nonce:     "1",
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap", now.Unix(), "1", body),
+			body:      body,
+			wantErr:   false,
+		},
+		{
+			name:      "replayed nonce",
+			target:    "/api/bootstrap",
+			keyID:     "operator",
+			timestamp: now.Unix(),
+			nonce:     "1",
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap", now.Unix(), "1", body),
+			body:      body,
+			wantErr:   true,
+		},
+		{
+			name:      "missing nonce",
+			target:    "/api/bootstrap",
+			keyID:     "operator",
+			timestamp: now.Unix(),
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap", now.Unix(), "", body),
+			body:      body,
+			wantErr:   true,
+		},
+		{
+			name:      "valid query",
+			target:    "/api/bootstrap?force=true&dryRun=false",
+			keyID:     "operator",
+			timestamp: now.Unix(),
+			nonce:     "2",
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap?dryRun=false&force=true", now.Unix(), "2", body),
+			body:      body,
+			wantErr:   false,
+		},
+		{
+			name:      "appended query",
+			target:    "/api/bootstrap?force=true",
+			keyID:     "operator",
+			timestamp: now.Unix(),
+			nonce:     "3",
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap", now.Unix(), "3", body),
+			body:      body,
+			wantErr:   true,
+		},
+		{
+			name:      "tampered body",
+			target:    "/api/bootstrap",
+			keyID:     "operator",
+			timestamp: now.Unix(),
+			nonce:     "4",
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap", now.Unix(), "4", body),
+			body:      []byte(`{"uuid":"05f061bd-02a3-11ee-857c-aa370ff6666b","seqno":2}`),
+			wantErr:   true,
+		},
+		{
+			name:      "body too large",
+			target:    "/api/bootstrap",
+			keyID:     "operator",
+			timestamp: now.Unix(),
+			nonce:     "5",
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap", now.Unix(), "5", largeBody),
+			body:      largeBody,
+			wantErr:   true,
+		},
+		{
+			name:      "wrong secret",
+			target:    "/api/bootstrap",
+			keyID:     "operator",
+			timestamp: now.Unix(),
+			nonce:     "6",
+			signature: HMACSignature([]byte("foo"), http.MethodPut, "/api/bootstrap", now.Unix(), "6", body),
+			body:      body,
+			wantErr:   true,
+		},
+		{
+			name:      "unknown key",
+			target:    "/api/bootstrap",
+			keyID:     "foo",
+			timestamp: now.Unix(),
+			nonce:     "7",
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap", now.Unix(), "7", body),
+			body:      body,
+			wantErr:   true,
+		},
+		{
+			name:      "expired timestamp",
+			target:    "/api/bootstrap",
+			keyID:     "operator",
+			timestamp: now.Add(-time.Hour).Unix(),
+			nonce:     "8",
+			signature: HMACSignature(secret, http.MethodPut, "/api/bootstrap", now.Add(-time.Hour).Unix(), "8", body),
+			body:      body,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.target, bytes.NewReader(tt.body))
+			req.Header.Set(HMACKeyIDHeader, tt.keyID)
+			req.Header.Set(HMACTimestampHeader, strconv.FormatInt(tt.timestamp, 10))
+			req.Header.Set(HMACNonceHeader, tt.nonce)
+			req.Header.Set(HMACSignatureHeader, tt.signature)
+
+			user, err := authenticator.Authenticate(req)
+			if tt.wantErr && err == nil {
+				t.Fatal("error expected, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("error unexpected, got %v", err)
+			}
+			if !tt.wantErr && user.Username != "mariadb-operator" {
+				t.Fatalf("unexpected username: %s", user.Username)
+			}
+		})
+	}
+}
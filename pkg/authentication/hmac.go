@@ -0,0 +1,189 @@
+package authentication
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	authv1 "k8s.io/api/authentication/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	HMACKeyIDHeader     = "X-Agent-Key-Id"
+	HMACTimestampHeader = "X-Agent-Timestamp"
+	HMACSignatureHeader = "X-Agent-Signature"
+	HMACNonceHeader     = "X-Agent-Nonce"
+
+	defaultHMACMaxBodySize = 1 << 20
+	maxHMACNonceLength     = 128
+)
+
+// HMACSignature signs the method, canonical request URI, unix timestamp, nonce and body digest of a request
+// with the given secret. The request URI is expected to be built with CanonicalRequestURI.
+func HMACSignature(secret []byte, method, requestURI string, timestamp int64, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s\n%s", method, requestURI, timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CanonicalRequestURI returns the escaped path and the query sorted by key, so the signature covers the query
+// regardless of the order in which the parameters are encoded.
+func CanonicalRequestURI(u *url.URL) string {
+	query := u.Query().Encode()
+	if query == "" {
+		return u.EscapedPath()
+	}
+	return u.EscapedPath() + "?" + query
+}
+
+type HMACKey struct {
+	ID       string   `json:"id"`
+	Secret   string   `json:"secret"`
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+type HMACAuthenticatorOption func(*HMACAuthenticator)
+
+func WithMaxClockSkew(skew time.Duration) HMACAuthenticatorOption {
+	return func(h *HMACAuthenticator) {
+		h.maxClockSkew = skew
+	}
+}
+
+// WithMaxBodySize limits the size of the request bodies read to verify the signature.
+func WithMaxBodySize(size int64) HMACAuthenticatorOption {
+	return func(h *HMACAuthenticator) {
+		h.maxBodySize = size
+	}
+}
+
+// HMACAuthenticator verifies signed requests. Every request carries a nonce, which is remembered until its
+// timestamp falls out of the allowed clock skew, so a captured request cannot be replayed.
+type HMACAuthenticator struct {
+	keys         map[string]HMACKey
+	maxClockSkew time.Duration
+	maxBodySize  int64
+	now          func() time.Time
+
+	mux    sync.Mutex
+	nonces map[string]time.Time
+}
+
+func NewHMACAuthenticator(keys []HMACKey, opts ...HMACAuthenticatorOption) (*HMACAuthenticator, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one key must be provided")
+	}
+	keyMap := make(map[string]HMACKey, len(keys))
+	for _, key := range keys {
+		if key.ID == "" || key.Secret == "" || key.Username == "" {
+			return nil, errors.New("key id, secret and username are required")
+		}
+		keyMap[key.ID] = key
+	}
+	authenticator := &HMACAuthenticator{
+		keys:         keyMap,
+		maxClockSkew: 5 * time.Minute,
+		maxBodySize:  defaultHMACMaxBodySize,
+		now:          time.Now,
+		nonces:       make(map[string]time.Time),
+	}
+	for _, setOpt := range opts {
+		setOpt(authenticator)
+	}
+	return authenticator, nil
+}
+
+func NewHMACAuthenticatorFromFile(path string, opts ...HMACAuthenticatorOption) (*HMACAuthenticator, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading HMAC keys file: %v", err)
+	}
+	var keys struct {
+		Keys []HMACKey `json:"keys"`
+	}
+	if err := yaml.UnmarshalStrict(bytes, &keys); err != nil {
+		return nil, fmt.Errorf("error decoding HMAC keys file: %v", err)
+	}
+	return NewHMACAuthenticator(keys.Keys, opts...)
+}
+
+func (h *HMACAuthenticator) Authenticate(r *http.Request) (*authv1.UserInfo, error) {
+	keyID := r.Header.Get(HMACKeyIDHeader)
+	signature := r.Header.Get(HMACSignatureHeader)
+	if keyID == "" || signature == "" {
+		return nil, errors.New("HMAC headers not found")
+	}
+	key, ok := h.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key '%s'", keyID)
+	}
+	nonce := r.Header.Get(HMACNonceHeader)
+	if nonce == "" || len(nonce) > maxHMACNonceLength {
+		return nil, errors.New("invalid nonce")
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(HMACTimestampHeader), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	skew := h.now().Sub(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > h.maxClockSkew {
+		return nil, errors.New("timestamp outside of allowed clock skew")
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(http.MaxBytesReader(nil, r.Body, h.maxBodySize))
+		if err != nil {
+			return nil, fmt.Errorf("error reading body: %v", err)
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := HMACSignature([]byte(key.Secret), r.Method, CanonicalRequestURI(r.URL), timestamp, nonce, body)
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected)) {
+		return nil, errors.New("invalid signature")
+	}
+	if !h.useNonce(keyID+"/"+nonce, time.Unix(timestamp, 0).Add(h.maxClockSkew)) {
+		return nil, errors.New("nonce already used")
+	}
+	return &authv1.UserInfo{
+		Username: key.Username,
+		Groups:   key.Groups,
+	}, nil
+}
+
+// useNonce records a nonce until it expires, returning false if it was already recorded. Only nonces of
+// requests with a valid signature are recorded, so the callers cannot grow the cache without a key.
+func (h *HMACAuthenticator) useNonce(nonce string, expiresAt time.Time) bool {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	now := h.now()
+	for n, exp := range h.nonces {
+		if now.After(exp) {
+			delete(h.nonces, n)
+		}
+	}
+	if _, ok := h.nonces[nonce]; ok {
+		return false
+	}
+	h.nonces[nonce] = expiresAt
+	return true
+}
@@ -0,0 +1,33 @@
+package authentication
+
+import (
+	"errors"
+	"net/http"
+
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+// TLSAuthenticator authenticates callers by their verified client certificate, using the common name as
+// username and the organizations as groups. The server must be configured to verify client certificates.
+type TLSAuthenticator struct{}
+
+func NewTLSAuthenticator() *TLSAuthenticator {
+	return &TLSAuthenticator{}
+}
+
+func (t *TLSAuthenticator) Authenticate(r *http.Request) (*authv1.UserInfo, error) {
+	if r.TLS == nil {
+		return nil, errors.New("TLS connection required")
+	}
+	if len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, errors.New("verified client certificate not found")
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName == "" {
+		return nil, errors.New("client certificate common name not found")
+	}
+	return &authv1.UserInfo{
+		Username: cert.Subject.CommonName,
+		Groups:   cert.Subject.Organization,
+	}, nil
+}
@@ -0,0 +1,140 @@
+package authentication
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+type tokenEntry struct {
+	hash [sha256.Size]byte
+	user authv1.UserInfo
+}
+
+// StaticTokenAuthenticator authenticates bearer tokens listed in a CSV file with the format:
+// token,username,uid,"group1,group2". The file is reloaded when it changes.
+type StaticTokenAuthenticator struct {
+	path    string
+	mux     sync.RWMutex
+	tokens  []tokenEntry
+	modTime time.Time
+}
+
+func NewStaticTokenAuthenticator(path string) (*StaticTokenAuthenticator, error) {
+	authenticator := &StaticTokenAuthenticator{
+		path: path,
+	}
+	if err := authenticator.reload(); err != nil {
+		return nil, err
+	}
+	return authenticator, nil
+}
+
+func (s *StaticTokenAuthenticator) Authenticate(r *http.Request) (*authv1.UserInfo, error) {
+	token, err := BearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(token))
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	var user *authv1.UserInfo
+	for i := range s.tokens {
+		if subtle.ConstantTimeCompare(hash[:], s.tokens[i].hash[:]) == 1 {
+			u := s.tokens[i].user
+			user = &u
+		}
+	}
+	if user == nil {
+		return nil, errors.New("invalid token")
+	}
+	return user, nil
+}
+
+func (s *StaticTokenAuthenticator) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("error reading token file: %v", err)
+	}
+	s.mux.RLock()
+	upToDate := s.tokens != nil && info.ModTime().Equal(s.modTime)
+	s.mux.RUnlock()
+	if upToDate {
+		return nil
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("error opening token file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("error reading token file: %v", err)
+	}
+	tokens := make([]tokenEntry, 0, len(records))
+	for i, record := range records {
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			return fmt.Errorf("invalid token file line %d: token and username are required", i+1)
+		}
+		entry := tokenEntry{
+			hash: sha256.Sum256([]byte(record[0])),
+			user: authv1.UserInfo{
+				Username: record[1],
+			},
+		}
+		if len(record) > 2 {
+			entry.user.UID = record[2]
+		}
+		if len(record) > 3 && record[3] != "" {
+			entry.user.Groups = strings.Split(record[3], ",")
+		}
+		tokens = append(tokens, entry)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.tokens = tokens
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// TokenExpiry reads the exp claim of a JWT without verifying it, so it must only be used for caching purposes.
+// It returns false when the token is not a JWT or it has no expiry.
+func TokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(*claims.Exp, 0), true
+}
@@ -0,0 +1,47 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+const (
+	UnixSocketUsername = "system:unix-socket"
+)
+
+type unixSocketContextKey struct{}
+
+// UnixSocketConnContext marks the requests received through a unix domain socket. It is meant to be used
+// as http.Server.ConnContext.
+func UnixSocketConnContext(ctx context.Context, c net.Conn) context.Context {
+	if _, ok := c.(*net.UnixConn); ok {
+		return context.WithValue(ctx, unixSocketContextKey{}, true)
+	}
+	return ctx
+}
+
+func IsUnixSocket(ctx context.Context) bool {
+	unix, ok := ctx.Value(unixSocketContextKey{}).(bool)
+	return ok && unix
+}
+
+// UnixSocketAuthenticator trusts every request received through a unix domain socket. Access is restricted by
+// the socket file permissions, so the Kubernetes API server is not needed to authenticate local callers.
+type UnixSocketAuthenticator struct{}
+
+func NewUnixSocketAuthenticator() *UnixSocketAuthenticator {
+	return &UnixSocketAuthenticator{}
+}
+
+func (u *UnixSocketAuthenticator) Authenticate(r *http.Request) (*authv1.UserInfo, error) {
+	if !IsUnixSocket(r.Context()) {
+		return nil, errors.New("unix socket connection required")
+	}
+	return &authv1.UserInfo{
+		Username: UnixSocketUsername,
+	}, nil
+}
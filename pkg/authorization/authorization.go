@@ -0,0 +1,68 @@
+package authorization
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+const (
+	apiPrefix = "/api"
+)
+
+type Attributes struct {
+	User        *authv1.UserInfo
+	Verb        string
+	Resource    string
+	Subresource string
+	Path        string
+}
+
+type Authorizer interface {
+	Authorize(ctx context.Context, attrs *Attributes) (bool, error)
+}
+
+func NewAttributes(r *http.Request, user *authv1.UserInfo) *Attributes {
+	attrs := &Attributes{
+		User: user,
+		Verb: verb(r.Method),
+		Path: r.URL.Path,
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+	if len(parts) > 0 {
+		attrs.Resource = parts[0]
+	}
+	if len(parts) > 1 {
+		attrs.Subresource = parts[1]
+	}
+	return attrs
+}
+
+func verb(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "get"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return strings.ToLower(method)
+	}
+}
+
+type AuthenticatedAuthorizer struct{}
+
+func NewAuthenticatedAuthorizer() *AuthenticatedAuthorizer {
+	return &AuthenticatedAuthorizer{}
+}
+
+func (a *AuthenticatedAuthorizer) Authorize(ctx context.Context, attrs *Attributes) (bool, error) {
+	return attrs.User != nil && attrs.User.Username != "", nil
+}
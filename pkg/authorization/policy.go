@@ -0,0 +1,119 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	wildcard = "*"
+)
+
+type Rule struct {
+	Verbs           []string `json:"verbs"`
+	Resources       []string `json:"resources"`
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+	Users           []string `json:"users,omitempty"`
+	Groups          []string `json:"groups,omitempty"`
+}
+
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+func (p *Policy) Validate() error {
+	if len(p.Rules) == 0 {
+		return errors.New("at least one rule must be provided")
+	}
+	for i, rule := range p.Rules {
+		if len(rule.Verbs) == 0 || len(rule.Resources) == 0 {
+			return fmt.Errorf("rule %d: verbs and resources must be provided", i)
+		}
+		if len(rule.ServiceAccounts) == 0 && len(rule.Users) == 0 && len(rule.Groups) == 0 {
+			return fmt.Errorf("rule %d: at least one serviceAccount, user or group must be provided", i)
+		}
+		for _, sa := range rule.ServiceAccounts {
+			if len(strings.Split(sa, "/")) != 2 {
+				return fmt.Errorf("rule %d: invalid serviceAccount '%s', expected format is 'namespace/name'", i, sa)
+			}
+		}
+	}
+	return nil
+}
+
+type PolicyAuthorizer struct {
+	policy *Policy
+}
+
+func NewPolicyAuthorizer(policy *Policy) (*PolicyAuthorizer, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	return &PolicyAuthorizer{
+		policy: policy,
+	}, nil
+}
+
+func NewPolicyAuthorizerFromFile(path string) (*PolicyAuthorizer, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy file: %v", err)
+	}
+	var policy Policy
+	if err := yaml.UnmarshalStrict(bytes, &policy); err != nil {
+		return nil, fmt.Errorf("error decoding policy file: %v", err)
+	}
+	return NewPolicyAuthorizer(&policy)
+}
+
+func (p *PolicyAuthorizer) Authorize(ctx context.Context, attrs *Attributes) (bool, error) {
+	if attrs.User == nil {
+		return false, nil
+	}
+	for _, rule := range p.policy.Rules {
+		if rule.matchesRequest(attrs) && rule.matchesSubject(attrs) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *Rule) matchesRequest(attrs *Attributes) bool {
+	resource := attrs.Resource
+	if attrs.Subresource != "" {
+		resource = fmt.Sprintf("%s/%s", attrs.Resource, attrs.Subresource)
+	}
+	return contains(r.Verbs, attrs.Verb) && contains(r.Resources, resource)
+}
+
+func (r *Rule) matchesSubject(attrs *Attributes) bool {
+	for _, sa := range r.ServiceAccounts {
+		parts := strings.Split(sa, "/")
+		if attrs.User.Username == fmt.Sprintf("system:serviceaccount:%s:%s", parts[0], parts[1]) {
+			return true
+		}
+	}
+	if contains(r.Users, attrs.User.Username) {
+		return true
+	}
+	for _, group := range attrs.User.Groups {
+		if contains(r.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == wildcard || v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package authorization
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+func TestPolicyAuthorizer(t *testing.T) {
+	authorizer, err := NewPolicyAuthorizer(&Policy{
+		Rules: []Rule{
+			{
+				Verbs:           []string{"*"},
+				Resources:       []string{"*"},
+				ServiceAccounts: []string{"mariadb-operator/mariadb-operator"},
+			},
+			{
+				Verbs:     []string{"get"},
+				Resources: []string{"galerastate"},
+				Users:     []string{"system:serviceaccount:monitoring:dashboard"},
+				Groups:    []string{"oncall"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating policy authorizer: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		user        *authv1.UserInfo
+		wantAllowed bool
+	}{
+		{
+			name:   "operator bootstrap",
+			method: http.MethodPut,
+			path:   "/api/bootstrap",
+			user: &authv1.UserInfo{
+				Username: "system:serviceaccount:mariadb-operator:mariadb-operator",
+			},
+			wantAllowed: true,
+		},
+		{
+			name:   "dashboard galera state",
+			method: http.MethodGet,
+			path:   "/api/galerastate",
+			user: &authv1.UserInfo{
+				Username: "system:serviceaccount:monitoring:dashboard",
+			},
+			wantAllowed: true,
+		},
+		{
+			name:   "dashboard bootstrap",
+			method: http.MethodPut,
+			path:   "/api/bootstrap",
+			user: &authv1.UserInfo{
+				Username: "system:serviceaccount:monitoring:dashboard",
+			},
+			wantAllowed: false,
+		},
+		{
+			name:   "oncall galera state",
+			method: http.MethodGet,
+			path:   "/api/galerastate",
+			user: &authv1.UserInfo{
+				Username: "jane",
+				Groups:   []string{"system:authenticated", "oncall"},
+			},
+			wantAllowed: true,
+		},
+		{
+			name:   "oncall recovery",
+			method: http.MethodDelete,
+			path:   "/api/recovery",
+			user: &authv1.UserInfo{
+				Username: "jane",
+				Groups:   []string{"system:authenticated", "oncall"},
+			},
+			wantAllowed: false,
+		},
+		{
+			name:   "unknown user",
+			method: http.MethodGet,
+			path:   "/api/galerastate",
+			user: &authv1.UserInfo{
+				Username: "system:serviceaccount:default:foo",
+			},
+			wantAllowed: false,
+		},
+		{
+			name:        "no user",
+			method:      http.MethodGet,
+			path:        "/api/galerastate",
+			user:        nil,
+			wantAllowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			allowed, err := authorizer.Authorize(context.Background(), NewAttributes(req, tt.user))
+			if err != nil {
+				t.Fatalf("error unexpected, got %v", err)
+			}
+			if allowed != tt.wantAllowed {
+				t.Fatalf("unexpected result: expected %v, got %v", tt.wantAllowed, allowed)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *Policy
+		wantErr bool
+	}{
+		{
+			name:    "no rules",
+			policy:  &Policy{},
+			wantErr: true,
+		},
+		{
+			name: "no subjects",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Verbs:     []string{"get"},
+						Resources: []string{"galerastate"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid service account",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Verbs:           []string{"get"},
+						Resources:       []string{"galerastate"},
+						ServiceAccounts: []string{"dashboard"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid",
+			policy: &Policy{
+				Rules: []Rule{
+					{
+						Verbs:           []string{"get"},
+						Resources:       []string{"galerastate"},
+						ServiceAccounts: []string{"monitoring/dashboard"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.wantErr && err == nil {
+				t.Fatal("error expected, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("error unexpected, got %v", err)
+			}
+		})
+	}
+}
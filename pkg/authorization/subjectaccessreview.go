@@ -0,0 +1,83 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DefaultGroup = "agent.mariadb.mmontes.io"
+)
+
+type SubjectAccessReviewOption func(*SubjectAccessReviewAuthorizer)
+
+func WithGroup(group string) SubjectAccessReviewOption {
+	return func(s *SubjectAccessReviewAuthorizer) {
+		s.group = group
+	}
+}
+
+func WithNamespace(namespace string) SubjectAccessReviewOption {
+	return func(s *SubjectAccessReviewAuthorizer) {
+		s.namespace = namespace
+	}
+}
+
+func WithName(name string) SubjectAccessReviewOption {
+	return func(s *SubjectAccessReviewAuthorizer) {
+		s.name = name
+	}
+}
+
+type SubjectAccessReviewAuthorizer struct {
+	clientset kubernetes.Interface
+	group     string
+	namespace string
+	name      string
+}
+
+func NewSubjectAccessReviewAuthorizer(clientset kubernetes.Interface, opts ...SubjectAccessReviewOption) *SubjectAccessReviewAuthorizer {
+	authorizer := &SubjectAccessReviewAuthorizer{
+		clientset: clientset,
+		group:     DefaultGroup,
+	}
+	for _, setOpt := range opts {
+		setOpt(authorizer)
+	}
+	return authorizer
+}
+
+func (s *SubjectAccessReviewAuthorizer) Authorize(ctx context.Context, attrs *Attributes) (bool, error) {
+	if attrs.User == nil {
+		return false, nil
+	}
+	extra := make(map[string]authzv1.ExtraValue, len(attrs.User.Extra))
+	for k, v := range attrs.User.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	sar := &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   attrs.User.Username,
+			UID:    attrs.User.UID,
+			Groups: attrs.User.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Namespace:   s.namespace,
+				Verb:        attrs.Verb,
+				Group:       s.group,
+				Resource:    attrs.Resource,
+				Subresource: attrs.Subresource,
+				Name:        s.name,
+			},
+		},
+	}
+	sarRes, err := s.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("error creating SubjectAccessReview: %v", err)
+	}
+	return sarRes.Status.Allowed && !sarRes.Status.Denied, nil
+}
@@ -11,11 +11,12 @@ type Bootstrap struct {
 	*Client
 }
 
-func (b *Bootstrap) Enable(ctx context.Context, bootstrap *galera.Bootstrap) error {
+func (b *Bootstrap) Enable(ctx context.Context, bootstrap *galera.Bootstrap, opts ...MutationOption) error {
 	req, err := b.newRequestWithContext(ctx, http.MethodPut, "/api/bootstrap", bootstrap)
 	if err != nil {
 		return err
 	}
+	setMutationOptions(req, opts)
 	return b.do(req, nil)
 }
 
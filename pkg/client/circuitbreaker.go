@@ -0,0 +1,121 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreakers keeps a circuit breaker per host. It can be shared by multiple clients.
+type CircuitBreakers struct {
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mux      sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func NewCircuitBreakers(failureThreshold int, openTimeout time.Duration) *CircuitBreakers {
+	return &CircuitBreakers{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		breakers:         make(map[string]*circuitBreaker),
+	}
+}
+
+func (c *CircuitBreakers) IsOpen(host string) bool {
+	return c.get(host).isOpen()
+}
+
+func (c *CircuitBreakers) get(host string) *circuitBreaker {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	breaker, ok := c.breakers[host]
+	if !ok {
+		breaker = &circuitBreaker{
+			failureThreshold: c.failureThreshold,
+			openTimeout:      c.openTimeout,
+			now:              time.Now,
+		}
+		c.breakers[host] = breaker
+	}
+	return breaker
+}
+
+type circuitBreaker struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	now              func() time.Time
+
+	mux      sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func (c *circuitBreaker) allow() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	switch c.state {
+	case circuitOpen:
+		if c.now().Sub(c.openedAt) < c.openTimeout {
+			return false
+		}
+		c.state = circuitHalfOpen
+		c.probing = true
+		return true
+	case circuitHalfOpen:
+		if c.probing {
+			return false
+		}
+		c.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (c *circuitBreaker) record(failure bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if !failure {
+		c.state = circuitClosed
+		c.failures = 0
+		c.probing = false
+		return
+	}
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= c.failureThreshold {
+		c.state = circuitOpen
+		c.openedAt = c.now()
+		c.probing = false
+	}
+}
+
+// release gives up the probe granted by allow without recording an outcome, e.g. when the request could not be
+// sent or it was cancelled by the caller, so another request can probe the backend.
+func (c *circuitBreaker) release() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.probing = false
+}
+
+func (c *circuitBreaker) isOpen() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.state == circuitOpen && c.now().Sub(c.openedAt) < c.openTimeout
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerRelease(t *testing.T) {
+	now := time.Now()
+	breaker := &circuitBreaker{
+		failureThreshold: 1,
+		openTimeout:      time.Minute,
+		now:              func() time.Time { return now },
+	}
+	if !breaker.allow() {
+		t.Fatal("expected closed circuit to allow requests")
+	}
+	breaker.record(true)
+	if breaker.allow() {
+		t.Fatal("expected open circuit to reject requests")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.allow() {
+		t.Fatal("expected half-open circuit to allow a probe")
+	}
+	if breaker.allow() {
+		t.Fatal("expected half-open circuit to allow a single probe")
+	}
+	// The probe could not be sent, so another request gets to probe.
+	breaker.release()
+	if !breaker.allow() {
+		t.Fatal("expected released probe to be granted again")
+	}
+	breaker.record(false)
+	if breaker.state != circuitClosed {
+		t.Fatalf("expected circuit to be closed after a successful probe, got %v", breaker.state)
+	}
+}
+
+func TestClientCircuitBreakerContextCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	circuitBreakers := NewCircuitBreakers(1, time.Minute)
+	client, err := NewClient(server.URL, WithCircuitBreakers(circuitBreakers))
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GaleraState.Get(ctx); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected request error, got %v", err)
+	}
+	if circuitBreakers.IsOpen(client.baseUrl.Host) {
+		t.Fatal("expected circuit to stay closed when the caller cancels the request")
+	}
+}
@@ -1,13 +1,16 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"time"
 
 	"github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/requestid"
 )
 
 type Option func(*Client)
@@ -30,10 +33,68 @@ func WithTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithUnixSocket sends every request through a unix domain socket. The host of the base URL is ignored,
+// for example: http://localhost.
+func WithUnixSocket(path string) Option {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		}
+		c.httpClient = &http.Client{
+			Transport: transport,
+			Timeout:   c.httpClient.Timeout,
+		}
+	}
+}
+
+// WithKubernetesAuth authenticates with the ServiceAccount token in serviceAccountPath. The agent only accepts tokens
+// for kubernetesauth.DefaultAudience by default, so it should be a projected token for that audience rather than
+// the default Pod token. See NewTokenRequestTokenSource to request the tokens instead.
 func WithKubernetesAuth(auth bool, serviceAccountPath string) Option {
 	return func(c *Client) {
-		c.kubernetesAuth = auth
-		c.kubernetesSA = serviceAccountPath
+		if auth && serviceAccountPath != "" {
+			c.tokenSource = NewFileTokenSource(serviceAccountPath)
+		}
+	}
+}
+
+func WithTokenSource(tokenSource TokenSource) Option {
+	return func(c *Client) {
+		c.tokenSource = tokenSource
+	}
+}
+
+func WithHMACAuth(keyID string, secret []byte) Option {
+	return func(c *Client) {
+		c.hmacKeyID = keyID
+		c.hmacSecret = secret
+	}
+}
+
+func WithRetryAfter(maxRetries int, maxWait time.Duration) Option {
+	return func(c *Client) {
+		c.retryAfterMaxRetries = maxRetries
+		c.retryAfterMaxWait = maxWait
+	}
+}
+
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+func WithCircuitBreakers(circuitBreakers *CircuitBreakers) Option {
+	return func(c *Client) {
+		c.circuitBreakers = circuitBreakers
+	}
+}
+
+func WithAttemptHook(hook AttemptHook) Option {
+	return func(c *Client) {
+		c.attemptHooks = append(c.attemptHooks, hook)
 	}
 }
 
@@ -42,11 +103,18 @@ type Client struct {
 	GaleraState *GaleraState
 	Recovery    *Recovery
 
-	baseUrl        *url.URL
-	httpClient     *http.Client
-	headers        map[string]string
-	kubernetesAuth bool
-	kubernetesSA   string
+	baseUrl     *url.URL
+	httpClient  *http.Client
+	headers     map[string]string
+	tokenSource TokenSource
+	hmacKeyID   string
+	hmacSecret  []byte
+
+	retryAfterMaxRetries int
+	retryAfterMaxWait    time.Duration
+	retryPolicy          *RetryPolicy
+	circuitBreakers      *CircuitBreakers
+	attemptHooks         []AttemptHook
 }
 
 func NewClient(baseUrl string, opts ...Option) (*Client, error) {
@@ -55,11 +123,13 @@ func NewClient(baseUrl string, opts ...Option) (*Client, error) {
 		return nil, fmt.Errorf("error parsing base URL: %v", err)
 	}
 	client := &Client{
-		baseUrl:        url,
-		httpClient:     http.DefaultClient,
-		headers:        make(map[string]string, 0),
-		kubernetesAuth: false,
-		kubernetesSA:   "",
+		baseUrl:     url,
+		httpClient:  http.DefaultClient,
+		headers:     make(map[string]string, 0),
+		tokenSource: nil,
+
+		retryAfterMaxRetries: 3,
+		retryAfterMaxWait:    1 * time.Minute,
 	}
 	for _, setOpt := range opts {
 		setOpt(client)
@@ -78,10 +148,52 @@ func NewClient(baseUrl string, opts ...Option) (*Client, error) {
 }
 
 func (c *Client) do(req *http.Request, v interface{}) error {
-	res, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error doing request: %v", err)
+	var breaker *circuitBreaker
+	if c.circuitBreakers != nil {
+		breaker = c.circuitBreakers.get(req.URL.Host)
 	}
+	for attempt := 0; ; attempt++ {
+		if breaker != nil && !breaker.allow() {
+			return fmt.Errorf("error doing request to '%s': %w", req.URL.Host, ErrCircuitOpen)
+		}
+		if err := c.signHMAC(req); err != nil {
+			if breaker != nil {
+				breaker.release()
+			}
+			return fmt.Errorf("error signing request: %v", err)
+		}
+		start := time.Now()
+		res, err := c.httpClient.Do(req)
+		if breaker != nil {
+			// The cancellation of the caller context says nothing about the backend.
+			if err != nil && req.Context().Err() != nil {
+				breaker.release()
+			} else {
+				breaker.record(isFailure(res, err))
+			}
+		}
+		wait, retry := c.shouldRetry(req, res, err, attempt)
+		c.observeAttempt(req, res, err, attempt, time.Since(start), wait, retry)
+
+		if !retry {
+			if err != nil {
+				return fmt.Errorf("error doing request: %v", err)
+			}
+			return handleResponse(res, v)
+		}
+		if res != nil {
+			drainBody(res)
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return fmt.Errorf("error waiting to retry request: %v", err)
+		}
+		if req, err = rewindRequest(req); err != nil {
+			return fmt.Errorf("error rewinding request: %v", err)
+		}
+	}
+}
+
+func handleResponse(res *http.Response, v interface{}) error {
 	defer res.Body.Close()
 	decoder := json.NewDecoder(res.Body)
 
@@ -90,7 +202,15 @@ func (c *Client) do(req *http.Request, v interface{}) error {
 		if err := decoder.Decode(&apiErr); err != nil {
 			return fmt.Errorf("error decoding body into error: %v", err)
 		}
-		return errors.NewError(res.StatusCode, apiErr.Error())
+		requestID := res.Header.Get(requestid.Header)
+		if requestID == "" {
+			requestID = apiErr.RequestID
+		}
+		return &errors.Error{
+			HTTPCode:  res.StatusCode,
+			Message:   apiErr.Error(),
+			RequestID: requestID,
+		}
 	}
 
 	if v == nil {
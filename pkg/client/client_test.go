@@ -0,0 +1,326 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	agenterrors "github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/requestid"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+)
+
+func TestClientRetryAfter(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		retryAfter   string
+		throttled    int32
+		wantRequests int32
+		wantErr      bool
+	}{
+		{
+			name:         "retried",
+			opts:         nil,
+			retryAfter:   "0",
+			throttled:    2,
+			wantRequests: 3,
+			wantErr:      false,
+		},
+		{
+			name:         "retries exhausted",
+			opts:         []Option{WithRetryAfter(1, time.Minute)},
+			retryAfter:   "0",
+			throttled:    3,
+			wantRequests: 2,
+			wantErr:      true,
+		},
+		{
+			name:         "wait exceeds maximum",
+			opts:         []Option{WithRetryAfter(3, time.Second)},
+			retryAfter:   "60",
+			throttled:    1,
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "no Retry-After",
+			opts:         nil,
+			retryAfter:   "",
+			throttled:    1,
+			wantRequests: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tt.throttled {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusTooManyRequests)
+					w.Write([]byte(`{"message":"too many requests"}`)) //nolint:errcheck
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			client, err := NewClient(server.URL, tt.opts...)
+			if err != nil {
+				t.Fatalf("error creating client: %v", err)
+			}
+			err = client.Recovery.Enable(context.Background())
+			if tt.wantErr && err == nil {
+				t.Fatal("error expected, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("error unexpected, got %v", err)
+			}
+			if tt.wantErr && !IsTooManyRequests(err) {
+				t.Fatalf("expected too many requests error, got %v", err)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Fatalf("unexpected number of requests: expected %d, got %d", tt.wantRequests, n)
+			}
+		})
+	}
+}
+
+func TestClientRetryPolicy(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+	tests := []struct {
+		name         string
+		opts         []Option
+		failures     int32
+		call         func(c *Client) error
+		wantRequests int32
+		wantErr      bool
+	}{
+		{
+			name:     "idempotent retried",
+			opts:     []Option{WithRetryPolicy(policy)},
+			failures: 2,
+			call: func(c *Client) error {
+				_, err := c.GaleraState.Get(context.Background())
+				return err
+			},
+			wantRequests: 3,
+			wantErr:      false,
+		},
+		{
+			name:     "non idempotent not retried",
+			opts:     []Option{WithRetryPolicy(policy)},
+			failures: 1,
+			call: func(c *Client) error {
+				_, err := c.Recovery.Start(context.Background())
+				return err
+			},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		{
+			name:     "retries exhausted",
+			opts:     []Option{WithRetryPolicy(policy)},
+			failures: 5,
+			call: func(c *Client) error {
+				return c.Bootstrap.Disable(context.Background())
+			},
+			wantRequests: 3,
+			wantErr:      true,
+		},
+		{
+			name:     "no retry policy",
+			opts:     nil,
+			failures: 1,
+			call: func(c *Client) error {
+				return c.Bootstrap.Disable(context.Background())
+			},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		{
+			name: "circuit breaker open",
+			opts: []Option{
+				WithRetryPolicy(policy),
+				WithCircuitBreakers(NewCircuitBreakers(2, time.Minute)),
+			},
+			failures: 5,
+			call: func(c *Client) error {
+				err := c.Bootstrap.Disable(context.Background())
+				if !errors.Is(err, ErrCircuitOpen) {
+					return fmt.Errorf("expected circuit open error, got %v", err)
+				}
+				return err
+			},
+			wantRequests: 2,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tt.failures {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					w.Write([]byte(`{"message":"unavailable"}`)) //nolint:errcheck
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{}`)) //nolint:errcheck
+			}))
+			defer server.Close()
+
+			var attempts int32
+			opts := append(tt.opts, WithAttemptHook(func(a *Attempt) {
+				attempts++
+			}))
+			client, err := NewClient(server.URL, opts...)
+			if err != nil {
+				t.Fatalf("error creating client: %v", err)
+			}
+			err = tt.call(client)
+			if tt.wantErr && err == nil {
+				t.Fatal("error expected, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("error unexpected, got %v", err)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Fatalf("unexpected number of requests: expected %d, got %d", tt.wantRequests, n)
+			}
+			if attempts != tt.wantRequests {
+				t.Fatalf("unexpected number of observed attempts: expected %d, got %d", tt.wantRequests, attempts)
+			}
+		})
+	}
+}
+
+func TestClientUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("error listening on unix socket: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := authentication.NewUnixSocketAuthenticator().Authenticate(r); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"unauthorized"}`)) //nolint:errcheck
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Listener = listener
+	server.Config.ConnContext = authentication.UnixSocketConnContext
+	server.Start()
+	defer server.Close()
+
+	client, err := NewClient("http://localhost", WithUnixSocket(socket))
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	if err := client.Recovery.Enable(context.Background()); err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+}
+
+func TestClientRequestID(t *testing.T) {
+	var received []string
+	logger := logr.Discard()
+	responseWriter := responsewriter.NewResponseWriter(&logger)
+	server := httptest.NewServer(requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(requestid.Header))
+		responseWriter.Write(w, agenterrors.NewAPIError("galera state not found"), http.StatusNotFound)
+	})))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	ctx := requestid.NewContext(context.Background(), "operator-1234")
+	_, err = client.GaleraState.Get(ctx)
+	var agentErr *agenterrors.Error
+	if !errors.As(err, &agentErr) {
+		t.Fatalf("expected agent error, got %v", err)
+	}
+	if agentErr.RequestID != "operator-1234" {
+		t.Fatalf("unexpected request ID in error: expected operator-1234, got %s", agentErr.RequestID)
+	}
+
+	if _, err := client.GaleraState.Get(context.Background()); err == nil {
+		t.Fatal("error expected, got nil")
+	}
+	if len(received) != 2 || received[0] != "operator-1234" || received[1] == "" {
+		t.Fatalf("unexpected received request IDs: %v", received)
+	}
+}
+
+func TestClientHMACAuth(t *testing.T) {
+	authenticator, err := authentication.NewHMACAuthenticator([]authentication.HMACKey{
+		{
+			ID:       "operator",
+			Secret:   "secret",
+			Username: "mariadb-operator",
+		},
+	})
+	if err != nil {
+		t.Fatalf("error creating authenticator: %v", err)
+	}
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := authenticator.Authenticate(r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(fmt.Sprintf(`{"message":%q}`, err.Error()))) //nolint:errcheck
+			return
+		}
+		if r.URL.Query().Get("force") != "true" {
+			t.Errorf("expected force query parameter, got %q", r.URL.RawQuery)
+		}
+		// The first attempt is throttled, the retry must be signed with a new nonce.
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message":"too many requests"}`)) //nolint:errcheck
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithHMACAuth("operator", []byte("secret")), WithRetryAfter(1, time.Second))
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	if err := client.Recovery.Enable(context.Background(), WithForce()); err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("unexpected number of authenticated requests: expected 2, got %d", n)
+	}
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+type NodeResult[T any] struct {
+	Node  string
+	Value T
+	Err   error
+}
+
+type NodeResults[T any] []NodeResult[T]
+
+func (r NodeResults[T]) Values() map[string]T {
+	values := make(map[string]T, len(r))
+	for _, result := range r {
+		if result.Err == nil {
+			values[result.Node] = result.Value
+		}
+	}
+	return values
+}
+
+func (r NodeResults[T]) Errors() map[string]error {
+	errs := make(map[string]error)
+	for _, result := range r {
+		if result.Err != nil {
+			errs[result.Node] = result.Err
+		}
+	}
+	return errs
+}
+
+func (r NodeResults[T]) Err() error {
+	var errs []error
+	for _, result := range r {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("node '%s': %w", result.Node, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type ClusterClientOption func(*ClusterClient)
+
+func WithParallelism(parallelism int) ClusterClientOption {
+	return func(c *ClusterClient) {
+		c.parallelism = parallelism
+	}
+}
+
+func WithNodeTimeout(timeout time.Duration) ClusterClientOption {
+	return func(c *ClusterClient) {
+		c.nodeTimeout = timeout
+	}
+}
+
+func WithClientOptions(opts ...Option) ClusterClientOption {
+	return func(c *ClusterClient) {
+		c.clientOpts = append(c.clientOpts, opts...)
+	}
+}
+
+type clusterNode struct {
+	name   string
+	client Interface
+}
+
+type ClusterClient struct {
+	nodes       []clusterNode
+	parallelism int
+	nodeTimeout time.Duration
+	clientOpts  []Option
+}
+
+func NewClusterClient(endpoints []string, opts ...ClusterClientOption) (*ClusterClient, error) {
+	cluster := newClusterClient(opts...)
+	for _, endpoint := range endpoints {
+		client, err := NewClient(endpoint, cluster.clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating client for '%s': %v", endpoint, err)
+		}
+		cluster.nodes = append(cluster.nodes, clusterNode{
+			name:   endpoint,
+			client: client,
+		})
+	}
+	return cluster, nil
+}
+
+// NewClusterClientFromClients accepts any Interface implementation, such as the mocks of the mock package.
+func NewClusterClientFromClients[C Interface](clients map[string]C, opts ...ClusterClientOption) *ClusterClient {
+	cluster := newClusterClient(opts...)
+	for name, client := range clients {
+		cluster.nodes = append(cluster.nodes, clusterNode{
+			name:   name,
+			client: client,
+		})
+	}
+	sort.Slice(cluster.nodes, func(i, j int) bool {
+		return cluster.nodes[i].name < cluster.nodes[j].name
+	})
+	return cluster
+}
+
+func newClusterClient(opts ...ClusterClientOption) *ClusterClient {
+	cluster := &ClusterClient{
+		parallelism: 0,
+		nodeTimeout: 0,
+	}
+	for _, setOpt := range opts {
+		setOpt(cluster)
+	}
+	return cluster
+}
+
+func (c *ClusterClient) Nodes() []string {
+	nodes := make([]string, len(c.nodes))
+	for i, node := range c.nodes {
+		nodes[i] = node.name
+	}
+	return nodes
+}
+
+func (c *ClusterClient) Node(name string) (Interface, error) {
+	for _, node := range c.nodes {
+		if node.name == name {
+			return node.client, nil
+		}
+	}
+	return nil, fmt.Errorf("node '%s' not found", name)
+}
+
+func (c *ClusterClient) Subset(names []string) (*ClusterClient, error) {
+	subset := &ClusterClient{
+		parallelism: c.parallelism,
+		nodeTimeout: c.nodeTimeout,
+		clientOpts:  c.clientOpts,
+	}
+	for _, name := range names {
+		client, err := c.Node(name)
+		if err != nil {
+			return nil, err
+		}
+		subset.nodes = append(subset.nodes, clusterNode{
+			name:   name,
+			client: client,
+		})
+	}
+	return subset, nil
+}
+
+func (c *ClusterClient) GaleraStates(ctx context.Context) NodeResults[*galera.GaleraState] {
+	return fanOut(ctx, c, func(ctx context.Context, client Interface) (*galera.GaleraState, error) {
+		return client.GaleraStateClient().Get(ctx)
+	})
+}
+
+func (c *ClusterClient) EnableRecovery(ctx context.Context) NodeResults[struct{}] {
+	return fanOut(ctx, c, func(ctx context.Context, client Interface) (struct{}, error) {
+		return struct{}{}, client.RecoveryClient().Enable(ctx)
+	})
+}
+
+func (c *ClusterClient) StartRecovery(ctx context.Context) NodeResults[*galera.Bootstrap] {
+	return fanOut(ctx, c, func(ctx context.Context, client Interface) (*galera.Bootstrap, error) {
+		return client.RecoveryClient().Start(ctx)
+	})
+}
+
+func (c *ClusterClient) DisableRecovery(ctx context.Context) NodeResults[struct{}] {
+	return fanOut(ctx, c, func(ctx context.Context, client Interface) (struct{}, error) {
+		return struct{}{}, ignoreNotFound(client.RecoveryClient().Disable(ctx))
+	})
+}
+
+func (c *ClusterClient) DisableBootstrap(ctx context.Context) NodeResults[struct{}] {
+	return fanOut(ctx, c, func(ctx context.Context, client Interface) (struct{}, error) {
+		return struct{}{}, ignoreNotFound(client.BootstrapClient().Disable(ctx))
+	})
+}
+
+func (c *ClusterClient) ForEach(ctx context.Context,
+	fn func(ctx context.Context, node string, client Interface) error) NodeResults[struct{}] {
+	return fanOutNodes(ctx, c, func(ctx context.Context, node clusterNode) (struct{}, error) {
+		return struct{}{}, fn(ctx, node.name, node.client)
+	})
+}
+
+func fanOut[T any](ctx context.Context, c *ClusterClient, fn func(ctx context.Context, client Interface) (T, error)) NodeResults[T] {
+	return fanOutNodes(ctx, c, func(ctx context.Context, node clusterNode) (T, error) {
+		return fn(ctx, node.client)
+	})
+}
+
+func fanOutNodes[T any](ctx context.Context, c *ClusterClient,
+	fn func(ctx context.Context, node clusterNode) (T, error)) NodeResults[T] {
+	results := make(NodeResults[T], len(c.nodes))
+	parallelism := c.parallelism
+	if parallelism <= 0 || parallelism > len(c.nodes) {
+		parallelism = len(c.nodes)
+	}
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i, node := range c.nodes {
+		results[i].Node = node.name
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, node clusterNode) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			nodeCtx := ctx
+			if c.nodeTimeout > 0 {
+				var cancel context.CancelFunc
+				nodeCtx, cancel = context.WithTimeout(ctx, c.nodeTimeout)
+				defer cancel()
+			}
+			results[i].Value, results[i].Err = fn(nodeCtx, node)
+		}(i, node)
+	}
+	wg.Wait()
+	return results
+}
+
+func ignoreNotFound(err error) error {
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
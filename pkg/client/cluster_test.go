@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newGaleraStateServer(t *testing.T, delay time.Duration, statusCode int, body string, inFlight, maxInFlight *atomic.Int32) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inFlight != nil {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				max := maxInFlight.Load()
+				if n <= max || maxInFlight.CompareAndSwap(max, n) {
+					break
+				}
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		w.Write([]byte(body)) //nolint:errcheck
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestClusterClientGaleraStates(t *testing.T) {
+	healthy := `{"version":"2.1","uuid":"05f061bd-02a3-11ee-857c-aa370ff6666b","seqno":3,"safeToBootstrap":false}`
+	nodeA := newGaleraStateServer(t, 0, http.StatusOK, healthy, nil, nil)
+	nodeB := newGaleraStateServer(t, 0, http.StatusNotFound, `{"message":"galera state not found"}`, nil, nil)
+	nodeC := newGaleraStateServer(t, time.Second, http.StatusOK, healthy, nil, nil)
+
+	cluster, err := NewClusterClient([]string{nodeA, nodeB, nodeC}, WithNodeTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("error creating cluster client: %v", err)
+	}
+	results := cluster.GaleraStates(context.Background())
+
+	if len(results) != 3 {
+		t.Fatalf("unexpected number of results: expected 3, got %d", len(results))
+	}
+	if results[0].Err != nil || results[0].Value.Seqno != 3 {
+		t.Fatalf("unexpected result for node A: %+v", results[0])
+	}
+	if !IsNotFound(results[1].Err) {
+		t.Fatalf("expected not found error for node B, got %v", results[1].Err)
+	}
+	if results[2].Err == nil {
+		t.Fatal("expected timeout error for node C, got nil")
+	}
+	if len(results.Values()) != 1 || len(results.Errors()) != 2 || results.Err() == nil {
+		t.Fatalf("unexpected aggregated results: values=%v errors=%v", results.Values(), results.Errors())
+	}
+}
+
+func TestClusterClientParallelism(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	var endpoints []string
+	for i := 0; i < 5; i++ {
+		endpoints = append(endpoints, newGaleraStateServer(t, 50*time.Millisecond, http.StatusOK, `{}`, &inFlight, &maxInFlight))
+	}
+
+	cluster, err := NewClusterClient(endpoints, WithParallelism(2))
+	if err != nil {
+		t.Fatalf("error creating cluster client: %v", err)
+	}
+	results := cluster.EnableRecovery(context.Background())
+	if err := results.Err(); err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+	if max := maxInFlight.Load(); max > 2 {
+		t.Fatalf("unexpected parallelism: expected at most 2, got %d", max)
+	}
+}
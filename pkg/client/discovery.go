@@ -0,0 +1,350 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Endpoint is an agent running in a Pod. Not ready Pods are included, as a crashed MariaDB is precisely
+// the case where the agent needs to be reached.
+type Endpoint struct {
+	Name  string
+	IP    string
+	Ready bool
+	URL   string
+	// Err is set when the client of the endpoint cannot be created, and it is returned by Discovery.Client.
+	Err error
+}
+
+type DiscoveryOption func(*Discovery)
+
+// WithService discovers the agents behind a (headless) Service using its EndpointSlices.
+func WithService(name string) DiscoveryOption {
+	return func(d *Discovery) {
+		d.service = name
+	}
+}
+
+// WithPodSelector discovers the agents running in the Pods matching a label selector.
+func WithPodSelector(selector string) DiscoveryOption {
+	return func(d *Discovery) {
+		d.podSelector = selector
+	}
+}
+
+func WithPort(port int) DiscoveryOption {
+	return func(d *Discovery) {
+		d.port = port
+	}
+}
+
+func WithScheme(scheme string) DiscoveryOption {
+	return func(d *Discovery) {
+		d.scheme = scheme
+	}
+}
+
+// WithPodDNS addresses the agents by their stable DNS name '<pod>.<service>.<namespace>.svc.<clusterDomain>'
+// instead of by IP. It requires WithService and allows validating the agent certificates by hostname.
+func WithPodDNS(clusterDomain string) DiscoveryOption {
+	return func(d *Discovery) {
+		d.clusterDomain = clusterDomain
+	}
+}
+
+func WithDiscoveryClientOptions(opts ...Option) DiscoveryOption {
+	return func(d *Discovery) {
+		d.clientOpts = append(d.clientOpts, opts...)
+	}
+}
+
+func WithResyncPeriod(resync time.Duration) DiscoveryOption {
+	return func(d *Discovery) {
+		d.resync = resync
+	}
+}
+
+// WithOnChange registers a function called with the new endpoints every time they change.
+func WithOnChange(onChange func(endpoints []Endpoint)) DiscoveryOption {
+	return func(d *Discovery) {
+		d.onChange = onChange
+	}
+}
+
+type Discovery struct {
+	clientset     kubernetes.Interface
+	namespace     string
+	service       string
+	podSelector   string
+	port          int
+	scheme        string
+	clusterDomain string
+	clientOpts    []Option
+	resync        time.Duration
+	onChange      func(endpoints []Endpoint)
+
+	mux       sync.RWMutex
+	endpoints []Endpoint
+	clients   map[string]*Client
+}
+
+func NewDiscovery(clientset kubernetes.Interface, namespace string, opts ...DiscoveryOption) (*Discovery, error) {
+	discovery := &Discovery{
+		clientset: clientset,
+		namespace: namespace,
+		port:      5555,
+		scheme:    "http",
+		resync:    10 * time.Minute,
+		clients:   make(map[string]*Client),
+	}
+	for _, setOpt := range opts {
+		setOpt(discovery)
+	}
+	if (discovery.service == "") == (discovery.podSelector == "") {
+		return nil, errors.New("either a service or a pod selector must be provided")
+	}
+	if discovery.clusterDomain != "" && discovery.service == "" {
+		return nil, errors.New("pod DNS names require a service")
+	}
+	if discovery.podSelector != "" {
+		if _, err := labels.Parse(discovery.podSelector); err != nil {
+			return nil, fmt.Errorf("error parsing pod selector: %v", err)
+		}
+	}
+	return discovery, nil
+}
+
+// Refresh lists the endpoints once. Use Start to keep them up to date.
+func (d *Discovery) Refresh(ctx context.Context) error {
+	listOpts := metav1.ListOptions{
+		LabelSelector: d.labelSelector(),
+	}
+	if d.service != "" {
+		list, err := d.clientset.DiscoveryV1().EndpointSlices(d.namespace).List(ctx, listOpts)
+		if err != nil {
+			return fmt.Errorf("error listing EndpointSlices: %v", err)
+		}
+		var objs []interface{}
+		for i := range list.Items {
+			objs = append(objs, &list.Items[i])
+		}
+		d.update(objs)
+		return nil
+	}
+	list, err := d.clientset.CoreV1().Pods(d.namespace).List(ctx, listOpts)
+	if err != nil {
+		return fmt.Errorf("error listing Pods: %v", err)
+	}
+	var objs []interface{}
+	for i := range list.Items {
+		objs = append(objs, &list.Items[i])
+	}
+	d.update(objs)
+	return nil
+}
+
+// Start watches the endpoints until the context is cancelled. It returns once the initial list has been synced.
+func (d *Discovery) Start(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		d.clientset,
+		d.resync,
+		informers.WithNamespace(d.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = d.labelSelector()
+		}),
+	)
+	var informer cache.SharedIndexInformer
+	if d.service != "" {
+		informer = factory.Discovery().V1().EndpointSlices().Informer()
+	} else {
+		informer = factory.Core().V1().Pods().Informer()
+	}
+	onEvent := func() {
+		d.update(informer.GetStore().List())
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { onEvent() },
+		UpdateFunc: func(interface{}, interface{}) { onEvent() },
+		DeleteFunc: func(interface{}) { onEvent() },
+	})
+	if err != nil {
+		return fmt.Errorf("error adding event handler: %v", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("error waiting for cache to sync")
+	}
+	onEvent()
+	return nil
+}
+
+func (d *Discovery) Endpoints() []Endpoint {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return append([]Endpoint(nil), d.endpoints...)
+}
+
+// Clients returns a client per Pod, keyed by Pod name. Clients are reused across refreshes while the Pod URL
+// does not change.
+func (d *Discovery) Clients() map[string]*Client {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	clients := make(map[string]*Client, len(d.clients))
+	for name, client := range d.clients {
+		clients[name] = client
+	}
+	return clients
+}
+
+func (d *Discovery) Client(name string) (*Client, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	client, ok := d.clients[name]
+	if !ok {
+		for _, endpoint := range d.endpoints {
+			if endpoint.Name == name && endpoint.Err != nil {
+				return nil, fmt.Errorf("agent '%s' not available: %v", name, endpoint.Err)
+			}
+		}
+		return nil, fmt.Errorf("agent '%s' not found", name)
+	}
+	return client, nil
+}
+
+// ClusterClient returns a ClusterClient with the currently discovered agents.
+func (d *Discovery) ClusterClient(opts ...ClusterClientOption) *ClusterClient {
+	return NewClusterClientFromClients(d.Clients(), opts...)
+}
+
+func (d *Discovery) labelSelector() string {
+	if d.service != "" {
+		return labels.Set{discoveryv1.LabelServiceName: d.service}.String()
+	}
+	return d.podSelector
+}
+
+func (d *Discovery) update(objs []interface{}) {
+	var endpoints []Endpoint
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *discoveryv1.EndpointSlice:
+			endpoints = append(endpoints, d.endpointSliceEndpoints(o)...)
+		case *corev1.Pod:
+			if endpoint, ok := d.podEndpoint(o); ok {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+	endpoints = dedupEndpoints(endpoints)
+
+	d.mux.Lock()
+	clients := make(map[string]*Client, len(endpoints))
+	for i, endpoint := range endpoints {
+		if client, ok := d.clients[endpoint.Name]; ok && client.baseUrl.String() == endpoint.URL {
+			clients[endpoint.Name] = client
+			continue
+		}
+		client, err := NewClient(endpoint.URL, d.clientOpts...)
+		if err != nil {
+			endpoints[i].Err = fmt.Errorf("error creating client: %v", err)
+			continue
+		}
+		clients[endpoint.Name] = client
+	}
+	if reflect.DeepEqual(endpoints, d.endpoints) {
+		d.mux.Unlock()
+		return
+	}
+	d.endpoints = endpoints
+	d.clients = clients
+	d.mux.Unlock()
+
+	if d.onChange != nil {
+		d.onChange(append([]Endpoint(nil), endpoints...))
+	}
+}
+
+func (d *Discovery) endpointSliceEndpoints(slice *discoveryv1.EndpointSlice) []Endpoint {
+	if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+		return nil
+	}
+	var endpoints []Endpoint
+	for _, e := range slice.Endpoints {
+		if len(e.Addresses) == 0 {
+			continue
+		}
+		ip := e.Addresses[0]
+		name := ip
+		if e.TargetRef != nil && e.TargetRef.Kind == "Pod" {
+			name = e.TargetRef.Name
+		} else if e.Hostname != nil {
+			name = *e.Hostname
+		}
+		endpoints = append(endpoints, Endpoint{
+			Name:  name,
+			IP:    ip,
+			Ready: e.Conditions.Ready == nil || *e.Conditions.Ready,
+			URL:   d.url(name, ip),
+		})
+	}
+	return endpoints
+}
+
+func (d *Discovery) podEndpoint(pod *corev1.Pod) (Endpoint, bool) {
+	if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+		return Endpoint{}, false
+	}
+	ready := false
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			ready = condition.Status == corev1.ConditionTrue
+		}
+	}
+	return Endpoint{
+		Name:  pod.Name,
+		IP:    pod.Status.PodIP,
+		Ready: ready,
+		URL:   d.url(pod.Name, pod.Status.PodIP),
+	}, true
+}
+
+func (d *Discovery) url(name, ip string) string {
+	host := ip
+	if d.clusterDomain != "" {
+		host = fmt.Sprintf("%s.%s.%s.svc.%s", name, d.service, d.namespace, d.clusterDomain)
+	}
+	return fmt.Sprintf("%s://%s", d.scheme, net.JoinHostPort(host, strconv.Itoa(d.port)))
+}
+
+func dedupEndpoints(endpoints []Endpoint) []Endpoint {
+	seen := make(map[string]int, len(endpoints))
+	var deduped []Endpoint
+	for _, endpoint := range endpoints {
+		if i, ok := seen[endpoint.Name]; ok {
+			deduped[i].Ready = deduped[i].Ready || endpoint.Ready
+			continue
+		}
+		seen[endpoint.Name] = len(deduped)
+		deduped = append(deduped, endpoint)
+	}
+	sort.Slice(deduped, func(i, j int) bool {
+		return deduped[i].Name < deduped[j].Name
+	})
+	return deduped
+}
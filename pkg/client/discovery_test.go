@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newEndpointSlice(name, service string, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: service,
+			},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+	}
+}
+
+func newEndpoint(pod, ip string, ready bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses: []string{ip},
+		Conditions: discoveryv1.EndpointConditions{
+			Ready: &ready,
+		},
+		TargetRef: &corev1.ObjectReference{
+			Kind: "Pod",
+			Name: pod,
+		},
+	}
+}
+
+func TestDiscoveryService(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		newEndpointSlice("mariadb-internal-abcde", "mariadb-internal",
+			newEndpoint("mariadb-0", "10.0.0.1", true),
+			newEndpoint("mariadb-1", "10.0.0.2", false),
+		),
+		newEndpointSlice("other-abcde", "other",
+			newEndpoint("other-0", "10.0.0.3", true),
+		),
+	)
+	discovery, err := NewDiscovery(clientset, "default", WithService("mariadb-internal"),
+		WithPodDNS("cluster.local"))
+	if err != nil {
+		t.Fatalf("error creating discovery: %v", err)
+	}
+	if err := discovery.Refresh(context.Background()); err != nil {
+		t.Fatalf("error refreshing discovery: %v", err)
+	}
+
+	endpoints := discovery.Endpoints()
+	if len(endpoints) != 2 {
+		t.Fatalf("unexpected number of endpoints: expected 2, got %d", len(endpoints))
+	}
+	if !endpoints[0].Ready || endpoints[1].Ready {
+		t.Fatalf("unexpected endpoint readiness: %+v", endpoints)
+	}
+	wantURL := "http://mariadb-1.mariadb-internal.default.svc.cluster.local:5555"
+	if endpoints[1].URL != wantURL {
+		t.Fatalf("unexpected URL: expected %s, got %s", wantURL, endpoints[1].URL)
+	}
+	if nodes := discovery.ClusterClient().Nodes(); len(nodes) != 2 || nodes[0] != "mariadb-0" {
+		t.Fatalf("unexpected cluster nodes: %v", nodes)
+	}
+}
+
+func TestDiscoveryClientError(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		newEndpointSlice("mariadb-internal-abcde", "mariadb-internal",
+			newEndpoint("mariadb-0", "10.0.0.1", true),
+		),
+	)
+	changes := 0
+	discovery, err := NewDiscovery(clientset, "default", WithService("mariadb-internal"), WithScheme("ht tp"),
+		WithOnChange(func(endpoints []Endpoint) {
+			changes++
+		}))
+	if err != nil {
+		t.Fatalf("error creating discovery: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := discovery.Refresh(context.Background()); err != nil {
+			t.Fatalf("error refreshing discovery: %v", err)
+		}
+	}
+	if changes != 1 {
+		t.Fatalf("unexpected number of changes: expected 1, got %d", changes)
+	}
+
+	endpoints := discovery.Endpoints()
+	if len(endpoints) != 1 || endpoints[0].Err == nil {
+		t.Fatalf("expected endpoint with client error, got %+v", endpoints)
+	}
+	if _, err := discovery.Client("mariadb-0"); err == nil || !strings.Contains(err.Error(), "error creating client") {
+		t.Fatalf("expected client creation error, got %v", err)
+	}
+}
+
+func TestDiscoveryWatchPods(t *testing.T) {
+	newPod := func(name, ip string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels: map[string]string{
+					"app.kubernetes.io/instance": "mariadb",
+				},
+			},
+			Status: corev1.PodStatus{
+				PodIP: ip,
+			},
+		}
+	}
+	clientset := fake.NewSimpleClientset(newPod("mariadb-0", "10.0.0.1"))
+
+	changes := make(chan []Endpoint, 10)
+	discovery, err := NewDiscovery(clientset, "default", WithPodSelector("app.kubernetes.io/instance=mariadb"),
+		WithOnChange(func(endpoints []Endpoint) {
+			changes <- endpoints
+		}))
+	if err != nil {
+		t.Fatalf("error creating discovery: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := discovery.Start(ctx); err != nil {
+		t.Fatalf("error starting discovery: %v", err)
+	}
+	first, err := discovery.Client("mariadb-0")
+	if err != nil {
+		t.Fatalf("error getting client: %v", err)
+	}
+
+	_, err = clientset.CoreV1().Pods("default").Create(ctx, newPod("mariadb-1", "10.0.0.2"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("error creating pod: %v", err)
+	}
+	timeout := time.After(5 * time.Second)
+	for len(discovery.Endpoints()) != 2 {
+		select {
+		case <-changes:
+		case <-timeout:
+			t.Fatalf("timeout waiting for endpoints to be refreshed: %+v", discovery.Endpoints())
+		}
+	}
+	second, err := discovery.Client("mariadb-0")
+	if err != nil {
+		t.Fatalf("error getting client: %v", err)
+	}
+	if first != second {
+		t.Fatal("expected client to be reused after refresh")
+	}
+}
@@ -12,3 +12,10 @@ func IsNotFound(err error) bool {
 	}
 	return false
 }
+
+func IsTooManyRequests(err error) bool {
+	if clientErr, ok := err.(*errors.Error); ok {
+		return clientErr.HTTPCode == http.StatusTooManyRequests
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/mariadb-operator/agent/pkg/galera"
@@ -22,3 +23,28 @@ func (g *GaleraState) Get(ctx context.Context) (*galera.GaleraState, error) {
 	}
 	return &galeraState, nil
 }
+
+func (g *GaleraState) History(ctx context.Context) ([]galera.GaleraStateVersion, error) {
+	req, err := g.newRequestWithContext(ctx, http.MethodGet, "/api/galerastate/history", nil)
+	if err != nil {
+		return nil, err
+	}
+	var history []galera.GaleraStateVersion
+	if err := g.do(req, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (g *GaleraState) Rollback(ctx context.Context, version int, opts ...MutationOption) (*galera.GaleraState, error) {
+	req, err := g.newRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("/api/galerastate/rollback/%d", version), nil)
+	if err != nil {
+		return nil, err
+	}
+	setMutationOptions(req, opts)
+	var galeraState galera.GaleraState
+	if err := g.do(req, &galeraState); err != nil {
+		return nil, err
+	}
+	return &galeraState, nil
+}
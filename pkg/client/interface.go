@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+type BootstrapInterface interface {
+	Enable(ctx context.Context, bootstrap *galera.Bootstrap, opts ...MutationOption) error
+	Disable(ctx context.Context) error
+}
+
+type GaleraStateInterface interface {
+	Get(ctx context.Context) (*galera.GaleraState, error)
+	History(ctx context.Context) ([]galera.GaleraStateVersion, error)
+	Rollback(ctx context.Context, version int, opts ...MutationOption) (*galera.GaleraState, error)
+}
+
+type RecoveryInterface interface {
+	Enable(ctx context.Context, opts ...MutationOption) error
+	Start(ctx context.Context) (*galera.Bootstrap, error)
+	Run(ctx context.Context) (*galera.Bootstrap, error)
+	Result(ctx context.Context) (*galera.RecoveryResult, error)
+	Disable(ctx context.Context) error
+}
+
+// Interface is implemented by Client. Depend on it instead of *Client to be able to replace the agent with a mock.
+type Interface interface {
+	BootstrapClient() BootstrapInterface
+	GaleraStateClient() GaleraStateInterface
+	RecoveryClient() RecoveryInterface
+}
+
+var (
+	_ BootstrapInterface   = &Bootstrap{}
+	_ GaleraStateInterface = &GaleraState{}
+	_ RecoveryInterface    = &Recovery{}
+	_ Interface            = &Client{}
+)
+
+func (c *Client) BootstrapClient() BootstrapInterface {
+	return c.Bootstrap
+}
+
+func (c *Client) GaleraStateClient() GaleraStateInterface {
+	return c.GaleraState
+}
+
+func (c *Client) RecoveryClient() RecoveryInterface {
+	return c.Recovery
+}
@@ -0,0 +1,167 @@
+// Package mock provides mock implementations of the client interfaces. Every method delegates to its
+// function field when set and returns zero values otherwise. Calls are counted to be asserted by tests.
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mariadb-operator/agent/pkg/client"
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+var (
+	_ client.BootstrapInterface   = &Bootstrap{}
+	_ client.GaleraStateInterface = &GaleraState{}
+	_ client.RecoveryInterface    = &Recovery{}
+	_ client.Interface            = &Client{}
+)
+
+type calls struct {
+	mux   sync.Mutex
+	calls map[string]int
+}
+
+func (c *calls) record(method string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	c.calls[method]++
+}
+
+// Calls returns the number of times a method has been called.
+func (c *calls) Calls(method string) int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.calls[method]
+}
+
+type Bootstrap struct {
+	calls
+	EnableFunc  func(ctx context.Context, bootstrap *galera.Bootstrap, opts ...client.MutationOption) error
+	DisableFunc func(ctx context.Context) error
+}
+
+func (b *Bootstrap) Enable(ctx context.Context, bootstrap *galera.Bootstrap, opts ...client.MutationOption) error {
+	b.record("Enable")
+	if b.EnableFunc != nil {
+		return b.EnableFunc(ctx, bootstrap, opts...)
+	}
+	return nil
+}
+
+func (b *Bootstrap) Disable(ctx context.Context) error {
+	b.record("Disable")
+	if b.DisableFunc != nil {
+		return b.DisableFunc(ctx)
+	}
+	return nil
+}
+
+type GaleraState struct {
+	calls
+	GetFunc      func(ctx context.Context) (*galera.GaleraState, error)
+	HistoryFunc  func(ctx context.Context) ([]galera.GaleraStateVersion, error)
+	RollbackFunc func(ctx context.Context, version int, opts ...client.MutationOption) (*galera.GaleraState, error)
+}
+
+func (g *GaleraState) Get(ctx context.Context) (*galera.GaleraState, error) {
+	g.record("Get")
+	if g.GetFunc != nil {
+		return g.GetFunc(ctx)
+	}
+	return &galera.GaleraState{}, nil
+}
+
+func (g *GaleraState) History(ctx context.Context) ([]galera.GaleraStateVersion, error) {
+	g.record("History")
+	if g.HistoryFunc != nil {
+		return g.HistoryFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (g *GaleraState) Rollback(ctx context.Context, version int, opts ...client.MutationOption) (*galera.GaleraState, error) {
+	g.record("Rollback")
+	if g.RollbackFunc != nil {
+		return g.RollbackFunc(ctx, version, opts...)
+	}
+	return &galera.GaleraState{}, nil
+}
+
+type Recovery struct {
+	calls
+	EnableFunc  func(ctx context.Context, opts ...client.MutationOption) error
+	StartFunc   func(ctx context.Context) (*galera.Bootstrap, error)
+	RunFunc     func(ctx context.Context) (*galera.Bootstrap, error)
+	ResultFunc  func(ctx context.Context) (*galera.RecoveryResult, error)
+	DisableFunc func(ctx context.Context) error
+}
+
+func (r *Recovery) Enable(ctx context.Context, opts ...client.MutationOption) error {
+	r.record("Enable")
+	if r.EnableFunc != nil {
+		return r.EnableFunc(ctx, opts...)
+	}
+	return nil
+}
+
+func (r *Recovery) Start(ctx context.Context) (*galera.Bootstrap, error) {
+	r.record("Start")
+	if r.StartFunc != nil {
+		return r.StartFunc(ctx)
+	}
+	return &galera.Bootstrap{}, nil
+}
+
+func (r *Recovery) Run(ctx context.Context) (*galera.Bootstrap, error) {
+	r.record("Run")
+	if r.RunFunc != nil {
+		return r.RunFunc(ctx)
+	}
+	return &galera.Bootstrap{}, nil
+}
+
+func (r *Recovery) Result(ctx context.Context) (*galera.RecoveryResult, error) {
+	r.record("Result")
+	if r.ResultFunc != nil {
+		return r.ResultFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (r *Recovery) Disable(ctx context.Context) error {
+	r.record("Disable")
+	if r.DisableFunc != nil {
+		return r.DisableFunc(ctx)
+	}
+	return nil
+}
+
+type Client struct {
+	Bootstrap   *Bootstrap
+	GaleraState *GaleraState
+	Recovery    *Recovery
+}
+
+func NewClient() *Client {
+	return &Client{
+		Bootstrap:   &Bootstrap{},
+		GaleraState: &GaleraState{},
+		Recovery:    &Recovery{},
+	}
+}
+
+func (c *Client) BootstrapClient() client.BootstrapInterface {
+	return c.Bootstrap
+}
+
+func (c *Client) GaleraStateClient() client.GaleraStateInterface {
+	return c.GaleraState
+}
+
+func (c *Client) RecoveryClient() client.RecoveryInterface {
+	return c.Recovery
+}
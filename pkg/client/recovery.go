@@ -11,11 +11,12 @@ type Recovery struct {
 	*Client
 }
 
-func (r *Recovery) Enable(ctx context.Context) error {
+func (r *Recovery) Enable(ctx context.Context, opts ...MutationOption) error {
 	req, err := r.newRequestWithContext(ctx, http.MethodPut, "/api/recovery", nil)
 	if err != nil {
 		return err
 	}
+	setMutationOptions(req, opts)
 	return r.do(req, nil)
 }
 
@@ -31,6 +32,35 @@ func (r *Recovery) Start(ctx context.Context) (*galera.Bootstrap, error) {
 	return &bootstrap, nil
 }
 
+// Run recovers the galera position by letting the agent run mariadbd with --wsrep-recover itself,
+// instead of enabling the recovery and restarting the pod. It cannot be forced, the agent refuses it with a
+// conflict error while mariadbd is running.
+func (r *Recovery) Run(ctx context.Context) (*galera.Bootstrap, error) {
+	req, err := r.newRequestWithContext(ctx, http.MethodPost, "/api/recovery/run", nil)
+	if err != nil {
+		return nil, err
+	}
+	var bootstrap galera.Bootstrap
+	if err := r.do(req, &bootstrap); err != nil {
+		return nil, err
+	}
+	return &bootstrap, nil
+}
+
+// Result returns the last position recovered by the agent. It returns a not found error when the node has not
+// been recovered or its galera state has changed since then.
+func (r *Recovery) Result(ctx context.Context) (*galera.RecoveryResult, error) {
+	req, err := r.newRequestWithContext(ctx, http.MethodGet, "/api/recovery/result", nil)
+	if err != nil {
+		return nil, err
+	}
+	var result galera.RecoveryResult
+	if err := r.do(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 func (r *Recovery) Disable(ctx context.Context) error {
 	req, err := r.newRequestWithContext(ctx, http.MethodDelete, "/api/recovery", nil)
 	if err != nil {
@@ -3,13 +3,19 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/requestid"
 )
 
 const (
@@ -52,20 +58,91 @@ func (c *Client) newRequestWithContext(ctx context.Context, method, path string,
 	return req, nil
 }
 
+// MutationOption configures the requests that mutate the galera state and config.
+type MutationOption func(*mutationOptions)
+
+type mutationOptions struct {
+	force bool
+}
+
+// WithForce performs the mutation even if the agent detects that mariadbd is running.
+func WithForce() MutationOption {
+	return func(o *mutationOptions) {
+		o.force = true
+	}
+}
+
+func setMutationOptions(r *http.Request, opts []MutationOption) {
+	var mutationOpts mutationOptions
+	for _, setOpt := range opts {
+		setOpt(&mutationOpts)
+	}
+	if mutationOpts.force {
+		query := r.URL.Query()
+		query.Set("force", "true")
+		r.URL.RawQuery = query.Encode()
+	}
+}
+
 func (c *Client) setHeaders(r *http.Request) error {
 	r.Header.Set("Content-Type", jsonMediaType)
 	r.Header.Set("Accept", jsonMediaType)
+	requestID := requestid.FromContext(r.Context())
+	if requestID == "" {
+		requestID = requestid.New()
+	}
+	r.Header.Set(requestid.Header, requestID)
 	for k, v := range c.headers {
 		r.Header.Set(k, v)
 	}
-	if c.kubernetesAuth && c.kubernetesSA != "" {
-		if err := kubernetesAuthHeader(r, c.kubernetesSA); err != nil {
-			return fmt.Errorf("error setting Kubernetes auth header: %v", err)
+	if c.tokenSource != nil {
+		token, err := c.tokenSource.Token(r.Context())
+		if err != nil {
+			return fmt.Errorf("error getting token: %v", err)
 		}
+		r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.Value))
 	}
 	return nil
 }
 
+// signHMAC signs the request when HMAC authentication is configured. It must be called right before sending
+// every attempt, after the query has been set, as the agent rejects nonces that have already been used.
+func (c *Client) signHMAC(r *http.Request) error {
+	if c.hmacKeyID == "" || len(c.hmacSecret) == 0 {
+		return nil
+	}
+	var body []byte
+	if r.GetBody != nil {
+		bodyReader, err := r.GetBody()
+		if err != nil {
+			return fmt.Errorf("error getting body: %v", err)
+		}
+		defer bodyReader.Close()
+		if body, err = io.ReadAll(bodyReader); err != nil {
+			return fmt.Errorf("error reading body: %v", err)
+		}
+	}
+	timestamp := time.Now().Unix()
+	nonce, err := newNonce()
+	if err != nil {
+		return fmt.Errorf("error generating nonce: %v", err)
+	}
+	r.Header.Set(authentication.HMACKeyIDHeader, c.hmacKeyID)
+	r.Header.Set(authentication.HMACTimestampHeader, strconv.FormatInt(timestamp, 10))
+	r.Header.Set(authentication.HMACNonceHeader, nonce)
+	r.Header.Set(authentication.HMACSignatureHeader, authentication.HMACSignature(
+		c.hmacSecret, r.Method, authentication.CanonicalRequestURI(r.URL), timestamp, nonce, body))
+	return nil
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func buildURL(baseUrl url.URL, path string) (*url.URL, error) {
 	baseUrl.Path = strings.TrimSuffix(baseUrl.Path, "/")
 	baseUrl.Path += path
@@ -76,12 +153,3 @@ func buildURL(baseUrl url.URL, path string) (*url.URL, error) {
 	}
 	return newUrl, nil
 }
-
-func kubernetesAuthHeader(r *http.Request, serviceAccountPath string) error {
-	bytes, err := os.ReadFile(serviceAccountPath)
-	if err != nil {
-		return fmt.Errorf("error setting Kubernetes auth header: error reading '%s': %v", serviceAccountPath, err)
-	}
-	r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", string(bytes)))
-	return nil
-}
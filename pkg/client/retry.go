@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type RetryPolicy struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of the backoff, between 0 and 1, that is randomized.
+	Jitter float64
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt))
+	if max := float64(p.MaxBackoff); p.MaxBackoff > 0 && backoff > max {
+		backoff = max
+	}
+	if p.Jitter > 0 {
+		backoff -= backoff * p.Jitter * rand.Float64() //nolint:gosec
+	}
+	return time.Duration(backoff)
+}
+
+type Attempt struct {
+	Method     string
+	URL        string
+	Attempt    int
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+	Retry      bool
+	Wait       time.Duration
+}
+
+type AttemptHook func(attempt *Attempt)
+
+func (c *Client) observeAttempt(req *http.Request, res *http.Response, err error, attempt int, duration, wait time.Duration,
+	retry bool) {
+	if len(c.attemptHooks) == 0 {
+		return
+	}
+	a := &Attempt{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Attempt:  attempt,
+		Err:      err,
+		Duration: duration,
+		Retry:    retry,
+		Wait:     wait,
+	}
+	if res != nil {
+		a.StatusCode = res.StatusCode
+	}
+	for _, hook := range c.attemptHooks {
+		hook(a)
+	}
+}
+
+func (c *Client) shouldRetry(req *http.Request, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	if req.Context().Err() != nil {
+		return 0, false
+	}
+	if res != nil && attempt < c.retryAfterMaxRetries {
+		if wait, ok := retryAfter(res, c.retryAfterMaxWait); ok {
+			return wait, true
+		}
+	}
+	if c.retryPolicy == nil || attempt >= c.retryPolicy.MaxRetries {
+		return 0, false
+	}
+	if err != nil {
+		if isConnectionError(err) || isIdempotent(req.Method) {
+			return c.retryPolicy.Backoff(attempt), true
+		}
+		return 0, false
+	}
+	if isRetryableStatus(res.StatusCode) && isIdempotent(req.Method) {
+		return c.retryPolicy.Backoff(attempt), true
+	}
+	return 0, false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// isConnectionError reports whether the request failed before reaching the server,
+// which makes it safe to retry regardless of the method.
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial"
+	}
+	return false
+}
+
+func isFailure(res *http.Response, err error) bool {
+	return err != nil || res.StatusCode >= http.StatusInternalServerError
+}
+
+func retryAfter(res *http.Response, maxWait time.Duration) (time.Duration, bool) {
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	header := res.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = time.Until(date)
+	} else {
+		return 0, false
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxWait {
+		return 0, false
+	}
+	return wait, true
+}
+
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("request body cannot be rewound")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	newReq := req.Clone(req.Context())
+	newReq.Body = body
+	return newReq, nil
+}
+
+func drainBody(res *http.Response) {
+	io.Copy(io.Discard, res.Body) //nolint:errcheck
+	res.Body.Close()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
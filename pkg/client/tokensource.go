@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/kubernetesauth"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type Token struct {
+	Value  string
+	Expiry time.Time
+}
+
+func (t *Token) Valid(now time.Time, refreshBefore time.Duration) bool {
+	if t == nil || t.Value == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || now.Add(refreshBefore).Before(t.Expiry)
+}
+
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+type staticTokenSource struct {
+	token *Token
+}
+
+func NewStaticTokenSource(token string) TokenSource {
+	return &staticTokenSource{
+		token: &Token{
+			Value: token,
+		},
+	}
+}
+
+func (s *staticTokenSource) Token(ctx context.Context) (*Token, error) {
+	return s.token, nil
+}
+
+type fileTokenSource struct {
+	path    string
+	mux     sync.Mutex
+	token   *Token
+	modTime time.Time
+}
+
+func NewFileTokenSource(path string) TokenSource {
+	return &fileTokenSource{
+		path: path,
+	}
+}
+
+func (f *fileTokenSource) Token(ctx context.Context) (*Token, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading '%s': %v", f.path, err)
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.token != nil && info.ModTime().Equal(f.modTime) {
+		return f.token, nil
+	}
+	bytes, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading '%s': %v", f.path, err)
+	}
+	value := strings.TrimSpace(string(bytes))
+	if value == "" {
+		return nil, fmt.Errorf("token file '%s' is empty", f.path)
+	}
+	// Tokens without expiry, like the legacy ServiceAccount tokens, are valid until the file is modified.
+	expiry, _ := authentication.TokenExpiry(value)
+	f.token = &Token{
+		Value:  value,
+		Expiry: expiry,
+	}
+	f.modTime = info.ModTime()
+	return f.token, nil
+}
+
+type tokenRequestTokenSource struct {
+	clientset         kubernetes.Interface
+	namespace         string
+	serviceAccount    string
+	audiences         []string
+	expirationSeconds int64
+}
+
+// NewTokenRequestTokenSource requests tokens for the given audiences, or for kubernetesauth.DefaultAudience when
+// none are provided, which is the audience accepted by default by the agent.
+func NewTokenRequestTokenSource(clientset kubernetes.Interface, namespace, serviceAccount string, audiences []string,
+	expiration time.Duration) TokenSource {
+	if len(audiences) == 0 {
+		audiences = []string{kubernetesauth.DefaultAudience}
+	}
+	return NewReuseTokenSource(
+		&tokenRequestTokenSource{
+			clientset:         clientset,
+			namespace:         namespace,
+			serviceAccount:    serviceAccount,
+			audiences:         audiences,
+			expirationSeconds: int64(expiration.Seconds()),
+		},
+		expiration/5,
+	)
+}
+
+func (t *tokenRequestTokenSource) Token(ctx context.Context) (*Token, error) {
+	tokenRequest := &authv1.TokenRequest{
+		Spec: authv1.TokenRequestSpec{
+			Audiences: t.audiences,
+		},
+	}
+	if t.expirationSeconds > 0 {
+		tokenRequest.Spec.ExpirationSeconds = &t.expirationSeconds
+	}
+	tokenRequestRes, err := t.clientset.CoreV1().ServiceAccounts(t.namespace).
+		CreateToken(ctx, t.serviceAccount, tokenRequest, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error creating token in TokenRequest API: %v", err)
+	}
+	if tokenRequestRes.Status.Token == "" {
+		return nil, errors.New("empty token returned by TokenRequest API")
+	}
+	return &Token{
+		Value:  tokenRequestRes.Status.Token,
+		Expiry: tokenRequestRes.Status.ExpirationTimestamp.Time,
+	}, nil
+}
+
+type reuseTokenSource struct {
+	source        TokenSource
+	refreshBefore time.Duration
+	now           func() time.Time
+	mux           sync.Mutex
+	token         *Token
+}
+
+func NewReuseTokenSource(source TokenSource, refreshBefore time.Duration) TokenSource {
+	return &reuseTokenSource{
+		source:        source,
+		refreshBefore: refreshBefore,
+		now:           time.Now,
+	}
+}
+
+func (r *reuseTokenSource) Token(ctx context.Context) (*Token, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.token.Valid(r.now(), r.refreshBefore) {
+		return r.token, nil
+	}
+	token, err := r.source.Token(ctx)
+	if err != nil {
+		if r.token.Valid(r.now(), 0) {
+			return r.token, nil
+		}
+		return nil, err
+	}
+	r.token = token
+	return token, nil
+}
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/kubernetesauth"
+	authv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type fakeTokenSource struct {
+	tokens []*Token
+	err    error
+	calls  int
+}
+
+func (f *fakeTokenSource) Token(ctx context.Context) (*Token, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	token := f.tokens[0]
+	if len(f.tokens) > 1 {
+		f.tokens = f.tokens[1:]
+	}
+	return token, nil
+}
+
+func TestStaticTokenSource(t *testing.T) {
+	token, err := NewStaticTokenSource("static").Token(context.Background())
+	if err != nil {
+		t.Fatalf("error getting token: %v", err)
+	}
+	if token.Value != "static" || !token.Expiry.IsZero() {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+	if !token.Valid(time.Now(), time.Hour) {
+		t.Fatal("expected token without expiry to be valid")
+	}
+}
+
+func TestFileTokenSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeToken := func(value string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+			t.Fatalf("error writing token: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("error changing token times: %v", err)
+		}
+	}
+	source := NewFileTokenSource(path)
+	ctx := context.Background()
+
+	if _, err := source.Token(ctx); err == nil {
+		t.Fatal("expected error when the token file does not exist")
+	}
+
+	modTime := time.Now().Add(-time.Hour)
+	writeToken("first\n", modTime)
+	token, err := source.Token(ctx)
+	if err != nil {
+		t.Fatalf("error getting token: %v", err)
+	}
+	if token.Value != "first" {
+		t.Fatalf("unexpected token: expected first, got %s", token.Value)
+	}
+
+	writeToken("second", modTime.Add(time.Minute))
+	token, err = source.Token(ctx)
+	if err != nil {
+		t.Fatalf("error getting token: %v", err)
+	}
+	if token.Value != "second" {
+		t.Fatalf("expected token to be reloaded after file change, got %s", token.Value)
+	}
+
+	writeToken("", modTime.Add(2*time.Minute))
+	if _, err := source.Token(ctx); err == nil {
+		t.Fatal("expected error when the token file is empty")
+	}
+}
+
+func TestTokenRequestTokenSource(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	clientset := fake.NewSimpleClientset()
+	var tokenRequests []*authv1.TokenRequest
+	clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		createAction := action.(k8stesting.CreateAction)
+		if createAction.GetSubresource() != "token" {
+			return false, nil, nil
+		}
+		tokenRequest := createAction.GetObject().(*authv1.TokenRequest)
+		tokenRequests = append(tokenRequests, tokenRequest)
+		if tokenRequest.Spec.Audiences[0] == "failing" {
+			return true, nil, errors.New("failing")
+		}
+		res := tokenRequest.DeepCopy()
+		res.Status = authv1.TokenRequestStatus{
+			Token:               "token",
+			ExpirationTimestamp: metav1.NewTime(expiry),
+		}
+		return true, res, nil
+	})
+
+	tests := []struct {
+		name          string
+		audiences     []string
+		wantAudiences []string
+		wantErr       bool
+	}{
+		{
+			name:          "default audience",
+			audiences:     nil,
+			wantAudiences: []string{kubernetesauth.DefaultAudience},
+			wantErr:       false,
+		},
+		{
+			name:          "audiences",
+			audiences:     []string{"foo", "bar"},
+			wantAudiences: []string{"foo", "bar"},
+			wantErr:       false,
+		},
+		{
+			name:          "error",
+			audiences:     []string{"failing"},
+			wantAudiences: []string{"failing"},
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenRequests = nil
+			source := NewTokenRequestTokenSource(clientset, "default", "mariadb", tt.audiences, time.Hour)
+
+			token, err := source.Token(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("error expected, got nil")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("error unexpected, got %v", err)
+				}
+				if token.Value != "token" || !token.Expiry.Equal(expiry) {
+					t.Fatalf("unexpected token: %+v", token)
+				}
+			}
+			if len(tokenRequests) != 1 {
+				t.Fatalf("unexpected TokenRequests: expected 1, got %d", len(tokenRequests))
+			}
+			if !reflect.DeepEqual(tokenRequests[0].Spec.Audiences, tt.wantAudiences) {
+				t.Fatalf("unexpected audiences: expected %v, got %v", tt.wantAudiences, tokenRequests[0].Spec.Audiences)
+			}
+			if seconds := tokenRequests[0].Spec.ExpirationSeconds; seconds == nil || *seconds != 3600 {
+				t.Fatalf("unexpected expiration seconds: %v", seconds)
+			}
+		})
+	}
+}
+
+func TestReuseTokenSource(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		current   *Token
+		source    *fakeTokenSource
+		wantToken string
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "no token",
+			current:   nil,
+			source:    &fakeTokenSource{tokens: []*Token{{Value: "new", Expiry: now.Add(time.Hour)}}},
+			wantToken: "new",
+			wantCalls: 1,
+			wantErr:   false,
+		},
+		{
+			name:      "valid token",
+			current:   &Token{Value: "current", Expiry: now.Add(time.Hour)},
+			source:    &fakeTokenSource{tokens: []*Token{{Value: "new", Expiry: now.Add(time.Hour)}}},
+			wantToken: "current",
+			wantCalls: 0,
+			wantErr:   false,
+		},
+		{
+			name:      "token without expiry",
+			current:   &Token{Value: "current"},
+			source:    &fakeTokenSource{tokens: []*Token{{Value: "new"}}},
+			wantToken: "current",
+			wantCalls: 0,
+			wantErr:   false,
+		},
+		{
+			name:      "refresh before expiry",
+			current:   &Token{Value: "current", Expiry: now.Add(time.Minute)},
+			source:    &fakeTokenSource{tokens: []*Token{{Value: "new", Expiry: now.Add(time.Hour)}}},
+			wantToken: "new",
+			wantCalls: 1,
+			wantErr:   false,
+		},
+		{
+			name:      "refresh error with valid token",
+			current:   &Token{Value: "current", Expiry: now.Add(time.Minute)},
+			source:    &fakeTokenSource{err: errors.New("refresh error")},
+			wantToken: "current",
+			wantCalls: 1,
+			wantErr:   false,
+		},
+		{
+			name:      "refresh error with expired token",
+			current:   &Token{Value: "current", Expiry: now.Add(-time.Minute)},
+			source:    &fakeTokenSource{err: errors.New("refresh error")},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewReuseTokenSource(tt.source, 5*time.Minute).(*reuseTokenSource)
+			source.now = func() time.Time { return now }
+			source.token = tt.current
+
+			token, err := source.Token(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("error expected, got nil")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("error unexpected, got %v", err)
+				}
+				if token.Value != tt.wantToken {
+					t.Fatalf("unexpected token: expected %s, got %s", tt.wantToken, token.Value)
+				}
+			}
+			if tt.source.calls != tt.wantCalls {
+				t.Fatalf("unexpected calls to the source: expected %d, got %d", tt.wantCalls, tt.source.calls)
+			}
+		})
+	}
+}
@@ -3,7 +3,8 @@ package errors
 import "fmt"
 
 type APIError struct {
-	Message string `json:"message"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 func (e *APIError) Error() string {
@@ -23,8 +24,9 @@ func NewAPIErrorf(format string, a ...any) error {
 }
 
 type Error struct {
-	HTTPCode int
-	Message  string
+	HTTPCode  int
+	Message   string
+	RequestID string
 }
 
 func (e *Error) Error() string {
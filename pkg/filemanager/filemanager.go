@@ -1,56 +1,160 @@
 package filemanager
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+
+	"github.com/mariadb-operator/agent/pkg/filesystem"
 )
 
 const (
-	writeFileMode = fs.FileMode(0777)
+	defaultFileMode = fs.FileMode(0644)
+	// tempFilePattern matches the temporary files created by writeFile.
+	tempFilePattern = ".*.tmp-*"
 )
 
+type Option func(*FileManager)
+
+// WithFileMode sets the mode of the written files. By default, the mode of the file being replaced is kept,
+// and new files are created with 0644.
+func WithFileMode(mode fs.FileMode) Option {
+	return func(f *FileManager) {
+		f.fileMode = &mode
+	}
+}
+
+// WithFileOwner sets the owner of the written files. A negative uid or gid keeps the one of the file being replaced,
+// or the one of the agent process for new files.
+func WithFileOwner(uid, gid int) Option {
+	return func(f *FileManager) {
+		f.uid = uid
+		f.gid = gid
+	}
+}
+
+// WithFS sets the filesystem where the files are managed. It defaults to the local disk.
+func WithFS(fsys filesystem.FS) Option {
+	return func(f *FileManager) {
+		f.fsys = fsys
+	}
+}
+
 type FileManager struct {
+	fsys      filesystem.FS
 	configDir string
 	stateDir  string
+	fileMode  *fs.FileMode
+	uid       int
+	gid       int
+
+	historyDir  string
+	historySize int
 }
 
-func NewFileManager(configDir, stateDir string) (*FileManager, error) {
-	if _, err := os.Stat(configDir); err != nil {
+func NewFileManager(configDir, stateDir string, opts ...Option) (*FileManager, error) {
+	fileManager := &FileManager{
+		fsys:      filesystem.NewOS(),
+		configDir: configDir,
+		stateDir:  stateDir,
+		uid:       -1,
+		gid:       -1,
+	}
+	for _, setOpt := range opts {
+		setOpt(fileManager)
+	}
+	if _, err := fileManager.fsys.Stat(configDir); err != nil {
 		return nil, fmt.Errorf("error reading config directory: %v", err)
 	}
-	if _, err := os.Stat(stateDir); err != nil {
+	if _, err := fileManager.fsys.Stat(stateDir); err != nil {
 		return nil, fmt.Errorf("error reading state directory: %v", err)
 	}
-	return &FileManager{
-		configDir: configDir,
-		stateDir:  stateDir,
-	}, nil
+	if err := fileManager.removeTempFiles(); err != nil {
+		return nil, fmt.Errorf("error removing temporary files: %v", err)
+	}
+	return fileManager, nil
+}
+
+// removeTempFiles removes the temporary files left behind by writes interrupted by a crash.
+func (f *FileManager) removeTempFiles() error {
+	dirs := []string{f.configDir, f.stateDir}
+	if f.historyEnabled() {
+		entries, err := f.fsys.ReadDir(f.historyDir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, filepath.Join(f.historyDir, entry.Name()))
+			}
+		}
+	}
+	for _, dir := range dirs {
+		entries, err := f.fsys.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if match, _ := filepath.Match(tempFilePattern, entry.Name()); !match || entry.IsDir() {
+				continue
+			}
+			if err := f.fsys.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FS returns the filesystem where the config and state files are managed.
+func (f *FileManager) FS() filesystem.FS {
+	return f.fsys
 }
 
 func (f *FileManager) WriteStateFile(name string, bytes []byte) error {
-	return os.WriteFile(filepath.Join(f.stateDir, name), bytes, writeFileMode)
+	return f.writeFile(f.stateDir, name, bytes)
 }
 
 func (f *FileManager) ReadStateFile(name string) ([]byte, error) {
-	return os.ReadFile(filepath.Join(f.stateDir, name))
+	return f.readFile(f.stateDir, name)
+}
+
+func (f *FileManager) StatStateFile(name string) (fs.FileInfo, error) {
+	return f.fsys.Stat(filepath.Join(f.stateDir, name))
+}
+
+// ReadStateFileFrom reads a state file from offset until the end, to read files that are being appended incrementally.
+func (f *FileManager) ReadStateFileFrom(name string, offset int64) ([]byte, error) {
+	return f.fsys.ReadFileFrom(filepath.Join(f.stateDir, name), offset)
+}
+
+// WatchStateFile notifies when a state file is created or written. It returns filesystem.ErrWatchNotSupported
+// when the filesystem cannot be watched, callers are expected to fall back to polling.
+func (f *FileManager) WatchStateFile(ctx context.Context, name string) (<-chan struct{}, error) {
+	watcher, ok := f.fsys.(filesystem.Watcher)
+	if !ok {
+		return nil, filesystem.ErrWatchNotSupported
+	}
+	return watcher.Watch(ctx, filepath.Join(f.stateDir, name))
 }
 
 func (f *FileManager) DeleteStateFile(name string) error {
-	return os.Remove(filepath.Join(f.stateDir, name))
+	return f.deleteFile(f.stateDir, name)
 }
 
 func (f *FileManager) WriteConfigFile(name string, bytes []byte) error {
-	return os.WriteFile(filepath.Join(f.configDir, name), bytes, writeFileMode)
+	return f.writeFile(f.configDir, name, bytes)
 }
 
 func (f *FileManager) DeleteConfigFile(name string) error {
-	return os.Remove(filepath.Join(f.configDir, name))
+	return f.deleteFile(f.configDir, name)
 }
 
 func (f *FileManager) ConfigFileExists(name string) (bool, error) {
-	if _, err := os.Stat(filepath.Join(f.configDir, name)); err != nil {
+	if _, err := f.fsys.Stat(filepath.Join(f.configDir, name)); err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
 		}
@@ -58,3 +162,107 @@ func (f *FileManager) ConfigFileExists(name string) (bool, error) {
 	}
 	return true, nil
 }
+
+// writeFile atomically replaces a file: the content is written and synced to a temporary file in the same
+// directory, which is then renamed and the directory synced. A crash leaves either the old or the new file,
+// never a truncated one.
+func (f *FileManager) writeFile(dir, name string, bytes []byte) error {
+	mode, uid, gid, err := f.fileAttributes(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	return f.writeFileWith(dir, name, bytes, mode, uid, gid)
+}
+
+// writeFileWith atomically replaces a file with the given mode and owner, see writeFile.
+func (f *FileManager) writeFileWith(dir, name string, bytes []byte, mode fs.FileMode, uid, gid int) (err error) {
+	tmp, err := f.fsys.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			f.fsys.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(bytes); err != nil {
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("error setting file mode: %w", err)
+	}
+	if uid >= 0 || gid >= 0 {
+		// Only root can give away files, so the owner copied from the previous file is kept on a best effort basis
+		// when the agent runs as another user. A configured owner must be honored.
+		if err := tmp.Chown(uid, gid); err != nil && (!errors.Is(err, fs.ErrPermission) || f.ownerConfigured()) {
+			return fmt.Errorf("error setting file owner: %w", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("error syncing temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing temporary file: %w", err)
+	}
+	if err := f.fsys.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("error renaming temporary file: %w", err)
+	}
+	return f.syncDir(dir)
+}
+
+// fileAttributes returns the mode and owner to write a file with. The renamed temporary file replaces the inode
+// of the previous file, so its mode and owner are copied unless they are configured. Otherwise, a grastate.dat
+// owned by mariadbd would end up owned by the agent, and mariadbd could not rewrite it.
+// A negative uid or gid means that the one of the agent process is kept.
+func (f *FileManager) fileAttributes(path string) (mode fs.FileMode, uid, gid int, err error) {
+	mode, uid, gid = defaultFileMode, -1, -1
+	info, err := f.fsys.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, 0, fmt.Errorf("error getting file info: %w", err)
+	}
+	if err == nil {
+		mode = info.Mode().Perm()
+		if fileUID, fileGID, ok := filesystem.Owner(info); ok {
+			if fileUID != os.Geteuid() {
+				uid = fileUID
+			}
+			if fileGID != os.Getegid() {
+				gid = fileGID
+			}
+		}
+	}
+	if f.fileMode != nil {
+		mode = *f.fileMode
+	}
+	if f.uid >= 0 {
+		uid = f.uid
+	}
+	if f.gid >= 0 {
+		gid = f.gid
+	}
+	return mode, uid, gid, nil
+}
+
+func (f *FileManager) ownerConfigured() bool {
+	return f.uid >= 0 || f.gid >= 0
+}
+
+func (f *FileManager) readFile(dir, name string) ([]byte, error) {
+	return f.fsys.ReadFile(filepath.Join(dir, name))
+}
+
+func (f *FileManager) deleteFile(dir, name string) error {
+	if err := f.fsys.Remove(filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	return f.syncDir(dir)
+}
+
+func (f *FileManager) syncDir(dir string) error {
+	if err := f.fsys.SyncDir(dir); err != nil {
+		return fmt.Errorf("error syncing directory: %w", err)
+	}
+	return nil
+}
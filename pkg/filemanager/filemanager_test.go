@@ -0,0 +1,505 @@
+package filemanager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+)
+
+func TestFileManagerWriteFile(t *testing.T) {
+	configDir := t.TempDir()
+	stateDir := t.TempDir()
+	fileManager, err := NewFileManager(configDir, stateDir, WithFileMode(0640))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+
+	if err := fileManager.WriteStateFile("grastate.dat", []byte("seqno: 1")); err != nil {
+		t.Fatalf("error writing state file: %v", err)
+	}
+	if err := fileManager.WriteStateFile("grastate.dat", []byte("seqno: 2")); err != nil {
+		t.Fatalf("error overwriting state file: %v", err)
+	}
+	bytes, err := fileManager.ReadStateFile("grastate.dat")
+	if err != nil {
+		t.Fatalf("error reading state file: %v", err)
+	}
+	if string(bytes) != "seqno: 2" {
+		t.Fatalf("unexpected state file content: %s", bytes)
+	}
+
+	entries, err := os.ReadDir(stateDir)
+	if err != nil {
+		t.Fatalf("error reading state dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temporary files to be renamed, got %v", entries)
+	}
+	info, err := entries[0].Info()
+	if err != nil {
+		t.Fatalf("error getting file info: %v", err)
+	}
+	if info.Mode().Perm() != fs.FileMode(0640) {
+		t.Fatalf("unexpected file mode: expected %v, got %v", fs.FileMode(0640), info.Mode().Perm())
+	}
+
+	if err := fileManager.DeleteStateFile("grastate.dat"); err != nil {
+		t.Fatalf("error deleting state file: %v", err)
+	}
+	if err := fileManager.DeleteStateFile("grastate.dat"); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+}
+
+func TestFileManagerFileAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		existing bool
+		wantMode fs.FileMode
+		wantUID  int
+		wantGID  int
+	}{
+		{
+			name:     "new file",
+			existing: false,
+			wantMode: 0644,
+			wantUID:  os.Geteuid(),
+			wantGID:  os.Getegid(),
+		},
+		{
+			name:     "keep existing",
+			existing: true,
+			wantMode: 0660,
+			wantUID:  999,
+			wantGID:  998,
+		},
+		{
+			name:     "override existing",
+			opts:     []Option{WithFileMode(0640), WithFileOwner(1000, -1)},
+			existing: true,
+			wantMode: 0640,
+			wantUID:  1000,
+			wantGID:  998,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := filesystem.NewMemory()
+			if err := memory.MkdirAll("/state", 0755); err != nil {
+				t.Fatalf("error creating directory: %v", err)
+			}
+			if tt.existing {
+				// grastate.dat written by mariadbd, running as a different user than the agent.
+				file, err := memory.CreateTemp("/state", "mariadbd-*")
+				if err != nil {
+					t.Fatalf("error creating file: %v", err)
+				}
+				if err := file.Chmod(0660); err != nil {
+					t.Fatalf("error setting file mode: %v", err)
+				}
+				if err := file.Chown(999, 998); err != nil {
+					t.Fatalf("error setting file owner: %v", err)
+				}
+				if err := file.Close(); err != nil {
+					t.Fatalf("error closing file: %v", err)
+				}
+				if err := memory.Rename(file.Name(), "/state/grastate.dat"); err != nil {
+					t.Fatalf("error renaming file: %v", err)
+				}
+			}
+			fileManager, err := NewFileManager("/", "/state", append([]Option{WithFS(memory)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("error creating file manager: %v", err)
+			}
+			if err := fileManager.WriteStateFile("grastate.dat", []byte("seqno: 1")); err != nil {
+				t.Fatalf("error writing state file: %v", err)
+			}
+
+			info, err := memory.Stat("/state/grastate.dat")
+			if err != nil {
+				t.Fatalf("error getting file info: %v", err)
+			}
+			if info.Mode().Perm() != tt.wantMode {
+				t.Fatalf("unexpected file mode: expected %v, got %v", tt.wantMode, info.Mode().Perm())
+			}
+			uid, gid, ok := filesystem.Owner(info)
+			if !ok || uid != tt.wantUID || gid != tt.wantGID {
+				t.Fatalf("unexpected file owner: expected %d:%d, got %d:%d", tt.wantUID, tt.wantGID, uid, gid)
+			}
+		})
+	}
+}
+
+func TestFileManagerChownPermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			name:    "copied owner",
+			opts:    nil,
+			wantErr: false,
+		},
+		{
+			name:    "configured owner",
+			opts:    []Option{WithFileOwner(1000, 1000)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := filesystem.NewMemory()
+			if err := memory.MkdirAll("/state", 0755); err != nil {
+				t.Fatalf("error creating directory: %v", err)
+			}
+			file, err := memory.CreateTemp("/state", "mariadbd-*")
+			if err != nil {
+				t.Fatalf("error creating file: %v", err)
+			}
+			if err := file.Chown(999, 998); err != nil {
+				t.Fatalf("error setting file owner: %v", err)
+			}
+			if err := file.Close(); err != nil {
+				t.Fatalf("error closing file: %v", err)
+			}
+			if err := memory.Rename(file.Name(), "/state/grastate.dat"); err != nil {
+				t.Fatalf("error renaming file: %v", err)
+			}
+			// The agent is not allowed to give away files when it does not run as root.
+			faulty := filesystem.NewFaulty(memory)
+			faulty.Inject(filesystem.Fault{
+				Op:  filesystem.OpChown,
+				Err: syscall.EPERM,
+			})
+			fileManager, err := NewFileManager("/", "/state", append([]Option{WithFS(faulty)}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("error creating file manager: %v", err)
+			}
+
+			err = fileManager.WriteStateFile("grastate.dat", []byte("seqno: 1"))
+			if tt.wantErr {
+				if !errors.Is(err, syscall.EPERM) {
+					t.Fatalf("expected EPERM error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error writing state file: %v", err)
+			}
+			bytes, err := fileManager.ReadStateFile("grastate.dat")
+			if err != nil {
+				t.Fatalf("error reading state file: %v", err)
+			}
+			if string(bytes) != "seqno: 1" {
+				t.Fatalf("unexpected state file content: %s", bytes)
+			}
+		})
+	}
+}
+
+func TestFileManagerRemoveTempFiles(t *testing.T) {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{"/config", "/state", "/state/.history/grastate.dat"} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	for _, path := range []string{
+		"/config/.2-recovery.cnf.tmp-123",
+		"/state/.grastate.dat.tmp-456",
+		"/state/.history/grastate.dat/.1.json.tmp-789",
+		"/state/grastate.dat",
+		"/state/.agent-transaction.json",
+	} {
+		if err := memory.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	if _, err := NewFileManager("/config", "/state", WithFS(memory), WithStateFileHistory("/state/.history", 2)); err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	for path, wantExists := range map[string]bool{
+		"/config/.2-recovery.cnf.tmp-123":              false,
+		"/state/.grastate.dat.tmp-456":                 false,
+		"/state/.history/grastate.dat/.1.json.tmp-789": false,
+		"/state/grastate.dat":                          true,
+		"/state/.agent-transaction.json":               true,
+	} {
+		if _, err := memory.Stat(path); (err == nil) != wantExists {
+			t.Fatalf("unexpected %s existence: expected %v, got error %v", path, wantExists, err)
+		}
+	}
+}
+
+func TestFileManagerStateFileHistory(t *testing.T) {
+	stateDir := t.TempDir()
+	fileManager, err := NewFileManager(t.TempDir(), stateDir, WithStateFileHistory(filepath.Join(stateDir, ".history"), 2))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+
+	if err := fileManager.ArchiveStateFile("grastate.dat", "operator", "enable bootstrap"); err != nil {
+		t.Fatalf("error archiving missing state file: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := fileManager.WriteStateFile("grastate.dat", []byte(fmt.Sprintf("seqno: %d", i))); err != nil {
+			t.Fatalf("error writing state file: %v", err)
+		}
+		if err := fileManager.ArchiveStateFile("grastate.dat", "operator", "enable bootstrap"); err != nil {
+			t.Fatalf("error archiving state file: %v", err)
+		}
+	}
+
+	history, err := fileManager.StateFileHistory("grastate.dat")
+	if err != nil {
+		t.Fatalf("error getting history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("unexpected number of versions: expected 2, got %d", len(history))
+	}
+	if history[0].Version != 3 || history[0].Content != "seqno: 3" || history[0].Caller != "operator" {
+		t.Fatalf("unexpected latest version: %+v", history[0])
+	}
+	if history[1].Version != 2 || history[1].Content != "seqno: 2" {
+		t.Fatalf("unexpected oldest version: %+v", history[1])
+	}
+	if _, err := fileManager.StateFileVersion("grastate.dat", 1); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("expected pruned version to be not found, got %v", err)
+	}
+}
+
+func TestFileManagerVolumeFull(t *testing.T) {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{"/config", "/state"} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	faulty := filesystem.NewFaulty(memory)
+	fileManager, err := NewFileManager("/config", "/state", WithFS(faulty))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	if err := fileManager.WriteStateFile("grastate.dat", []byte("seqno: 1")); err != nil {
+		t.Fatalf("error writing state file: %v", err)
+	}
+
+	faulty.Inject(filesystem.Fault{
+		Op:  filesystem.OpWrite,
+		Err: syscall.ENOSPC,
+	})
+	if err := fileManager.WriteStateFile("grastate.dat", []byte("seqno: 2")); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected ENOSPC error, got %v", err)
+	}
+	bytes, err := fileManager.ReadStateFile("grastate.dat")
+	if err != nil {
+		t.Fatalf("error reading state file: %v", err)
+	}
+	if string(bytes) != "seqno: 1" {
+		t.Fatalf("expected state file to be preserved, got: %s", bytes)
+	}
+	entries, err := memory.ReadDir("/state")
+	if err != nil {
+		t.Fatalf("error reading state dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temporary files to be removed, got %v", entries)
+	}
+}
+
+func newTransactionFileManager(t *testing.T) (*FileManager, *filesystem.Faulty) {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{"/config", "/state"} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	faulty := filesystem.NewFaulty(memory)
+	fileManager, err := NewFileManager("/config", "/state", WithFS(faulty))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	if err := fileManager.WriteStateFile("grastate.dat", []byte("safe_to_bootstrap: 0")); err != nil {
+		t.Fatalf("error writing state file: %v", err)
+	}
+	if err := fileManager.WriteConfigFile("2-recovery.cnf", []byte("[galera]")); err != nil {
+		t.Fatalf("error writing config file: %v", err)
+	}
+	return fileManager, faulty
+}
+
+func assertFiles(t *testing.T, fileManager *FileManager, wantGaleraState string, wantRecovery, wantBootstrap bool) {
+	bytes, err := fileManager.ReadStateFile("grastate.dat")
+	if err != nil {
+		t.Fatalf("error reading state file: %v", err)
+	}
+	if string(bytes) != wantGaleraState {
+		t.Fatalf("unexpected state file content: expected %q, got %q", wantGaleraState, bytes)
+	}
+	for name, want := range map[string]bool{"2-recovery.cnf": wantRecovery, "1-bootstrap.cnf": wantBootstrap} {
+		exists, err := fileManager.ConfigFileExists(name)
+		if err != nil {
+			t.Fatalf("error checking config file: %v", err)
+		}
+		if exists != want {
+			t.Fatalf("unexpected %s existence: expected %v, got %v", name, want, exists)
+		}
+	}
+	if _, err := fileManager.ReadStateFile(transactionJournalName); !os.IsNotExist(err) {
+		t.Fatalf("expected journal to be deleted, got %v", err)
+	}
+}
+
+func bootstrapTransaction(fileManager *FileManager) *Transaction {
+	tx := fileManager.Begin()
+	tx.DeleteConfigFile("2-recovery.cnf")
+	tx.WriteStateFile("grastate.dat", []byte("safe_to_bootstrap: 1"))
+	tx.WriteConfigFile("1-bootstrap.cnf", []byte("[galera]"))
+	return tx
+}
+
+func TestTransaction(t *testing.T) {
+	fileManager, _ := newTransactionFileManager(t)
+	if err := bootstrapTransaction(fileManager).Commit(); err != nil {
+		t.Fatalf("error committing transaction: %v", err)
+	}
+	assertFiles(t, fileManager, "safe_to_bootstrap: 1", false, true)
+}
+
+func TestTransactionRollback(t *testing.T) {
+	fileManager, faulty := newTransactionFileManager(t)
+	// The recovery config is deleted by the transaction, so its mode and owner are restored from the journal.
+	file, err := faulty.CreateTemp("/config", "recovery-*")
+	if err != nil {
+		t.Fatalf("error creating file: %v", err)
+	}
+	if _, err := file.Write([]byte("[galera]")); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	if err := file.Chmod(0640); err != nil {
+		t.Fatalf("error setting file mode: %v", err)
+	}
+	if err := file.Chown(999, 998); err != nil {
+		t.Fatalf("error setting file owner: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("error closing file: %v", err)
+	}
+	if err := faulty.Rename(file.Name(), "/config/2-recovery.cnf"); err != nil {
+		t.Fatalf("error renaming file: %v", err)
+	}
+
+	faulty.Inject(filesystem.Fault{
+		Op:    filesystem.OpWrite,
+		Path:  "/config/*",
+		Err:   syscall.ENOSPC,
+		Count: 1,
+	})
+	if err := bootstrapTransaction(fileManager).Commit(); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected ENOSPC error, got %v", err)
+	}
+	assertFiles(t, fileManager, "safe_to_bootstrap: 0", true, false)
+
+	info, err := faulty.Stat("/config/2-recovery.cnf")
+	if err != nil {
+		t.Fatalf("error getting file info: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("unexpected file mode: expected %v, got %v", fs.FileMode(0640), info.Mode().Perm())
+	}
+	if uid, gid, ok := filesystem.Owner(info); !ok || uid != 999 || gid != 998 {
+		t.Fatalf("unexpected file owner: expected 999:998, got %d:%d", uid, gid)
+	}
+}
+
+func TestTransactionArchiveRollback(t *testing.T) {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{"/config", "/state"} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	faulty := filesystem.NewFaulty(memory)
+	fileManager, err := NewFileManager("/config", "/state", WithFS(faulty), WithStateFileHistory("/state/.history", 1))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	if err := fileManager.WriteStateFile("grastate.dat", []byte("safe_to_bootstrap: 0")); err != nil {
+		t.Fatalf("error writing state file: %v", err)
+	}
+	if err := fileManager.ArchiveStateFile("grastate.dat", "operator", "enable bootstrap"); err != nil {
+		t.Fatalf("error archiving state file: %v", err)
+	}
+
+	faulty.Inject(filesystem.Fault{
+		Op:    filesystem.OpWrite,
+		Path:  "/config/*",
+		Err:   syscall.ENOSPC,
+		Count: 1,
+	})
+	tx := fileManager.Begin()
+	tx.ArchiveStateFile("grastate.dat", "operator", "enable bootstrap")
+	tx.WriteStateFile("grastate.dat", []byte("safe_to_bootstrap: 1"))
+	tx.WriteConfigFile("1-bootstrap.cnf", []byte("[galera]"))
+	if err := tx.Commit(); !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected ENOSPC error, got %v", err)
+	}
+	assertFiles(t, fileManager, "safe_to_bootstrap: 0", false, false)
+
+	history, err := fileManager.StateFileHistory("grastate.dat")
+	if err != nil {
+		t.Fatalf("error getting history: %v", err)
+	}
+	if len(history) != 1 || history[0].Version != 1 {
+		t.Fatalf("expected the pruned version to be restored and the new one removed, got %+v", history)
+	}
+}
+
+func TestTransactionRecover(t *testing.T) {
+	fileManager, faulty := newTransactionFileManager(t)
+	// The rollback fails as well, leaving the changes half applied as if the agent had crashed.
+	faulty.Inject(filesystem.Fault{
+		Op:   filesystem.OpWrite,
+		Path: "/config/*",
+		Err:  syscall.ENOSPC,
+	})
+	if err := bootstrapTransaction(fileManager).Commit(); err == nil {
+		t.Fatal("expected error committing transaction")
+	}
+	if _, err := fileManager.ReadStateFile(transactionJournalName); err != nil {
+		t.Fatalf("expected journal to be kept, got %v", err)
+	}
+	if err := bootstrapTransaction(fileManager).Commit(); !errors.Is(err, ErrTransactionPending) {
+		t.Fatalf("expected pending transaction error, got %v", err)
+	}
+
+	faulty.Reset()
+	fileManager, err := NewFileManager("/config", "/state", WithFS(faulty))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	recovered, err := fileManager.RecoverTransaction()
+	if err != nil {
+		t.Fatalf("error recovering transaction: %v", err)
+	}
+	if !recovered {
+		t.Fatal("expected transaction to be recovered")
+	}
+	assertFiles(t, fileManager, "safe_to_bootstrap: 0", true, false)
+
+	recovered, err = fileManager.RecoverTransaction()
+	if err != nil || recovered {
+		t.Fatalf("expected no transaction to recover, got %v, %v", recovered, err)
+	}
+}
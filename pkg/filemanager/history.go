@@ -0,0 +1,164 @@
+package filemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historyFileSuffix = ".json"
+)
+
+var (
+	ErrHistoryDisabled = errors.New("state file history disabled")
+	ErrVersionNotFound = errors.New("state file version not found")
+)
+
+// StateFileVersion is a previous content of a state file, recorded before it was overwritten.
+type StateFileVersion struct {
+	Version   int       `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	Caller    string    `json:"caller,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Content   string    `json:"content"`
+}
+
+// WithStateFileHistory keeps the last size versions of the archived state files in dir.
+func WithStateFileHistory(dir string, size int) Option {
+	return func(f *FileManager) {
+		f.historyDir = dir
+		f.historySize = size
+	}
+}
+
+func (f *FileManager) historyEnabled() bool {
+	return f.historyDir != "" && f.historySize > 0
+}
+
+// ArchiveStateFile records the current content of a state file as a new version, pruning the oldest versions.
+// It is a no-op when the history is disabled or the state file does not exist. See Transaction.ArchiveStateFile
+// to archive it along with other changes.
+func (f *FileManager) ArchiveStateFile(name, caller, reason string) error {
+	tx := f.Begin()
+	tx.ArchiveStateFile(name, caller, reason)
+	return tx.Commit()
+}
+
+// archiveOps returns the changes to the history needed to archive the current content of a state file.
+func (f *FileManager) archiveOps(name, caller, reason string) ([]transactionOp, error) {
+	if !f.historyEnabled() {
+		return nil, nil
+	}
+	bytes, err := f.ReadStateFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+	dir := filepath.Join(f.historyDir, name)
+	if err := f.fsys.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating history directory: %v", err)
+	}
+	versions, err := f.historyVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	version := 1
+	if len(versions) > 0 {
+		version = versions[len(versions)-1] + 1
+	}
+
+	stateFileVersion := StateFileVersion{
+		Version:   version,
+		Timestamp: time.Now().UTC(),
+		Caller:    caller,
+		Reason:    reason,
+		Content:   string(bytes),
+	}
+	versionBytes, err := json.Marshal(&stateFileVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling version: %v", err)
+	}
+	ops := []transactionOp{
+		{dir: dir, name: historyFileName(version), bytes: versionBytes},
+	}
+	versions = append(versions, version)
+	for len(versions) > f.historySize {
+		ops = append(ops, transactionOp{dir: dir, name: historyFileName(versions[0]), delete: true})
+		versions = versions[1:]
+	}
+	return ops, nil
+}
+
+// StateFileHistory returns the archived versions of a state file, newest first.
+func (f *FileManager) StateFileHistory(name string) ([]StateFileVersion, error) {
+	if !f.historyEnabled() {
+		return nil, ErrHistoryDisabled
+	}
+	versions, err := f.historyVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]StateFileVersion, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		stateFileVersion, err := f.StateFileVersion(name, versions[i])
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, *stateFileVersion)
+	}
+	return history, nil
+}
+
+func (f *FileManager) StateFileVersion(name string, version int) (*StateFileVersion, error) {
+	if !f.historyEnabled() {
+		return nil, ErrHistoryDisabled
+	}
+	bytes, err := f.fsys.ReadFile(filepath.Join(f.historyDir, name, historyFileName(version)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrVersionNotFound
+		}
+		return nil, fmt.Errorf("error reading version %d: %v", version, err)
+	}
+	var stateFileVersion StateFileVersion
+	if err := json.Unmarshal(bytes, &stateFileVersion); err != nil {
+		return nil, fmt.Errorf("error unmarshaling version %d: %v", version, err)
+	}
+	return &stateFileVersion, nil
+}
+
+func (f *FileManager) historyVersions(name string) ([]int, error) {
+	entries, err := f.fsys.ReadDir(filepath.Join(f.historyDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading history directory: %v", err)
+	}
+	var versions []int
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), historyFileSuffix) {
+			continue
+		}
+		version, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), historyFileSuffix))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+func historyFileName(version int) string {
+	return strconv.Itoa(version) + historyFileSuffix
+}
@@ -0,0 +1,274 @@
+package filemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+)
+
+const (
+	transactionJournalName = ".agent-transaction.json"
+)
+
+var (
+	ErrTransactionPending = errors.New("transaction pending, it must be recovered first")
+)
+
+type journalEntry struct {
+	Dir     string `json:"dir"`
+	Name    string `json:"name"`
+	Exists  bool   `json:"exists"`
+	Content []byte `json:"content,omitempty"`
+	// Mode and owner of the file, restored along with the content in case the file was deleted.
+	Mode fs.FileMode `json:"mode,omitempty"`
+	UID  *int        `json:"uid,omitempty"`
+	GID  *int        `json:"gid,omitempty"`
+}
+
+type journal struct {
+	Entries []journalEntry `json:"entries"`
+}
+
+type transactionOp struct {
+	dir    string
+	name   string
+	bytes  []byte
+	delete bool
+
+	archive bool
+	caller  string
+	reason  string
+}
+
+// Transaction groups file changes that are either all applied or all rolled back. Before applying them, the
+// previous content of the files is recorded in a journal kept in the state directory, which is used to roll back
+// when one of the changes fails or, if the agent crashes in the middle, by RecoverTransaction on startup.
+// A Transaction is not safe for concurrent use, callers are expected to serialize the access to the files.
+type Transaction struct {
+	fileManager *FileManager
+	ops         []transactionOp
+}
+
+func (f *FileManager) Begin() *Transaction {
+	return &Transaction{
+		fileManager: f,
+	}
+}
+
+func (t *Transaction) WriteStateFile(name string, bytes []byte) {
+	t.ops = append(t.ops, transactionOp{dir: t.fileManager.stateDir, name: name, bytes: bytes})
+}
+
+// DeleteStateFile deletes a state file if it exists.
+func (t *Transaction) DeleteStateFile(name string) {
+	t.ops = append(t.ops, transactionOp{dir: t.fileManager.stateDir, name: name, delete: true})
+}
+
+func (t *Transaction) WriteConfigFile(name string, bytes []byte) {
+	t.ops = append(t.ops, transactionOp{dir: t.fileManager.configDir, name: name, bytes: bytes})
+}
+
+// DeleteConfigFile deletes a config file if it exists.
+func (t *Transaction) DeleteConfigFile(name string) {
+	t.ops = append(t.ops, transactionOp{dir: t.fileManager.configDir, name: name, delete: true})
+}
+
+// ArchiveStateFile records the content that the state file has before the transaction as a new version,
+// see FileManager.ArchiveStateFile. The new version and the pruned ones are rolled back with the other changes.
+func (t *Transaction) ArchiveStateFile(name, caller, reason string) {
+	t.ops = append(t.ops, transactionOp{dir: t.fileManager.stateDir, name: name, archive: true, caller: caller, reason: reason})
+}
+
+// Commit applies the changes in order. If any of them fails, the ones already applied are rolled back.
+func (t *Transaction) Commit() error {
+	if len(t.ops) == 0 {
+		return nil
+	}
+	f := t.fileManager
+	pending, err := f.transactionPending()
+	if err != nil {
+		return err
+	}
+	if pending {
+		return ErrTransactionPending
+	}
+
+	ops, err := t.expandOps()
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	journal, err := t.journal(ops)
+	if err != nil {
+		return err
+	}
+	journalBytes, err := json.Marshal(journal)
+	if err != nil {
+		return fmt.Errorf("error marshaling journal: %v", err)
+	}
+	if err := f.writeFile(f.stateDir, transactionJournalName, journalBytes); err != nil {
+		return fmt.Errorf("error writing journal: %w", err)
+	}
+
+	for _, op := range ops {
+		if err := f.applyTransactionOp(op); err != nil {
+			return f.abortTransaction(journal, fmt.Errorf("error applying change to %s: %w", op.name, err))
+		}
+	}
+	if err := f.deleteFile(f.stateDir, transactionJournalName); err != nil {
+		// A leftover journal would roll back the changes on the next startup, so do it now.
+		return f.abortTransaction(journal, fmt.Errorf("error deleting journal: %w", err))
+	}
+	return nil
+}
+
+// expandOps replaces the archive operations by the changes to the history, computed from the files before the
+// transaction.
+func (t *Transaction) expandOps() ([]transactionOp, error) {
+	var ops []transactionOp
+	for _, op := range t.ops {
+		if !op.archive {
+			ops = append(ops, op)
+			continue
+		}
+		archiveOps, err := t.fileManager.archiveOps(op.name, op.caller, op.reason)
+		if err != nil {
+			return nil, fmt.Errorf("error archiving %s: %w", op.name, err)
+		}
+		ops = append(ops, archiveOps...)
+	}
+	return ops, nil
+}
+
+func (t *Transaction) journal(ops []transactionOp) (*journal, error) {
+	var journal journal
+	seen := make(map[string]bool)
+	for _, op := range ops {
+		key := filepath.Join(op.dir, op.name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		entry := journalEntry{
+			Dir:  op.dir,
+			Name: op.name,
+		}
+		bytes, err := t.fileManager.readFile(op.dir, op.name)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading %s: %v", op.name, err)
+		}
+		if err == nil {
+			info, err := t.fileManager.fsys.Stat(key)
+			if err != nil {
+				return nil, fmt.Errorf("error getting %s info: %v", op.name, err)
+			}
+			entry.Exists = true
+			entry.Content = bytes
+			entry.Mode = info.Mode().Perm()
+			if uid, gid, ok := filesystem.Owner(info); ok {
+				entry.UID = &uid
+				entry.GID = &gid
+			}
+		}
+		journal.Entries = append(journal.Entries, entry)
+	}
+	return &journal, nil
+}
+
+// RecoverTransaction rolls back a transaction interrupted by a crash, returning whether there was one.
+func (f *FileManager) RecoverTransaction() (bool, error) {
+	bytes, err := f.readFile(f.stateDir, transactionJournalName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error reading journal: %v", err)
+	}
+	var journal journal
+	if err := json.Unmarshal(bytes, &journal); err != nil {
+		return false, fmt.Errorf("error unmarshaling journal: %v", err)
+	}
+	if err := f.rollbackTransaction(&journal); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func (f *FileManager) transactionPending() (bool, error) {
+	if _, err := f.fsys.Stat(filepath.Join(f.stateDir, transactionJournalName)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error reading journal: %v", err)
+	}
+	return true, nil
+}
+
+func (f *FileManager) applyTransactionOp(op transactionOp) error {
+	if op.delete {
+		if err := f.deleteFile(op.dir, op.name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return f.writeFile(op.dir, op.name, op.bytes)
+}
+
+func (f *FileManager) abortTransaction(journal *journal, err error) error {
+	if rollbackErr := f.rollbackTransaction(journal); rollbackErr != nil {
+		return errors.Join(err, rollbackErr)
+	}
+	return err
+}
+
+// rollbackTransaction restores the files recorded in the journal, in reverse order, and then deletes the journal.
+// The journal is kept when a file cannot be restored, so the rollback can be retried.
+func (f *FileManager) rollbackTransaction(journal *journal) error {
+	var errs []error
+	for i := len(journal.Entries) - 1; i >= 0; i-- {
+		entry := journal.Entries[i]
+		if entry.Exists {
+			if err := f.restoreFile(&entry); err != nil {
+				errs = append(errs, fmt.Errorf("error restoring %s: %w", entry.Name, err))
+			}
+			continue
+		}
+		if err := f.deleteFile(entry.Dir, entry.Name); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("error removing %s: %w", entry.Name, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error rolling back transaction: %w", err)
+	}
+	if err := f.deleteFile(f.stateDir, transactionJournalName); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting journal: %w", err)
+	}
+	return nil
+}
+
+// restoreFile writes back a file recorded in the journal with its previous mode and owner, which cannot be copied
+// from the current file when the transaction deleted it.
+func (f *FileManager) restoreFile(entry *journalEntry) error {
+	mode, uid, gid, err := f.fileAttributes(filepath.Join(entry.Dir, entry.Name))
+	if err != nil {
+		return err
+	}
+	if entry.Mode != 0 {
+		mode = entry.Mode
+	}
+	if entry.UID != nil {
+		uid = *entry.UID
+	}
+	if entry.GID != nil {
+		gid = *entry.GID
+	}
+	return f.writeFileWith(entry.Dir, entry.Name, entry.Content, mode, uid, gid)
+}
@@ -0,0 +1,204 @@
+package filesystem
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sync"
+)
+
+type Op string
+
+const (
+	OpStat       Op = "stat"
+	OpReadFile   Op = "readfile"
+	OpReadDir    Op = "readdir"
+	OpMkdirAll   Op = "mkdirall"
+	OpCreateTemp Op = "createtemp"
+	OpRename     Op = "rename"
+	OpRemove     Op = "remove"
+	OpSyncDir    Op = "syncdir"
+	OpWrite      Op = "write"
+	OpChmod      Op = "chmod"
+	OpChown      Op = "chown"
+	OpSync       Op = "sync"
+	OpClose      Op = "close"
+)
+
+// Fault makes an operation fail with Err when its path matches Path, a filepath.Match pattern.
+// An empty Path matches every path. Rename is matched against the new path and the file operations against the
+// name of the temporary file. Count limits the number of failures, zero means the fault is permanent.
+type Fault struct {
+	Op    Op
+	Path  string
+	Err   error
+	Count int
+}
+
+// Faulty is an FS that injects faults into the operations of another FS, e.g. syscall.ENOSPC to simulate a full
+// volume or syscall.EROFS to simulate a read-only one. Operations without a matching fault are delegated.
+type Faulty struct {
+	FS
+
+	mux    sync.Mutex
+	faults []*Fault
+}
+
+func NewFaulty(fsys FS) *Faulty {
+	return &Faulty{
+		FS: fsys,
+	}
+}
+
+func (f *Faulty) Inject(fault Fault) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.faults = append(f.faults, &fault)
+}
+
+func (f *Faulty) Reset() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.faults = nil
+}
+
+func (f *Faulty) Stat(name string) (fs.FileInfo, error) {
+	if err := f.fault(OpStat, name); err != nil {
+		return nil, err
+	}
+	return f.FS.Stat(name)
+}
+
+func (f *Faulty) ReadFile(name string) ([]byte, error) {
+	if err := f.fault(OpReadFile, name); err != nil {
+		return nil, err
+	}
+	return f.FS.ReadFile(name)
+}
+
+func (f *Faulty) ReadFileFrom(name string, offset int64) ([]byte, error) {
+	if err := f.fault(OpReadFile, name); err != nil {
+		return nil, err
+	}
+	return f.FS.ReadFileFrom(name, offset)
+}
+
+func (f *Faulty) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := f.fault(OpReadDir, name); err != nil {
+		return nil, err
+	}
+	return f.FS.ReadDir(name)
+}
+
+func (f *Faulty) MkdirAll(path string, perm fs.FileMode) error {
+	if err := f.fault(OpMkdirAll, path); err != nil {
+		return err
+	}
+	return f.FS.MkdirAll(path, perm)
+}
+
+func (f *Faulty) CreateTemp(dir, pattern string) (File, error) {
+	if err := f.fault(OpCreateTemp, dir); err != nil {
+		return nil, err
+	}
+	file, err := f.FS.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{File: file, faulty: f}, nil
+}
+
+func (f *Faulty) Rename(oldpath, newpath string) error {
+	if err := f.fault(OpRename, newpath); err != nil {
+		return err
+	}
+	return f.FS.Rename(oldpath, newpath)
+}
+
+func (f *Faulty) Remove(name string) error {
+	if err := f.fault(OpRemove, name); err != nil {
+		return err
+	}
+	return f.FS.Remove(name)
+}
+
+func (f *Faulty) SyncDir(name string) error {
+	if err := f.fault(OpSyncDir, name); err != nil {
+		return err
+	}
+	return f.FS.SyncDir(name)
+}
+
+// Watch delegates to the wrapped FS when it is a Watcher.
+func (f *Faulty) Watch(ctx context.Context, name string) (<-chan struct{}, error) {
+	watcher, ok := f.FS.(Watcher)
+	if !ok {
+		return nil, ErrWatchNotSupported
+	}
+	return watcher.Watch(ctx, name)
+}
+
+func (f *Faulty) fault(op Op, path string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	for i, fault := range f.faults {
+		if fault.Op != op {
+			continue
+		}
+		if fault.Path != "" {
+			if ok, err := filepath.Match(fault.Path, path); err != nil || !ok {
+				continue
+			}
+		}
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				f.faults = append(f.faults[:i], f.faults[i+1:]...)
+			}
+		}
+		return &fs.PathError{Op: string(op), Path: path, Err: fault.Err}
+	}
+	return nil
+}
+
+type faultyFile struct {
+	File
+	faulty *Faulty
+}
+
+func (f *faultyFile) Write(b []byte) (int, error) {
+	if err := f.faulty.fault(OpWrite, f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.Write(b)
+}
+
+func (f *faultyFile) Chmod(mode fs.FileMode) error {
+	if err := f.faulty.fault(OpChmod, f.Name()); err != nil {
+		return err
+	}
+	return f.File.Chmod(mode)
+}
+
+func (f *faultyFile) Chown(uid, gid int) error {
+	if err := f.faulty.fault(OpChown, f.Name()); err != nil {
+		return err
+	}
+	return f.File.Chown(uid, gid)
+}
+
+func (f *faultyFile) Sync() error {
+	if err := f.faulty.fault(OpSync, f.Name()); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+// Close always closes the underlying file, so that an injected fault does not leak it.
+func (f *faultyFile) Close() error {
+	closeErr := f.File.Close()
+	if err := f.faulty.fault(OpClose, f.Name()); err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,140 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+var (
+	ErrWatchNotSupported = errors.New("watching files not supported")
+)
+
+var (
+	_ FS      = &OS{}
+	_ FS      = &Memory{}
+	_ FS      = &Faulty{}
+	_ Watcher = &OS{}
+	_ Watcher = &Memory{}
+	_ Watcher = &Faulty{}
+)
+
+// FS is the subset of filesystem operations used by the agent to manage its config and state files.
+// Errors are expected to be *fs.PathError, so they can be inspected with os.IsNotExist and friends.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	// ReadFileFrom reads a file from offset until the end. Nothing is read when the file is smaller than offset.
+	ReadFileFrom(name string, offset int64) ([]byte, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	CreateTemp(dir, pattern string) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	// SyncDir flushes the directory entries to stable storage, making renames and removals durable.
+	SyncDir(name string) error
+}
+
+// Watcher is implemented by the FS that can notify changes to files.
+type Watcher interface {
+	// Watch notifies on the returned channel when the file is created or written, until the context is done.
+	// Notifications are coalesced while the previous one has not been received. The channel is never closed.
+	Watch(ctx context.Context, name string) (<-chan struct{}, error)
+}
+
+// File is a file opened for writing by FS.CreateTemp.
+type File interface {
+	Name() string
+	Write(b []byte) (int, error)
+	Chmod(mode fs.FileMode) error
+	Chown(uid, gid int) error
+	Sync() error
+	Close() error
+}
+
+// FileOwner is returned by the FileInfo.Sys of the FS that are not backed by the local disk.
+type FileOwner struct {
+	UID int
+	GID int
+}
+
+// Owner returns the owner of a file, when the FS that returned the FileInfo keeps track of it.
+func Owner(info fs.FileInfo) (uid, gid int, ok bool) {
+	if owner, ok := info.Sys().(*FileOwner); ok {
+		return owner.UID, owner.GID, true
+	}
+	return sysOwner(info)
+}
+
+// SameFile reports whether two FileInfo describe the same file, like os.SameFile does for the local disk.
+// A file replaced by a new one, even with the same name, is not the same file.
+func SameFile(a, b fs.FileInfo) bool {
+	if memoryA, ok := a.(*memoryFileInfo); ok {
+		memoryB, ok := b.(*memoryFileInfo)
+		return ok && memoryA.node == memoryB.node
+	}
+	return os.SameFile(a, b)
+}
+
+// OS is the FS backed by the local disk.
+type OS struct{}
+
+func NewOS() *OS {
+	return &OS{}
+}
+
+func (o *OS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (o *OS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (o *OS) ReadFileFrom(name string, offset int64) ([]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(file)
+}
+
+func (o *OS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (o *OS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (o *OS) CreateTemp(dir, pattern string) (File, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (o *OS) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (o *OS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (o *OS) SyncDir(name string) error {
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	syncErr := d.Sync()
+	closeErr := d.Close()
+	return errors.Join(syncErr, closeErr)
+}
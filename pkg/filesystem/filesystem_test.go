@@ -0,0 +1,216 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFS(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys FS
+		dir  string
+	}{
+		{
+			name: "os",
+			fsys: NewOS(),
+			dir:  t.TempDir(),
+		},
+		{
+			name: "memory",
+			fsys: NewMemory(),
+			dir:  "/var/lib/mysql",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(tt.dir, "state")
+			if err := tt.fsys.MkdirAll(dir, 0755); err != nil {
+				t.Fatalf("error creating directory: %v", err)
+			}
+			file, err := tt.fsys.CreateTemp(dir, ".grastate.dat.tmp-*")
+			if err != nil {
+				t.Fatalf("error creating temporary file: %v", err)
+			}
+			if _, err := file.Write([]byte("seqno: 1")); err != nil {
+				t.Fatalf("error writing file: %v", err)
+			}
+			if err := file.Chmod(0640); err != nil {
+				t.Fatalf("error setting file mode: %v", err)
+			}
+			if err := file.Close(); err != nil {
+				t.Fatalf("error closing file: %v", err)
+			}
+			if _, err := file.Write([]byte("seqno: 2")); err == nil {
+				t.Fatal("expected error writing closed file")
+			}
+
+			name := filepath.Join(dir, "grastate.dat")
+			if err := tt.fsys.Rename(file.Name(), name); err != nil {
+				t.Fatalf("error renaming file: %v", err)
+			}
+			if err := tt.fsys.SyncDir(dir); err != nil {
+				t.Fatalf("error syncing directory: %v", err)
+			}
+			bytes, err := tt.fsys.ReadFile(name)
+			if err != nil {
+				t.Fatalf("error reading file: %v", err)
+			}
+			if string(bytes) != "seqno: 1" {
+				t.Fatalf("unexpected file content: %s", bytes)
+			}
+			info, err := tt.fsys.Stat(name)
+			if err != nil {
+				t.Fatalf("error getting file info: %v", err)
+			}
+			if info.Mode().Perm() != 0640 || info.Size() != int64(len(bytes)) {
+				t.Fatalf("unexpected file info: mode %v, size %d", info.Mode(), info.Size())
+			}
+			entries, err := tt.fsys.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("error reading directory: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Name() != "grastate.dat" {
+				t.Fatalf("unexpected directory entries: %v", entries)
+			}
+
+			if err := tt.fsys.Remove(dir); err == nil {
+				t.Fatal("expected error removing non empty directory")
+			}
+			if err := tt.fsys.Remove(name); err != nil {
+				t.Fatalf("error removing file: %v", err)
+			}
+			if _, err := tt.fsys.Stat(name); !os.IsNotExist(err) {
+				t.Fatalf("expected not exist error, got %v", err)
+			}
+			if err := tt.fsys.Remove(name); !os.IsNotExist(err) {
+				t.Fatalf("expected not exist error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFaulty(t *testing.T) {
+	memory := NewMemory()
+	if err := memory.MkdirAll("/state", 0755); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	faulty := NewFaulty(memory)
+	faulty.Inject(Fault{
+		Op:    OpWrite,
+		Path:  "/state/.*",
+		Err:   syscall.ENOSPC,
+		Count: 1,
+	})
+
+	write := func() error {
+		file, err := faulty.CreateTemp("/state", ".grastate.dat.tmp-*")
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = file.Write([]byte("seqno: 1"))
+		return err
+	}
+	err := write()
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected ENOSPC error, got %v", err)
+	}
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) || pathErr.Op != string(OpWrite) {
+		t.Fatalf("expected write path error, got %v", err)
+	}
+	if err := write(); err != nil {
+		t.Fatalf("expected fault to be exhausted, got %v", err)
+	}
+
+	faulty.Inject(Fault{
+		Op:  OpReadFile,
+		Err: syscall.EACCES,
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := faulty.ReadFile("/state/grastate.dat"); !os.IsPermission(err) {
+			t.Fatalf("expected permission error, got %v", err)
+		}
+	}
+	faulty.Reset()
+	if _, err := faulty.ReadFile("/state/grastate.dat"); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error after reset, got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	memory := NewMemory()
+	if err := memory.MkdirAll("/var/lib/mysql", 0755); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	tests := []struct {
+		name   string
+		fsys   Watcher
+		dir    string
+		append func(name string, data []byte) error
+	}{
+		{
+			name: "os",
+			fsys: NewOS(),
+			dir:  t.TempDir(),
+			append: func(name string, data []byte) error {
+				file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				_, err = file.Write(data)
+				return err
+			},
+		},
+		{
+			name: "memory",
+			fsys: memory,
+			dir:  "/var/lib/mysql",
+			append: func(name string, data []byte) error {
+				return memory.AppendFile(name, data, 0644)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			name := filepath.Join(tt.dir, "mariadb.err")
+			events, err := tt.fsys.Watch(ctx, name)
+			if err != nil {
+				t.Fatalf("error watching file: %v", err)
+			}
+
+			for _, line := range []string{"starting\n", "recovered\n"} {
+				if err := tt.append(name, []byte(line)); err != nil {
+					t.Fatalf("error appending to file: %v", err)
+				}
+				select {
+				case <-events:
+				case <-time.After(5 * time.Second):
+					t.Fatal("timeout waiting for file event")
+				}
+			}
+
+			bytes, err := tt.fsys.(FS).ReadFileFrom(name, int64(len("starting\n")))
+			if err != nil {
+				t.Fatalf("error reading file: %v", err)
+			}
+			if string(bytes) != "recovered\n" {
+				t.Fatalf("unexpected file content: %q", bytes)
+			}
+			if bytes, err := tt.fsys.(FS).ReadFileFrom(name, 100); err != nil || len(bytes) != 0 {
+				t.Fatalf("expected nothing to be read past the end, got %q, %v", bytes, err)
+			}
+		})
+	}
+}
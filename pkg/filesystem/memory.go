@@ -0,0 +1,408 @@
+package filesystem
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type memoryNode struct {
+	dir     bool
+	data    []byte
+	mode    fs.FileMode
+	uid     int
+	gid     int
+	modTime time.Time
+}
+
+func newMemoryNode(dir bool, mode fs.FileMode) *memoryNode {
+	return &memoryNode{
+		dir:     dir,
+		mode:    mode,
+		uid:     os.Geteuid(),
+		gid:     os.Getegid(),
+		modTime: time.Now(),
+	}
+}
+
+// Memory is an in-memory FS. Only the root directory exists initially, the rest must be created with MkdirAll.
+type Memory struct {
+	mux      sync.RWMutex
+	nodes    map[string]*memoryNode
+	watchers map[string][]chan struct{}
+	tempSeq  int
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		nodes: map[string]*memoryNode{
+			string(filepath.Separator): newMemoryNode(true, fs.ModeDir|0755),
+			".":                        newMemoryNode(true, fs.ModeDir|0755),
+		},
+		watchers: make(map[string][]chan struct{}),
+	}
+}
+
+// WriteFile creates or replaces a file. It is meant to seed the filesystem in tests.
+func (m *Memory) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	name = filepath.Clean(name)
+	if err := m.checkParent("open", name); err != nil {
+		return err
+	}
+	if node, ok := m.nodes[name]; ok && node.dir {
+		return &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	node := newMemoryNode(false, perm)
+	node.data = append([]byte(nil), data...)
+	m.nodes[name] = node
+	m.notify(name)
+	return nil
+}
+
+// AppendFile appends to a file, creating it if needed. It is meant to simulate a process writing a log in tests.
+func (m *Memory) AppendFile(name string, data []byte, perm fs.FileMode) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	name = filepath.Clean(name)
+	if err := m.checkParent("open", name); err != nil {
+		return err
+	}
+	node, ok := m.nodes[name]
+	if !ok {
+		node = newMemoryNode(false, perm)
+		m.nodes[name] = node
+	}
+	if node.dir {
+		return &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	node.data = append(node.data, data...)
+	node.modTime = time.Now()
+	m.notify(name)
+	return nil
+}
+
+func (m *Memory) Stat(name string) (fs.FileInfo, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	name = filepath.Clean(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return newMemoryFileInfo(name, node), nil
+}
+
+func (m *Memory) ReadFile(name string) ([]byte, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	name = filepath.Clean(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.dir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	return append([]byte(nil), node.data...), nil
+}
+
+func (m *Memory) ReadFileFrom(name string, offset int64) ([]byte, error) {
+	bytes, err := m.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if offset >= int64(len(bytes)) {
+		return nil, nil
+	}
+	return bytes[offset:], nil
+}
+
+func (m *Memory) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	name = filepath.Clean(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if !node.dir {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	var entries []fs.DirEntry
+	for path, child := range m.nodes {
+		if path != name && filepath.Dir(path) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(newMemoryFileInfo(path, child)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (m *Memory) MkdirAll(path string, perm fs.FileMode) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	path = filepath.Clean(path)
+	var missing []string
+	for p := path; ; p = filepath.Dir(p) {
+		if node, ok := m.nodes[p]; ok {
+			if !node.dir {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		missing = append(missing, p)
+	}
+	for _, p := range missing {
+		m.nodes[p] = newMemoryNode(true, fs.ModeDir|perm)
+	}
+	return nil
+}
+
+func (m *Memory) CreateTemp(dir, pattern string) (File, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	dir = filepath.Clean(dir)
+	node, ok := m.nodes[dir]
+	if !ok {
+		return nil, &fs.PathError{Op: "createtemp", Path: dir, Err: fs.ErrNotExist}
+	}
+	if !node.dir {
+		return nil, &fs.PathError{Op: "createtemp", Path: dir, Err: syscall.ENOTDIR}
+	}
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for {
+		m.tempSeq++
+		name := filepath.Join(dir, prefix+strconv.Itoa(m.tempSeq)+suffix)
+		if _, ok := m.nodes[name]; ok {
+			continue
+		}
+		file := newMemoryNode(false, 0600)
+		m.nodes[name] = file
+		return &memoryFile{memory: m, name: name, node: file}, nil
+	}
+}
+
+func (m *Memory) Rename(oldpath, newpath string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	oldpath = filepath.Clean(oldpath)
+	newpath = filepath.Clean(newpath)
+	node, ok := m.nodes[oldpath]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: fs.ErrNotExist}
+	}
+	if err := m.checkParent("rename", newpath); err != nil {
+		return err
+	}
+	if target, ok := m.nodes[newpath]; ok && target.dir {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: syscall.EEXIST}
+	}
+	if node.dir {
+		prefix := oldpath + string(filepath.Separator)
+		for path, child := range m.nodes {
+			if strings.HasPrefix(path, prefix) {
+				delete(m.nodes, path)
+				m.nodes[newpath+string(filepath.Separator)+strings.TrimPrefix(path, prefix)] = child
+			}
+		}
+	}
+	delete(m.nodes, oldpath)
+	m.nodes[newpath] = node
+	m.notify(newpath)
+	return nil
+}
+
+func (m *Memory) Remove(name string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	name = filepath.Clean(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.dir {
+		for path := range m.nodes {
+			if path != name && filepath.Dir(path) == name {
+				return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+			}
+		}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *Memory) SyncDir(name string) error {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	name = filepath.Clean(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if !node.dir {
+		return &fs.PathError{Op: "sync", Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+func (m *Memory) Watch(ctx context.Context, name string) (<-chan struct{}, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	name = filepath.Clean(name)
+	if err := m.checkParent("watch", name); err != nil {
+		return nil, err
+	}
+	events := make(chan struct{}, 1)
+	m.watchers[name] = append(m.watchers[name], events)
+	go func() {
+		<-ctx.Done()
+		m.mux.Lock()
+		defer m.mux.Unlock()
+		watchers := m.watchers[name]
+		for i, watcher := range watchers {
+			if watcher == events {
+				m.watchers[name] = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+	return events, nil
+}
+
+// notify must be called with the lock held.
+func (m *Memory) notify(name string) {
+	for _, events := range m.watchers[name] {
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (m *Memory) checkParent(op, name string) error {
+	parent, ok := m.nodes[filepath.Dir(name)]
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.dir {
+		return &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+type memoryFile struct {
+	memory *Memory
+	name   string
+	node   *memoryNode
+	closed bool
+}
+
+func (f *memoryFile) Name() string {
+	return f.name
+}
+
+func (f *memoryFile) Write(b []byte) (int, error) {
+	if err := f.update("write", func(node *memoryNode) {
+		node.data = append(node.data, b...)
+		node.modTime = time.Now()
+		f.memory.notify(f.name)
+	}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (f *memoryFile) Chmod(mode fs.FileMode) error {
+	return f.update("chmod", func(node *memoryNode) {
+		node.mode = mode.Perm()
+	})
+}
+
+func (f *memoryFile) Chown(uid, gid int) error {
+	return f.update("chown", func(node *memoryNode) {
+		if uid >= 0 {
+			node.uid = uid
+		}
+		if gid >= 0 {
+			node.gid = gid
+		}
+	})
+}
+
+func (f *memoryFile) Sync() error {
+	return f.update("sync", func(node *memoryNode) {})
+}
+
+func (f *memoryFile) Close() error {
+	return f.update("close", func(node *memoryNode) {
+		f.closed = true
+	})
+}
+
+func (f *memoryFile) update(op string, fn func(node *memoryNode)) error {
+	f.memory.mux.Lock()
+	defer f.memory.mux.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	fn(f.node)
+	return nil
+}
+
+type memoryFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	owner   FileOwner
+	node    *memoryNode
+}
+
+func newMemoryFileInfo(path string, node *memoryNode) *memoryFileInfo {
+	return &memoryFileInfo{
+		name:    filepath.Base(path),
+		size:    int64(len(node.data)),
+		mode:    node.mode,
+		modTime: node.modTime,
+		owner:   FileOwner{UID: node.uid, GID: node.gid},
+		node:    node,
+	}
+}
+
+func (i *memoryFileInfo) Name() string {
+	return i.name
+}
+
+func (i *memoryFileInfo) Size() int64 {
+	return i.size
+}
+
+func (i *memoryFileInfo) Mode() fs.FileMode {
+	return i.mode
+}
+
+func (i *memoryFileInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i *memoryFileInfo) IsDir() bool {
+	return i.mode.IsDir()
+}
+
+func (i *memoryFileInfo) Sys() any {
+	return &i.owner
+}
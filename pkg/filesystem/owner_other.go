@@ -0,0 +1,9 @@
+//go:build !unix
+
+package filesystem
+
+import "io/fs"
+
+func sysOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
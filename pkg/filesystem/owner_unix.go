@@ -0,0 +1,16 @@
+//go:build unix
+
+package filesystem
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func sysOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
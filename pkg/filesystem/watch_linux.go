@@ -0,0 +1,65 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO
+)
+
+// Watch uses inotify on the parent directory, so the file does not need to exist and it can be replaced.
+func (o *OS) Watch(ctx context.Context, name string) (<-chan struct{}, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	dir := filepath.Dir(name)
+	if _, err := syscall.InotifyAddWatch(fd, dir, inotifyMask); err != nil {
+		syscall.Close(fd)
+		return nil, &fs.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	// The descriptor is non-blocking, so the file is registered in the runtime poller and closing it
+	// unblocks the pending read.
+	file := os.NewFile(uintptr(fd), "inotify")
+	events := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		file.Close()
+	}()
+	go readInotifyEvents(file, filepath.Base(name), events)
+	return events, nil
+}
+
+func readInotifyEvents(file *os.File, name string, events chan<- struct{}) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			if nameEnd > n {
+				break
+			}
+			if string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00")) == name {
+				select {
+				case events <- struct{}{}:
+				default:
+				}
+			}
+			offset = nameEnd
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package filesystem
+
+import "context"
+
+func (o *OS) Watch(ctx context.Context, name string) (<-chan struct{}, error) {
+	return nil, ErrWatchNotSupported
+}
@@ -7,6 +7,7 @@ import (
 	"html/template"
 	"strconv"
 	"strings"
+	"time"
 
 	guuid "github.com/google/uuid"
 )
@@ -18,6 +19,8 @@ const (
 wsrep_new_cluster="ON"`
 	RecoveryFileName    = "2-recovery.cnf"
 	RecoveryLogFileName = "mariadb.err"
+	// RecoveryResultFileName is where the agent persists the last recovered position, in the state directory.
+	RecoveryResultFileName = ".agent-recovery-result.json"
 )
 
 var (
@@ -145,6 +148,16 @@ func (g *GaleraState) Unmarshal(text []byte) error {
 	return nil
 }
 
+// GaleraStateVersion is a previous galera state, archived before it was overwritten.
+type GaleraStateVersion struct {
+	Version     int          `json:"version"`
+	Timestamp   time.Time    `json:"timestamp"`
+	Caller      string       `json:"caller,omitempty"`
+	Reason      string       `json:"reason,omitempty"`
+	GaleraState *GaleraState `json:"galeraState,omitempty"`
+	Content     string       `json:"content"`
+}
+
 type Bootstrap struct {
 	UUID  string `json:"uuid"`
 	Seqno int    `json:"seqno"`
@@ -178,6 +191,19 @@ func (b *Bootstrap) Validate() error {
 	return nil
 }
 
+// RecoveryResult is the last position recovered by the agent, persisted so it can be retrieved again until
+// grastate.dat changes.
+type RecoveryResult struct {
+	Bootstrap
+	Timestamp time.Time `json:"timestamp"`
+	// LogHash is the SHA-256 of the recovery log the position was parsed from.
+	LogHash string `json:"logHash"`
+	// GaleraStateHash and GaleraStateModTime identify the grastate.dat present when the position was recovered.
+	// They are empty when there was no grastate.dat.
+	GaleraStateHash    string     `json:"galeraStateHash,omitempty"`
+	GaleraStateModTime *time.Time `json:"galeraStateModTime,omitempty"`
+}
+
 func (r *Bootstrap) Unmarshal(text []byte) error {
 	fileScanner := bufio.NewScanner(bytes.NewReader(text))
 	fileScanner.Split(bufio.ScanLines)
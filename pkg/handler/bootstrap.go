@@ -12,20 +12,23 @@ import (
 	agenterrors "github.com/mariadb-operator/agent/pkg/errors"
 	"github.com/mariadb-operator/agent/pkg/filemanager"
 	"github.com/mariadb-operator/agent/pkg/galera"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
 	"github.com/mariadb-operator/agent/pkg/responsewriter"
 )
 
 type Bootstrap struct {
 	fileManager    *filemanager.FileManager
+	serverDetector *mariadb.ServerDetector
 	responseWriter *responsewriter.ResponseWriter
 	locker         sync.Locker
 	logger         *logr.Logger
 }
 
-func NewBootstrap(fileManager *filemanager.FileManager, responseWriter *responsewriter.ResponseWriter, locker sync.Locker,
-	logger *logr.Logger) *Bootstrap {
+func NewBootstrap(fileManager *filemanager.FileManager, serverDetector *mariadb.ServerDetector,
+	responseWriter *responsewriter.ResponseWriter, locker sync.Locker, logger *logr.Logger) *Bootstrap {
 	return &Bootstrap{
 		fileManager:    fileManager,
+		serverDetector: serverDetector,
 		responseWriter: responseWriter,
 		locker:         locker,
 		logger:         logger,
@@ -44,20 +47,26 @@ func (b *Bootstrap) Put(w http.ResponseWriter, r *http.Request) {
 	}
 	b.locker.Lock()
 	defer b.locker.Unlock()
-	b.logger.V(1).Info("enabling bootstrap")
+	logger := requestLogger(b.logger, r)
+	logger.V(1).Info("enabling bootstrap")
 
-	if err := b.fileManager.DeleteConfigFile(galera.RecoveryFileName); err != nil && !os.IsNotExist(err) {
-		b.responseWriter.WriteErrorf(w, "error deleting existing recovery config: %v", err)
+	if !checkServerStopped(b.serverDetector, b.responseWriter, w, r, logger) {
 		return
 	}
 
-	if err := b.setSafeToBootstrap(&bootstrap); err != nil {
+	galeraState, err := b.safeToBootstrap(&bootstrap)
+	if err != nil {
 		b.responseWriter.WriteErrorf(w, "error setting safe to bootstrap: %v", err)
 		return
 	}
 
-	if err := b.fileManager.WriteConfigFile(galera.BootstrapFileName, []byte(galera.BootstrapFile)); err != nil {
-		b.responseWriter.WriteErrorf(w, "error writing bootstrap config: %v", err)
+	tx := b.fileManager.Begin()
+	tx.ArchiveStateFile(galera.GaleraStateFileName, caller(r), "enable bootstrap")
+	tx.DeleteConfigFile(galera.RecoveryFileName)
+	tx.WriteStateFile(galera.GaleraStateFileName, galeraState)
+	tx.WriteConfigFile(galera.BootstrapFileName, []byte(galera.BootstrapFile))
+	if err := tx.Commit(); err != nil {
+		b.responseWriter.WriteErrorf(w, "error enabling bootstrap: %v", err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -66,7 +75,7 @@ func (b *Bootstrap) Put(w http.ResponseWriter, r *http.Request) {
 func (b *Bootstrap) Delete(w http.ResponseWriter, r *http.Request) {
 	b.locker.Lock()
 	defer b.locker.Unlock()
-	b.logger.V(1).Info("disabling bootstrap")
+	requestLogger(b.logger, r).V(1).Info("disabling bootstrap")
 
 	if err := b.fileManager.DeleteConfigFile(galera.BootstrapFileName); err != nil {
 		if os.IsNotExist(err) {
@@ -79,18 +88,19 @@ func (b *Bootstrap) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (b *Bootstrap) setSafeToBootstrap(bootstrap *galera.Bootstrap) error {
+// safeToBootstrap returns the current galera state marked as safe to bootstrap with the given position.
+func (b *Bootstrap) safeToBootstrap(bootstrap *galera.Bootstrap) ([]byte, error) {
 	bytes, err := b.fileManager.ReadStateFile(galera.GaleraStateFileName)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return errors.New("galera state does not exist")
+			return nil, errors.New("galera state does not exist")
 		}
-		return fmt.Errorf("error reading galera state: %v", err)
+		return nil, fmt.Errorf("error reading galera state: %v", err)
 	}
 
 	var galeraState galera.GaleraState
 	if err := galeraState.Unmarshal(bytes); err != nil {
-		return fmt.Errorf("error unmarshaling galera state: %v", err)
+		return nil, fmt.Errorf("error unmarshaling galera state: %v", err)
 	}
 
 	galeraState.UUID = bootstrap.UUID
@@ -98,11 +108,7 @@ func (b *Bootstrap) setSafeToBootstrap(bootstrap *galera.Bootstrap) error {
 	galeraState.SafeToBootstrap = true
 	bytes, err = galeraState.Marshal()
 	if err != nil {
-		return fmt.Errorf("error marshaling galera state: %v", err)
-	}
-
-	if err := b.fileManager.WriteStateFile(galera.GaleraStateFileName, bytes); err != nil {
-		return fmt.Errorf("error writing galera state: %v", err)
+		return nil, fmt.Errorf("error marshaling galera state: %v", err)
 	}
-	return nil
+	return bytes, nil
 }
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+const (
+	testConfigDir   = "/etc/mysql/mariadb.conf.d"
+	testStateDir    = "/var/lib/mysql"
+	testGaleraState = `version: 2.1
+uuid: 05f061bd-02a3-11ee-857c-aa370ff6666b
+seqno: 1
+safe_to_bootstrap: 0`
+)
+
+func newTestFS(t *testing.T) *filesystem.Faulty {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{testConfigDir, testStateDir} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	if err := memory.WriteFile(testStateDir+"/"+galera.GaleraStateFileName, []byte(testGaleraState), 0644); err != nil {
+		t.Fatalf("error writing galera state: %v", err)
+	}
+	return filesystem.NewFaulty(memory)
+}
+
+func putBootstrap(t *testing.T, bootstrap *Bootstrap) *httptest.ResponseRecorder {
+	body, err := json.Marshal(&galera.Bootstrap{
+		UUID:  "05f061bd-02a3-11ee-857c-aa370ff6666b",
+		Seqno: 2,
+	})
+	if err != nil {
+		t.Fatalf("error marshaling bootstrap: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	bootstrap.Put(rec, httptest.NewRequest(http.MethodPut, "/api/bootstrap", bytes.NewReader(body)))
+	return rec
+}
+
+func assertNoTempFiles(t *testing.T, fsys filesystem.FS, dir string) {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error reading directory: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			t.Fatalf("unexpected temporary file in %s: %s", dir, entry.Name())
+		}
+	}
+}
+
+func TestBootstrapVolumeFull(t *testing.T) {
+	tests := []struct {
+		name                string
+		fault               filesystem.Fault
+		wantBootstrapFile   bool
+		wantSafeToBootstrap bool
+	}{
+		{
+			name:                "no fault",
+			wantBootstrapFile:   true,
+			wantSafeToBootstrap: true,
+		},
+		{
+			name: "state volume full",
+			fault: filesystem.Fault{
+				Op:   filesystem.OpWrite,
+				Path: testStateDir + "/*",
+				Err:  syscall.ENOSPC,
+			},
+			wantBootstrapFile:   false,
+			wantSafeToBootstrap: false,
+		},
+		{
+			name: "state volume full on sync",
+			fault: filesystem.Fault{
+				Op:   filesystem.OpSync,
+				Path: testStateDir + "/*",
+				Err:  syscall.ENOSPC,
+			},
+			wantBootstrapFile:   false,
+			wantSafeToBootstrap: false,
+		},
+		{
+			name: "config volume full",
+			fault: filesystem.Fault{
+				Op:   filesystem.OpWrite,
+				Path: testConfigDir + "/*",
+				Err:  syscall.ENOSPC,
+			},
+			wantBootstrapFile:   false,
+			wantSafeToBootstrap: false,
+		},
+		{
+			name: "read-only config volume",
+			fault: filesystem.Fault{
+				Op:   filesystem.OpCreateTemp,
+				Path: testConfigDir,
+				Err:  syscall.EROFS,
+			},
+			wantBootstrapFile:   false,
+			wantSafeToBootstrap: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newTestFS(t)
+			if tt.fault.Op != "" {
+				fsys.Inject(tt.fault)
+			}
+			fileManager, err := filemanager.NewFileManager(testConfigDir, testStateDir, filemanager.WithFS(fsys))
+			if err != nil {
+				t.Fatalf("error creating file manager: %v", err)
+			}
+			logger := logr.Discard()
+			handler := NewHandler(fileManager, nil, &logger)
+
+			rec := putBootstrap(t, handler.Bootstrap)
+			wantStatus := http.StatusOK
+			if tt.fault.Op != "" {
+				wantStatus = http.StatusInternalServerError
+			}
+			if rec.Code != wantStatus {
+				t.Fatalf("unexpected status code: expected %d, got %d", wantStatus, rec.Code)
+			}
+
+			exists, err := fileManager.ConfigFileExists(galera.BootstrapFileName)
+			if err != nil {
+				t.Fatalf("error checking bootstrap config: %v", err)
+			}
+			if exists != tt.wantBootstrapFile {
+				t.Fatalf("unexpected bootstrap config existence: expected %v, got %v", tt.wantBootstrapFile, exists)
+			}
+			bytes, err := fileManager.ReadStateFile(galera.GaleraStateFileName)
+			if err != nil {
+				t.Fatalf("error reading galera state: %v", err)
+			}
+			var galeraState galera.GaleraState
+			if err := galeraState.Unmarshal(bytes); err != nil {
+				t.Fatalf("expected galera state to be intact, got error: %v", err)
+			}
+			if galeraState.SafeToBootstrap != tt.wantSafeToBootstrap {
+				t.Fatalf("unexpected safe to bootstrap: expected %v, got %v", tt.wantSafeToBootstrap, galeraState.SafeToBootstrap)
+			}
+			assertNoTempFiles(t, fsys, testConfigDir)
+			assertNoTempFiles(t, fsys, testStateDir)
+
+			fsys.Reset()
+			if rec := putBootstrap(t, handler.Bootstrap); rec.Code != http.StatusOK {
+				t.Fatalf("expected bootstrap to succeed once there is space left, got %d", rec.Code)
+			}
+			if exists, err := fileManager.ConfigFileExists(galera.BootstrapFileName); err != nil || !exists {
+				t.Fatalf("expected bootstrap config to exist after retrying: %v", err)
+			}
+		})
+	}
+}
@@ -9,20 +9,29 @@ import (
 	"github.com/mariadb-operator/agent/pkg/errors"
 	"github.com/mariadb-operator/agent/pkg/filemanager"
 	"github.com/mariadb-operator/agent/pkg/galera"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
 	"github.com/mariadb-operator/agent/pkg/responsewriter"
 )
 
+// GaleraStateResponse is the galera state reported by the agent, along with the state of mariadbd.
+type GaleraStateResponse struct {
+	galera.GaleraState
+	Server *mariadb.ServerStatus `json:"server,omitempty"`
+}
+
 type GaleraState struct {
 	fileManager    *filemanager.FileManager
+	serverDetector *mariadb.ServerDetector
 	responseWriter *responsewriter.ResponseWriter
 	locker         sync.Locker
 	logger         *logr.Logger
 }
 
-func NewGaleraState(fileManager *filemanager.FileManager, responseWriter *responsewriter.ResponseWriter, locker sync.Locker,
-	logger *logr.Logger) *GaleraState {
+func NewGaleraState(fileManager *filemanager.FileManager, serverDetector *mariadb.ServerDetector,
+	responseWriter *responsewriter.ResponseWriter, locker sync.Locker, logger *logr.Logger) *GaleraState {
 	return &GaleraState{
 		fileManager:    fileManager,
+		serverDetector: serverDetector,
 		responseWriter: responseWriter,
 		locker:         locker,
 		logger:         logger,
@@ -32,7 +41,8 @@ func NewGaleraState(fileManager *filemanager.FileManager, responseWriter *respon
 func (g *GaleraState) Get(w http.ResponseWriter, r *http.Request) {
 	g.locker.Lock()
 	defer g.locker.Unlock()
-	g.logger.V(1).Info("getting galera state")
+	logger := requestLogger(g.logger, r)
+	logger.V(1).Info("getting galera state")
 
 	bytes, err := g.fileManager.ReadStateFile(galera.GaleraStateFileName)
 	if err != nil {
@@ -49,5 +59,16 @@ func (g *GaleraState) Get(w http.ResponseWriter, r *http.Request) {
 		g.responseWriter.WriteErrorf(w, "error unmarshaling galera state: %v", err)
 		return
 	}
-	g.responseWriter.WriteOK(w, galeraState)
+	res := GaleraStateResponse{
+		GaleraState: galeraState,
+	}
+	if g.serverDetector != nil {
+		status, err := g.serverDetector.Status(r.Context())
+		if err != nil {
+			logger.Error(err, "error detecting mariadbd state")
+		} else {
+			res.Server = status
+		}
+	}
+	g.responseWriter.WriteOK(w, res)
 }
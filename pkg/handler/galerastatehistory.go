@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/go-logr/logr"
+	agenterrors "github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/galera"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+)
+
+type GaleraStateHistory struct {
+	fileManager    *filemanager.FileManager
+	serverDetector *mariadb.ServerDetector
+	responseWriter *responsewriter.ResponseWriter
+	locker         sync.Locker
+	rlocker        sync.Locker
+	logger         *logr.Logger
+}
+
+// NewGaleraStateHistory creates the history handler. The rollbacks take locker, as they mutate the galera state,
+// whereas the listing only takes rlocker.
+func NewGaleraStateHistory(fileManager *filemanager.FileManager, serverDetector *mariadb.ServerDetector,
+	responseWriter *responsewriter.ResponseWriter, locker, rlocker sync.Locker, logger *logr.Logger) *GaleraStateHistory {
+	return &GaleraStateHistory{
+		fileManager:    fileManager,
+		serverDetector: serverDetector,
+		responseWriter: responseWriter,
+		locker:         locker,
+		rlocker:        rlocker,
+		logger:         logger,
+	}
+}
+
+func (g *GaleraStateHistory) Get(w http.ResponseWriter, r *http.Request) {
+	g.rlocker.Lock()
+	defer g.rlocker.Unlock()
+	requestLogger(g.logger, r).V(1).Info("getting galera state history")
+
+	history, err := g.fileManager.StateFileHistory(galera.GaleraStateFileName)
+	if err != nil {
+		if errors.Is(err, filemanager.ErrHistoryDisabled) {
+			g.responseWriter.Write(w, agenterrors.NewAPIError("galera state history disabled"), http.StatusNotFound)
+			return
+		}
+		g.responseWriter.WriteErrorf(w, "error getting galera state history: %v", err)
+		return
+	}
+	versions := make([]galera.GaleraStateVersion, len(history))
+	for i, version := range history {
+		versions[i] = newGaleraStateVersion(&version)
+	}
+	g.responseWriter.WriteOK(w, versions)
+}
+
+// Rollback restores a previous version of the galera state. The current one is archived first,
+// so a rollback can be undone.
+func (g *GaleraStateHistory) Rollback(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		g.responseWriter.Write(w, agenterrors.NewAPIErrorf("invalid version: %v", err), http.StatusBadRequest)
+		return
+	}
+	g.locker.Lock()
+	defer g.locker.Unlock()
+	logger := requestLogger(g.logger, r)
+	logger.V(1).Info("rolling back galera state", "version", version)
+
+	if !checkServerStopped(g.serverDetector, g.responseWriter, w, r, logger) {
+		return
+	}
+
+	stateFileVersion, err := g.fileManager.StateFileVersion(galera.GaleraStateFileName, version)
+	if err != nil {
+		if errors.Is(err, filemanager.ErrHistoryDisabled) || errors.Is(err, filemanager.ErrVersionNotFound) {
+			g.responseWriter.Write(w, agenterrors.NewAPIErrorf("galera state version %d not found", version),
+				http.StatusNotFound)
+			return
+		}
+		g.responseWriter.WriteErrorf(w, "error getting galera state version: %v", err)
+		return
+	}
+	var galeraState galera.GaleraState
+	if err := galeraState.Unmarshal([]byte(stateFileVersion.Content)); err != nil {
+		g.responseWriter.WriteErrorf(w, "error unmarshaling galera state version: %v", err)
+		return
+	}
+
+	reason := fmt.Sprintf("rollback to version %d", version)
+	tx := g.fileManager.Begin()
+	tx.ArchiveStateFile(galera.GaleraStateFileName, caller(r), reason)
+	tx.WriteStateFile(galera.GaleraStateFileName, []byte(stateFileVersion.Content))
+	if err := tx.Commit(); err != nil {
+		g.responseWriter.WriteErrorf(w, "error rolling back galera state: %v", err)
+		return
+	}
+	logger.Info("galera state rolled back", "version", version, "uuid", galeraState.UUID, "seqno", galeraState.Seqno)
+	g.responseWriter.WriteOK(w, galeraState)
+}
+
+func newGaleraStateVersion(version *filemanager.StateFileVersion) galera.GaleraStateVersion {
+	galeraStateVersion := galera.GaleraStateVersion{
+		Version:   version.Version,
+		Timestamp: version.Timestamp,
+		Caller:    version.Caller,
+		Reason:    version.Reason,
+		Content:   version.Content,
+	}
+	var galeraState galera.GaleraState
+	if err := galeraState.Unmarshal([]byte(version.Content)); err == nil {
+		galeraStateVersion.GaleraState = &galeraState
+	}
+	return galeraStateVersion
+}
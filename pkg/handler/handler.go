@@ -1,20 +1,28 @@
 package handler
 
 import (
+	"net/http"
 	"sync"
 
 	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authentication"
 	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
+	"github.com/mariadb-operator/agent/pkg/requestid"
 	"github.com/mariadb-operator/agent/pkg/responsewriter"
 )
 
 type Handler struct {
-	Bootstrap   *Bootstrap
-	GaleraState *GaleraState
-	Recovery    *Recovery
+	Bootstrap          *Bootstrap
+	GaleraState        *GaleraState
+	GaleraStateHistory *GaleraStateHistory
+	Recovery           *Recovery
 }
 
-func NewHandler(fileManager *filemanager.FileManager, logger *logr.Logger, recoveryOpts ...RecoveryOption) *Handler {
+// NewHandler creates the API handlers. When serverDetector is not nil, the galera state and config mutations
+// are rejected while mariadbd is running.
+func NewHandler(fileManager *filemanager.FileManager, serverDetector *mariadb.ServerDetector, logger *logr.Logger,
+	recoveryOpts ...RecoveryOption) *Handler {
 	mux := &sync.RWMutex{}
 	bootstrapLogger := logger.WithName("bootstrap")
 	galeraStateLogger := logger.WithName("galerastate")
@@ -22,18 +30,29 @@ func NewHandler(fileManager *filemanager.FileManager, logger *logr.Logger, recov
 
 	bootstrap := NewBootstrap(
 		fileManager,
+		serverDetector,
 		responsewriter.NewResponseWriter(&bootstrapLogger),
 		mux,
 		&bootstrapLogger,
 	)
 	galerastate := NewGaleraState(
 		fileManager,
+		serverDetector,
 		responsewriter.NewResponseWriter(&galeraStateLogger),
 		mux.RLocker(),
 		&galeraStateLogger,
 	)
+	galeraStateHistory := NewGaleraStateHistory(
+		fileManager,
+		serverDetector,
+		responsewriter.NewResponseWriter(&galeraStateLogger),
+		mux,
+		mux.RLocker(),
+		&galeraStateLogger,
+	)
 	recovery := NewRecover(
 		fileManager,
+		serverDetector,
 		responsewriter.NewResponseWriter(&recoveryLogger),
 		mux,
 		&recoveryLogger,
@@ -41,8 +60,20 @@ func NewHandler(fileManager *filemanager.FileManager, logger *logr.Logger, recov
 	)
 
 	return &Handler{
-		Bootstrap:   bootstrap,
-		GaleraState: galerastate,
-		Recovery:    recovery,
+		Bootstrap:          bootstrap,
+		GaleraState:        galerastate,
+		GaleraStateHistory: galeraStateHistory,
+		Recovery:           recovery,
 	}
 }
+
+func caller(r *http.Request) string {
+	if user, ok := authentication.UserFromContext(r.Context()); ok {
+		return user.Username
+	}
+	return ""
+}
+
+func requestLogger(logger *logr.Logger, r *http.Request) logr.Logger {
+	return logger.WithValues("requestId", requestid.FromContext(r.Context()))
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/health"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+)
+
+type Health struct {
+	checker        *health.Checker
+	responseWriter *responsewriter.ResponseWriter
+	logger         *logr.Logger
+}
+
+func NewHealth(checker *health.Checker, responseWriter *responsewriter.ResponseWriter, logger *logr.Logger) *Health {
+	return &Health{
+		checker:        checker,
+		responseWriter: responseWriter,
+		logger:         logger,
+	}
+}
+
+func (h *Health) Get(w http.ResponseWriter, r *http.Request) {
+	report := h.checker.Run(r.Context())
+	if report.Status != health.StatusOK {
+		requestLogger(h.logger, r).Info("health check failed", "checks", report.Checks)
+		h.responseWriter.WriteJSON(w, report, http.StatusServiceUnavailable)
+		return
+	}
+	h.responseWriter.WriteOK(w, report)
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/mariadb-operator/agent/pkg/health"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+)
+
+func TestHealthUnavailableLoggedOnce(t *testing.T) {
+	var logs []string
+	logger := funcr.New(func(prefix, args string) {
+		logs = append(logs, args)
+	}, funcr.Options{})
+	healthHandler := NewHealth(
+		health.NewChecker(health.WithCheck("failing", func(ctx context.Context) error {
+			return errors.New("failing")
+		})),
+		responsewriter.NewResponseWriter(&logger),
+		&logger,
+	)
+
+	rec := httptest.NewRecorder()
+	healthHandler.Get(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status code: expected %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %v", logs)
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/logger"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+	"go.uber.org/zap/zapcore"
+)
+
+type LogLevelConfig struct {
+	Level     string            `json:"level,omitempty"`
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+type LogLevel struct {
+	levels         *logger.Levels
+	responseWriter *responsewriter.ResponseWriter
+	logger         *logr.Logger
+}
+
+func NewLogLevel(levels *logger.Levels, responseWriter *responsewriter.ResponseWriter, logger *logr.Logger) *LogLevel {
+	return &LogLevel{
+		levels:         levels,
+		responseWriter: responseWriter,
+		logger:         logger,
+	}
+}
+
+func (l *LogLevel) Get(w http.ResponseWriter, r *http.Request) {
+	l.responseWriter.WriteOK(w, l.config())
+}
+
+// Put sets the level when provided and replaces the overrides when provided.
+func (l *LogLevel) Put(w http.ResponseWriter, r *http.Request) {
+	var config LogLevelConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		l.responseWriter.Write(w, errors.NewAPIErrorf("error decoding log level: %v", err), http.StatusBadRequest)
+		return
+	}
+	var level *zapcore.Level
+	if config.Level != "" {
+		lvl, err := logger.ParseLevel(config.Level)
+		if err != nil {
+			l.responseWriter.Write(w, errors.NewAPIError(err.Error()), http.StatusBadRequest)
+			return
+		}
+		level = &lvl
+	}
+	var overrides map[string]zapcore.Level
+	if config.Overrides != nil {
+		overrides = make(map[string]zapcore.Level, len(config.Overrides))
+		for name, overrideLevel := range config.Overrides {
+			lvl, err := logger.ParseLevel(overrideLevel)
+			if err != nil {
+				l.responseWriter.Write(w, errors.NewAPIErrorf("override '%s': %v", name, err), http.StatusBadRequest)
+				return
+			}
+			overrides[name] = lvl
+		}
+	}
+
+	if level != nil {
+		l.levels.SetLevel(*level)
+	}
+	if overrides != nil {
+		l.levels.SetOverrides(overrides)
+	}
+	config = l.config()
+	l.logger.Info("log level changed", "level", config.Level, "overrides", config.Overrides)
+	l.responseWriter.WriteOK(w, config)
+}
+
+func (l *LogLevel) Delete(w http.ResponseWriter, r *http.Request) {
+	l.levels.Reset()
+	config := l.config()
+	l.logger.Info("log level reset", "level", config.Level)
+	l.responseWriter.WriteOK(w, config)
+}
+
+func (l *LogLevel) config() LogLevelConfig {
+	config := LogLevelConfig{
+		Level:     l.levels.Level().String(),
+		Overrides: make(map[string]string),
+	}
+	for name, lvl := range l.levels.Overrides() {
+		config.Overrides[name] = lvl.String()
+	}
+	return config
+}
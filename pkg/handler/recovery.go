@@ -1,8 +1,14 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
+	"io/fs"
 	"net/http"
 	"os"
 	"sync"
@@ -11,17 +17,25 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/mariadb-operator/agent/pkg/errors"
 	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/filesystem"
 	"github.com/mariadb-operator/agent/pkg/galera"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
 	"github.com/mariadb-operator/agent/pkg/responsewriter"
-	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	recoveredPositionMarker = "WSREP: Recovered position:"
 )
 
 type Recovery struct {
 	fileManager    *filemanager.FileManager
+	serverDetector *mariadb.ServerDetector
 	responseWriter *responsewriter.ResponseWriter
 	locker         sync.Locker
 	logger         *logr.Logger
 	timeout        time.Duration
+	pollInterval   time.Duration
+	wsrepRecover   *mariadb.WsrepRecover
 }
 
 type RecoveryOption func(*Recovery)
@@ -32,14 +46,33 @@ func WithRecoveryTimeout(timeout time.Duration) RecoveryOption {
 	}
 }
 
-func NewRecover(fileManager *filemanager.FileManager, responseWriter *responsewriter.ResponseWriter, locker sync.Locker,
-	logger *logr.Logger, opts ...RecoveryOption) *Recovery {
+// WithRecoveryPollInterval sets how often the recovery log is read when no change is notified,
+// or always when the state directory cannot be watched. Non-positive intervals are ignored, keeping the default.
+func WithRecoveryPollInterval(interval time.Duration) RecoveryOption {
+	return func(r *Recovery) {
+		if interval > 0 {
+			r.pollInterval = interval
+		}
+	}
+}
+
+// WithWsrepRecover enables running the recovery by the agent itself, without restarting the container.
+func WithWsrepRecover(wsrepRecover *mariadb.WsrepRecover) RecoveryOption {
+	return func(r *Recovery) {
+		r.wsrepRecover = wsrepRecover
+	}
+}
+
+func NewRecover(fileManager *filemanager.FileManager, serverDetector *mariadb.ServerDetector,
+	responseWriter *responsewriter.ResponseWriter, locker sync.Locker, logger *logr.Logger, opts ...RecoveryOption) *Recovery {
 	recovery := &Recovery{
 		fileManager:    fileManager,
+		serverDetector: serverDetector,
 		responseWriter: responseWriter,
 		locker:         locker,
 		logger:         logger,
 		timeout:        1 * time.Minute,
+		pollInterval:   1 * time.Second,
 	}
 	for _, setOpts := range opts {
 		setOpts(recovery)
@@ -50,20 +83,24 @@ func NewRecover(fileManager *filemanager.FileManager, responseWriter *responsewr
 func (r *Recovery) Put(w http.ResponseWriter, req *http.Request) {
 	r.locker.Lock()
 	defer r.locker.Unlock()
-	r.logger.V(1).Info("enabling recovery")
+	logger := requestLogger(r.logger, req)
+	logger.V(1).Info("enabling recovery")
 
-	if err := r.fileManager.DeleteConfigFile(galera.BootstrapFileName); err != nil && !os.IsNotExist(err) {
-		r.responseWriter.WriteErrorf(w, "error deleting existing bootstrap config: %v", err)
+	if !checkServerStopped(r.serverDetector, r.responseWriter, w, req, logger) {
 		return
 	}
 
+	// The recovery log is not part of the transaction: it can be large and it is safe to delete it on its own.
 	if err := r.fileManager.DeleteStateFile(galera.RecoveryLogFileName); err != nil && !os.IsNotExist(err) {
 		r.responseWriter.WriteErrorf(w, "error deleting existing recovery log: %v", err)
 		return
 	}
 
-	if err := r.fileManager.WriteConfigFile(galera.RecoveryFileName, []byte(galera.RecoveryFile)); err != nil {
-		r.responseWriter.WriteErrorf(w, "error writing recovery config: %v", err)
+	tx := r.fileManager.Begin()
+	tx.DeleteConfigFile(galera.BootstrapFileName)
+	tx.WriteConfigFile(galera.RecoveryFileName, []byte(galera.RecoveryFile))
+	if err := tx.Commit(); err != nil {
+		r.responseWriter.WriteErrorf(w, "error enabling recovery: %v", err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
@@ -72,7 +109,8 @@ func (r *Recovery) Put(w http.ResponseWriter, req *http.Request) {
 func (r *Recovery) Post(w http.ResponseWriter, req *http.Request) {
 	r.locker.Lock()
 	defer r.locker.Unlock()
-	r.logger.V(1).Info("starting recovery")
+	logger := requestLogger(r.logger, req)
+	logger.V(1).Info("starting recovery")
 
 	exists, err := r.fileManager.ConfigFileExists(galera.RecoveryFileName)
 	if err != nil {
@@ -87,18 +125,100 @@ func (r *Recovery) Post(w http.ResponseWriter, req *http.Request) {
 	recoveryCtx, cancel := context.WithTimeout(req.Context(), r.timeout)
 	defer cancel()
 
-	bootstrap, err := r.pollUntilRecovered(recoveryCtx)
+	bootstrap, logHash, err := r.pollUntilRecovered(recoveryCtx, logger)
 	if err != nil {
 		r.responseWriter.WriteErrorf(w, "error recovering galera: %v", err)
 		return
 	}
+	if err := r.saveResult(bootstrap, logHash); err != nil {
+		logger.Error(err, "error saving recovery result")
+	}
 	r.responseWriter.WriteOK(w, bootstrap)
 }
 
+// Run recovers the galera position by running mariadbd with --wsrep-recover as a subprocess of the agent.
+func (r *Recovery) Run(w http.ResponseWriter, req *http.Request) {
+	if r.wsrepRecover == nil {
+		r.responseWriter.Write(w, errors.NewAPIError("agent recovery disabled"), http.StatusNotFound)
+		return
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	logger := requestLogger(r.logger, req)
+	logger.V(1).Info("running recovery")
+
+	if !requireServerStopped(r.serverDetector, r.responseWriter, w, req, logger) {
+		return
+	}
+	if err := r.fileManager.DeleteStateFile(galera.RecoveryLogFileName); err != nil && !os.IsNotExist(err) {
+		r.responseWriter.WriteErrorf(w, "error deleting existing recovery log: %v", err)
+		return
+	}
+
+	recoveryCtx, cancel := context.WithTimeout(req.Context(), r.timeout)
+	defer cancel()
+
+	if err := r.wsrepRecover.Run(recoveryCtx); err != nil {
+		r.responseWriter.WriteErrorf(w, "error recovering galera: %v", err)
+		return
+	}
+	bootstrap, logHash, err := r.recover()
+	if err != nil {
+		r.responseWriter.WriteErrorf(w, "error recovering galera: %v", err)
+		return
+	}
+	logger.Info("galera recovered", "uuid", bootstrap.UUID, "seqno", bootstrap.Seqno)
+	if err := r.saveResult(bootstrap, logHash); err != nil {
+		logger.Error(err, "error saving recovery result")
+	}
+	r.responseWriter.WriteOK(w, bootstrap)
+}
+
+// Result returns the last recovered position, as long as grastate.dat has not changed since it was recovered.
+// It allows to resume a cluster recovery without recovering the node again.
+func (r *Recovery) Result(w http.ResponseWriter, req *http.Request) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	logger := requestLogger(r.logger, req)
+	logger.V(1).Info("getting recovery result")
+
+	bytes, err := r.fileManager.ReadStateFile(galera.RecoveryResultFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			r.responseWriter.Write(w, errors.NewAPIError("recovery result not found"), http.StatusNotFound)
+			return
+		}
+		r.responseWriter.WriteErrorf(w, "error reading recovery result: %v", err)
+		return
+	}
+	var result galera.RecoveryResult
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		r.responseWriter.WriteErrorf(w, "error unmarshaling recovery result: %v", err)
+		return
+	}
+
+	galeraStateHash, galeraStateModTime, err := r.galeraStateVersion()
+	if err != nil {
+		r.responseWriter.WriteErrorf(w, "error reading galera state: %v", err)
+		return
+	}
+	if result.GaleraStateHash != galeraStateHash || !equalTime(result.GaleraStateModTime, galeraStateModTime) {
+		logger.Info("galera state changed after recovery, discarding recovery result",
+			"uuid", result.UUID, "seqno", result.Seqno)
+		if err := r.fileManager.DeleteStateFile(galera.RecoveryResultFileName); err != nil && !os.IsNotExist(err) {
+			r.responseWriter.WriteErrorf(w, "error deleting recovery result: %v", err)
+			return
+		}
+		r.responseWriter.Write(w, errors.NewAPIError("recovery result not found"), http.StatusNotFound)
+		return
+	}
+	r.responseWriter.WriteOK(w, result)
+}
+
 func (r *Recovery) Delete(w http.ResponseWriter, req *http.Request) {
 	r.locker.Lock()
 	defer r.locker.Unlock()
-	r.logger.V(1).Info("disabling recovery")
+	requestLogger(r.logger, req).V(1).Info("disabling recovery")
 
 	if err := r.fileManager.DeleteConfigFile(galera.RecoveryFileName); err != nil {
 		if os.IsNotExist(err) {
@@ -111,30 +231,168 @@ func (r *Recovery) Delete(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (r *Recovery) pollUntilRecovered(ctx context.Context) (*galera.Bootstrap, error) {
-	var bootstrap *galera.Bootstrap
-	err := wait.PollUntilContextCancel(ctx, 1*time.Second, true, func(context.Context) (bool, error) {
-		b, err := r.recover()
+// pollUntilRecovered reads the recovery log whenever it changes, or every poll interval as a fallback,
+// until the recovered position is found.
+func (r *Recovery) pollUntilRecovered(ctx context.Context, logger logr.Logger) (*galera.Bootstrap, string, error) {
+	events, err := r.fileManager.WatchStateFile(ctx, galera.RecoveryLogFileName)
+	if err != nil {
+		logger.V(1).Info("unable to watch recovery log, polling", "err", err)
+	}
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	recoveryLog := newRecoveryLog(r.fileManager)
+	for {
+		bootstrap, err := recoveryLog.recover()
 		if err != nil {
-			r.logger.Error(err, "error recovering galera from recovery log")
-			return false, nil
+			logger.Error(err, "error recovering galera from recovery log")
+		}
+		if bootstrap != nil {
+			return bootstrap, recoveryLog.hash(), nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-events:
+		case <-ticker.C:
 		}
-		bootstrap = b
-		return true, nil
-	})
-	if err != nil {
-		return nil, err
 	}
-	return bootstrap, nil
 }
 
-func (r *Recovery) recover() (*galera.Bootstrap, error) {
+// recover parses the recovered position from the whole recovery log, returning it along with the log hash.
+func (r *Recovery) recover() (*galera.Bootstrap, string, error) {
 	bytes, err := r.fileManager.ReadStateFile(galera.RecoveryLogFileName)
 	if err != nil {
-		return nil, fmt.Errorf("error reading Galera state file: %v", err)
+		return nil, "", fmt.Errorf("error reading Galera state file: %v", err)
 	}
 	var bootstrap galera.Bootstrap
 	if err := bootstrap.Unmarshal(bytes); err != nil {
+		return nil, "", fmt.Errorf("error unmarshaling bootstrap: %v", err)
+	}
+	return &bootstrap, hashBytes(bytes), nil
+}
+
+// saveResult persists the recovered position, along with the grastate.dat it was recovered with.
+func (r *Recovery) saveResult(bootstrap *galera.Bootstrap, logHash string) error {
+	galeraStateHash, galeraStateModTime, err := r.galeraStateVersion()
+	if err != nil {
+		return fmt.Errorf("error reading galera state: %v", err)
+	}
+	result := galera.RecoveryResult{
+		Bootstrap:          *bootstrap,
+		Timestamp:          time.Now().UTC(),
+		LogHash:            logHash,
+		GaleraStateHash:    galeraStateHash,
+		GaleraStateModTime: galeraStateModTime,
+	}
+	bytes, err := json.Marshal(&result)
+	if err != nil {
+		return fmt.Errorf("error marshaling recovery result: %v", err)
+	}
+	if err := r.fileManager.WriteStateFile(galera.RecoveryResultFileName, bytes); err != nil {
+		return fmt.Errorf("error writing recovery result: %v", err)
+	}
+	return nil
+}
+
+// galeraStateVersion returns the hash and modification time of grastate.dat, or zero values when it does not exist.
+// mariadbd rewrites grastate.dat when it starts, so the modification time changes even if the content ends up being
+// the same as before.
+func (r *Recovery) galeraStateVersion() (string, *time.Time, error) {
+	info, err := r.fileManager.StatStateFile(galera.GaleraStateFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	bytes, err := r.fileManager.ReadStateFile(galera.GaleraStateFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	modTime := info.ModTime().UTC()
+	return hashBytes(bytes), &modTime, nil
+}
+
+func equalTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func hashBytes(bytes []byte) string {
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// recoveryLog reads the recovery log incrementally, so a large log is read only once while it is being written.
+type recoveryLog struct {
+	fileManager *filemanager.FileManager
+	info        fs.FileInfo
+	offset      int64
+	partialLine []byte
+	hasher      hash.Hash
+}
+
+func newRecoveryLog(fileManager *filemanager.FileManager) *recoveryLog {
+	return &recoveryLog{
+		fileManager: fileManager,
+		hasher:      sha256.New(),
+	}
+}
+
+// hash returns the SHA-256 of the recovery log read so far.
+func (l *recoveryLog) hash() string {
+	return hex.EncodeToString(l.hasher.Sum(nil))
+}
+
+// reset starts reading the recovery log from the beginning.
+func (l *recoveryLog) reset() {
+	l.offset = 0
+	l.partialLine = nil
+	l.hasher.Reset()
+}
+
+// recover returns the recovered position, or nil when it has not been logged yet. The log is read again from the
+// beginning when it has been truncated or replaced by a new one, for example when mariadbd is restarted.
+func (l *recoveryLog) recover() (*galera.Bootstrap, error) {
+	info, err := l.fileManager.StatStateFile(galera.RecoveryLogFileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting recovery log info: %v", err)
+	}
+	if l.info != nil && (info.Size() < l.offset || !filesystem.SameFile(info, l.info)) {
+		l.reset()
+	}
+	l.info = info
+
+	data, err := l.fileManager.ReadStateFileFrom(galera.RecoveryLogFileName, l.offset)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading recovery log: %v", err)
+	}
+	l.offset += int64(len(data))
+	l.hasher.Write(data) //nolint:errcheck
+
+	// Only complete lines are parsed, the last one may still be being written.
+	text := append(l.partialLine, data...)
+	end := bytes.LastIndexByte(text, '\n') + 1
+	lines := text[:end]
+	l.partialLine = append([]byte(nil), text[end:]...)
+
+	if !bytes.Contains(lines, []byte(recoveredPositionMarker)) {
+		return nil, nil
+	}
+	var bootstrap galera.Bootstrap
+	if err := bootstrap.Unmarshal(lines); err != nil {
 		return nil, fmt.Errorf("error unmarshaling bootstrap: %v", err)
 	}
 	return &bootstrap, nil
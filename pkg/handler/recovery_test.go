@@ -0,0 +1,412 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+	"github.com/mariadb-operator/agent/pkg/galera"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
+	"github.com/mariadb-operator/agent/pkg/mariadb/mariadbtest"
+)
+
+func TestRecoveryRun(t *testing.T) {
+	binary := mariadbtest.NewFakeMariaDB(t,
+		`echo "[Note] WSREP: Recovered position: 05f061bd-02a3-11ee-857c-aa370ff6666b:42" > "$log"`)
+
+	tests := []struct {
+		name         string
+		wsrepRecover bool
+		noDetector   bool
+		running      bool
+		pidFile      string
+		target       string
+		wantStatus   int
+		wantSeqno    int
+	}{
+		{
+			name:         "disabled",
+			wsrepRecover: false,
+			target:       "/api/recovery/run",
+			wantStatus:   http.StatusNotFound,
+		},
+		{
+			name:         "recovered",
+			wsrepRecover: true,
+			target:       "/api/recovery/run",
+			wantStatus:   http.StatusOK,
+			wantSeqno:    42,
+		},
+		{
+			name:         "running",
+			wsrepRecover: true,
+			running:      true,
+			target:       "/api/recovery/run",
+			wantStatus:   http.StatusConflict,
+		},
+		{
+			name:         "forced while running",
+			wsrepRecover: true,
+			running:      true,
+			target:       "/api/recovery/run?force=true",
+			wantStatus:   http.StatusConflict,
+		},
+		{
+			name:         "pid file not visible in process table",
+			wsrepRecover: true,
+			pidFile:      "42",
+			target:       "/api/recovery/run",
+			wantStatus:   http.StatusConflict,
+		},
+		{
+			name:         "detection disabled",
+			wsrepRecover: true,
+			noDetector:   true,
+			target:       "/api/recovery/run",
+			wantStatus:   http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateDir := t.TempDir()
+			fileManager, err := filemanager.NewFileManager(t.TempDir(), stateDir)
+			if err != nil {
+				t.Fatalf("error creating file manager: %v", err)
+			}
+			if err := fileManager.WriteStateFile(galera.RecoveryLogFileName, []byte("stale log")); err != nil {
+				t.Fatalf("error writing recovery log: %v", err)
+			}
+			var wsrepRecover *mariadb.WsrepRecover
+			if tt.wsrepRecover {
+				wsrepRecover = mariadb.NewWsrepRecover(
+					stateDir,
+					filepath.Join(stateDir, galera.RecoveryLogFileName),
+					mariadb.WithWsrepRecoverBinary(binary),
+				)
+			}
+			var detector *mariadb.ServerDetector
+			if !tt.noDetector {
+				procDir := t.TempDir()
+				if err := os.MkdirAll(filepath.Join(procDir, "self"), 0755); err != nil {
+					t.Fatalf("error creating process directory: %v", err)
+				}
+				if err := os.WriteFile(filepath.Join(procDir, "self", "cgroup"), []byte("0::/\n"), 0644); err != nil {
+					t.Fatalf("error writing process cgroup: %v", err)
+				}
+				if tt.running {
+					if err := os.MkdirAll(filepath.Join(procDir, "42"), 0755); err != nil {
+						t.Fatalf("error creating process directory: %v", err)
+					}
+					if err := os.WriteFile(filepath.Join(procDir, "42", "comm"), []byte("mariadbd\n"), 0644); err != nil {
+						t.Fatalf("error writing process name: %v", err)
+					}
+				}
+				opts := []mariadb.ServerDetectorOption{mariadb.WithProcessTable(procDir)}
+				if tt.pidFile != "" {
+					// mariadbd runs in another process namespace, its pid is not visible in the process table.
+					pidFile := filepath.Join(stateDir, "mariadb.pid")
+					if err := os.WriteFile(pidFile, []byte(tt.pidFile+"\n"), 0644); err != nil {
+						t.Fatalf("error writing pid file: %v", err)
+					}
+					opts = append(opts, mariadb.WithPIDFile(pidFile))
+				}
+				detector = mariadb.NewServerDetector(opts...)
+			}
+			logger := logr.Discard()
+			handler := NewHandler(fileManager, detector, &logger, WithWsrepRecover(wsrepRecover))
+
+			rec := httptest.NewRecorder()
+			handler.Recovery.Run(rec, httptest.NewRequest(http.MethodPost, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("unexpected status code: expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var bootstrap galera.Bootstrap
+			if err := json.NewDecoder(rec.Body).Decode(&bootstrap); err != nil {
+				t.Fatalf("error decoding bootstrap: %v", err)
+			}
+			if bootstrap.Seqno != tt.wantSeqno {
+				t.Fatalf("unexpected seqno: expected %d, got %d", tt.wantSeqno, bootstrap.Seqno)
+			}
+		})
+	}
+}
+
+func TestRecoveryPostWatch(t *testing.T) {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{testConfigDir, testStateDir} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	fileManager, err := filemanager.NewFileManager(testConfigDir, testStateDir, filemanager.WithFS(memory))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	logger := logr.Discard()
+	// The poll interval is long enough for the test to time out if the recovery log was not watched.
+	handler := NewHandler(fileManager, nil, &logger, WithRecoveryTimeout(10*time.Second), WithRecoveryPollInterval(time.Hour))
+
+	rec := httptest.NewRecorder()
+	handler.Recovery.Put(rec, httptest.NewRequest(http.MethodPut, "/api/recovery", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code enabling recovery: %d", rec.Code)
+	}
+
+	recoveryLog := filepath.Join(testStateDir, galera.RecoveryLogFileName)
+	go func() {
+		for _, chunk := range []string{
+			strings.Repeat("[Note] InnoDB: starting\n", 1000),
+			"[Note] WSREP: Recovered position: 05f061bd-02a3-11ee-857c-aa370ff6666b",
+			":42\n",
+		} {
+			time.Sleep(50 * time.Millisecond)
+			memory.AppendFile(recoveryLog, []byte(chunk), 0644) //nolint:errcheck
+		}
+	}()
+
+	start := time.Now()
+	rec = httptest.NewRecorder()
+	handler.Recovery.Post(rec, httptest.NewRequest(http.MethodPost, "/api/recovery", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code starting recovery: %d", rec.Code)
+	}
+	var bootstrap galera.Bootstrap
+	if err := json.NewDecoder(rec.Body).Decode(&bootstrap); err != nil {
+		t.Fatalf("error decoding bootstrap: %v", err)
+	}
+	if bootstrap.Seqno != 42 {
+		t.Fatalf("unexpected seqno: expected 42, got %d", bootstrap.Seqno)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected recovery to be detected on write, took %v", elapsed)
+	}
+}
+
+func TestRecoveryPostInvalidPollInterval(t *testing.T) {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{testConfigDir, testStateDir} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	fileManager, err := filemanager.NewFileManager(testConfigDir, testStateDir, filemanager.WithFS(memory))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	logger := logr.Discard()
+	// A non-positive poll interval would make the ticker panic, the default is kept instead.
+	handler := NewHandler(fileManager, nil, &logger, WithRecoveryTimeout(10*time.Second), WithRecoveryPollInterval(0))
+
+	rec := httptest.NewRecorder()
+	handler.Recovery.Put(rec, httptest.NewRequest(http.MethodPut, "/api/recovery", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code enabling recovery: %d", rec.Code)
+	}
+	log := []byte("[Note] WSREP: Recovered position: 05f061bd-02a3-11ee-857c-aa370ff6666b:42\n")
+	if err := memory.WriteFile(filepath.Join(testStateDir, galera.RecoveryLogFileName), log, 0644); err != nil {
+		t.Fatalf("error writing recovery log: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.Recovery.Post(rec, httptest.NewRequest(http.MethodPost, "/api/recovery", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code starting recovery: %d", rec.Code)
+	}
+}
+
+func TestRecoveryResult(t *testing.T) {
+	recoveryLog := "[Note] WSREP: Recovered position: 05f061bd-02a3-11ee-857c-aa370ff6666b:42\n"
+	galeraState := "version: 2.1\nuuid: 05f061bd-02a3-11ee-857c-aa370ff6666b\nseqno: -1\nsafe_to_bootstrap: 0"
+
+	tests := []struct {
+		name       string
+		recover    bool
+		update     func(t *testing.T, memory *filesystem.Memory)
+		wantStatus int
+	}{
+		{
+			name:       "not recovered",
+			recover:    false,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "recovered",
+			recover:    true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "galera state changed",
+			recover: true,
+			update: func(t *testing.T, memory *filesystem.Memory) {
+				changed := strings.Replace(galeraState, "safe_to_bootstrap: 0", "safe_to_bootstrap: 1", 1)
+				if err := memory.WriteFile(filepath.Join(testStateDir, galera.GaleraStateFileName), []byte(changed), 0644); err != nil {
+					t.Fatalf("error writing galera state: %v", err)
+				}
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:    "galera state rewritten",
+			recover: true,
+			update: func(t *testing.T, memory *filesystem.Memory) {
+				time.Sleep(10 * time.Millisecond)
+				if err := memory.WriteFile(filepath.Join(testStateDir, galera.GaleraStateFileName), []byte(galeraState), 0644); err != nil {
+					t.Fatalf("error writing galera state: %v", err)
+				}
+			},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := filesystem.NewMemory()
+			for _, dir := range []string{testConfigDir, testStateDir} {
+				if err := memory.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("error creating directory: %v", err)
+				}
+			}
+			if err := memory.WriteFile(filepath.Join(testStateDir, galera.GaleraStateFileName), []byte(galeraState), 0644); err != nil {
+				t.Fatalf("error writing galera state: %v", err)
+			}
+			fileManager, err := filemanager.NewFileManager(testConfigDir, testStateDir, filemanager.WithFS(memory))
+			if err != nil {
+				t.Fatalf("error creating file manager: %v", err)
+			}
+			logger := logr.Discard()
+			handler := NewHandler(fileManager, nil, &logger)
+
+			if tt.recover {
+				if err := fileManager.WriteConfigFile(galera.RecoveryFileName, []byte(galera.RecoveryFile)); err != nil {
+					t.Fatalf("error writing recovery config: %v", err)
+				}
+				if err := fileManager.WriteStateFile(galera.RecoveryLogFileName, []byte(recoveryLog)); err != nil {
+					t.Fatalf("error writing recovery log: %v", err)
+				}
+				rec := httptest.NewRecorder()
+				handler.Recovery.Post(rec, httptest.NewRequest(http.MethodPost, "/api/recovery", nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("unexpected status code starting recovery: %d", rec.Code)
+				}
+			}
+			if tt.update != nil {
+				tt.update(t, memory)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.Recovery.Result(rec, httptest.NewRequest(http.MethodGet, "/api/recovery/result", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("unexpected status code: expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+			_, statErr := fileManager.StatStateFile(galera.RecoveryResultFileName)
+			if tt.wantStatus != http.StatusOK {
+				if !os.IsNotExist(statErr) {
+					t.Fatalf("expected recovery result to be deleted, got %v", statErr)
+				}
+				return
+			}
+			var result galera.RecoveryResult
+			if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+				t.Fatalf("error decoding recovery result: %v", err)
+			}
+			if result.Seqno != 42 || result.UUID != "05f061bd-02a3-11ee-857c-aa370ff6666b" {
+				t.Fatalf("unexpected recovered position: %s:%d", result.UUID, result.Seqno)
+			}
+			if result.LogHash != hashBytes([]byte(recoveryLog)) {
+				t.Fatalf("unexpected log hash: %s", result.LogHash)
+			}
+			if result.Timestamp.IsZero() {
+				t.Fatal("expected recovery timestamp to be set")
+			}
+		})
+	}
+}
+
+func TestRecoveryLog(t *testing.T) {
+	uuid := "05f061bd-02a3-11ee-857c-aa370ff6666b"
+	startingLog := strings.Repeat("[Note] InnoDB: starting\n", 100)
+	recoveredLog := "[Note] WSREP: Recovered position: " + uuid + ":42\n"
+
+	tests := []struct {
+		name  string
+		write func(memory *filesystem.Memory, path string) error
+	}{
+		{
+			name: "appended",
+			write: func(memory *filesystem.Memory, path string) error {
+				return memory.AppendFile(path, []byte(recoveredLog), 0644)
+			},
+		},
+		{
+			name: "truncated",
+			write: func(memory *filesystem.Memory, path string) error {
+				if err := memory.WriteFile(path, nil, 0644); err != nil {
+					return err
+				}
+				return memory.AppendFile(path, []byte(recoveredLog), 0644)
+			},
+		},
+		{
+			name: "replaced",
+			write: func(memory *filesystem.Memory, path string) error {
+				if err := memory.WriteFile(path, []byte(strings.Repeat("[Note] InnoDB: restarting\n", 100)), 0644); err != nil {
+					return err
+				}
+				return memory.AppendFile(path, []byte(recoveredLog), 0644)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := filesystem.NewMemory()
+			for _, dir := range []string{testConfigDir, testStateDir} {
+				if err := memory.MkdirAll(dir, 0755); err != nil {
+					t.Fatalf("error creating directory: %v", err)
+				}
+			}
+			fileManager, err := filemanager.NewFileManager(testConfigDir, testStateDir, filemanager.WithFS(memory))
+			if err != nil {
+				t.Fatalf("error creating file manager: %v", err)
+			}
+			path := filepath.Join(testStateDir, galera.RecoveryLogFileName)
+			if err := memory.WriteFile(path, []byte(startingLog), 0644); err != nil {
+				t.Fatalf("error writing recovery log: %v", err)
+			}
+
+			recoveryLog := newRecoveryLog(fileManager)
+			if bootstrap, err := recoveryLog.recover(); err != nil || bootstrap != nil {
+				t.Fatalf("unexpected recovery before the position was logged: %v, %v", bootstrap, err)
+			}
+			if err := tt.write(memory, path); err != nil {
+				t.Fatalf("error writing recovery log: %v", err)
+			}
+			bootstrap, err := recoveryLog.recover()
+			if err != nil {
+				t.Fatalf("error recovering: %v", err)
+			}
+			if bootstrap == nil || bootstrap.UUID != uuid || bootstrap.Seqno != 42 {
+				t.Fatalf("unexpected recovered position: %v", bootstrap)
+			}
+			log, err := memory.ReadFile(path)
+			if err != nil {
+				t.Fatalf("error reading recovery log: %v", err)
+			}
+			if hash := recoveryLog.hash(); hash != hashBytes(log) {
+				t.Fatalf("unexpected log hash: expected %s, got %s", hashBytes(log), hash)
+			}
+		})
+	}
+}
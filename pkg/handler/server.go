@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	agenterrors "github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+)
+
+const (
+	forceParam = "force"
+)
+
+// checkServerStopped returns whether the request may mutate the galera state and config. Otherwise, it writes a
+// 409 Conflict when mariadbd is running, as it would overwrite the changes or pick them up in an inconsistent state.
+// The check is skipped when the detector is nil or the request sets the force query parameter.
+func checkServerStopped(detector *mariadb.ServerDetector, responseWriter *responsewriter.ResponseWriter,
+	w http.ResponseWriter, r *http.Request, logger logr.Logger) bool {
+	force, err := forced(r)
+	if err != nil {
+		responseWriter.Write(w, agenterrors.NewAPIErrorf("invalid %s parameter: %v", forceParam, err), http.StatusBadRequest)
+		return false
+	}
+	if detector == nil {
+		return true
+	}
+	if force {
+		logger.Info("skipping mariadbd running check", "caller", caller(r))
+		return true
+	}
+	return checkServerStatus(detector, responseWriter, w, r,
+		fmt.Sprintf("stop it or set the %s parameter to proceed anyway", forceParam))
+}
+
+// requireServerStopped is like checkServerStopped, but the check can neither be forced nor skipped. It guards the
+// operations that start mariadbd themselves, which would run a second mariadbd against the live datadir.
+func requireServerStopped(detector *mariadb.ServerDetector, responseWriter *responsewriter.ResponseWriter,
+	w http.ResponseWriter, r *http.Request, logger logr.Logger) bool {
+	if force, err := forced(r); err == nil && force {
+		logger.Info("ignoring force parameter, mariadbd must be stopped", "caller", caller(r))
+	}
+	if detector == nil {
+		responseWriter.Write(w, agenterrors.NewAPIError("unable to check whether mariadbd is running, mariadbd "+
+			"detection is disabled"), http.StatusConflict)
+		return false
+	}
+	return checkServerStatus(detector, responseWriter, w, r, "stop it to proceed")
+}
+
+func checkServerStatus(detector *mariadb.ServerDetector, responseWriter *responsewriter.ResponseWriter,
+	w http.ResponseWriter, r *http.Request, hint string) bool {
+	status, err := detector.Status(r.Context())
+	if err != nil {
+		responseWriter.WriteErrorf(w, "error detecting mariadbd state: %v", err)
+		return false
+	}
+	if status.Running() {
+		responseWriter.Write(
+			w,
+			agenterrors.NewAPIErrorf("mariadbd is running (%s), %s", describeServer(status), hint),
+			http.StatusConflict,
+		)
+		return false
+	}
+	return true
+}
+
+func forced(r *http.Request) (bool, error) {
+	force := r.URL.Query().Get(forceParam)
+	if force == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(force)
+}
+
+func describeServer(status *mariadb.ServerStatus) string {
+	if status.PID > 0 {
+		return fmt.Sprintf("pid %d detected by %s", status.PID, status.DetectedBy)
+	}
+	return fmt.Sprintf("detected by %s", status.DetectedBy)
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/galera"
+	"github.com/mariadb-operator/agent/pkg/mariadb"
+)
+
+func TestServerRunning(t *testing.T) {
+	fsys := newTestFS(t)
+	pidFile := testStateDir + "/mariadb.pid"
+	fileManager, err := filemanager.NewFileManager(testConfigDir, testStateDir, filemanager.WithFS(fsys))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	if err := fileManager.WriteStateFile("mariadb.pid", []byte("42")); err != nil {
+		t.Fatalf("error writing pid file: %v", err)
+	}
+	detector := mariadb.NewServerDetector(mariadb.WithPIDFile(pidFile), mariadb.WithFS(fsys))
+	logger := logr.Discard()
+	handler := NewHandler(fileManager, detector, &logger)
+
+	body, err := json.Marshal(&galera.Bootstrap{
+		UUID:  "05f061bd-02a3-11ee-857c-aa370ff6666b",
+		Seqno: 2,
+	})
+	if err != nil {
+		t.Fatalf("error marshaling bootstrap: %v", err)
+	}
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		target     string
+		body       []byte
+		wantStatus int
+	}{
+		{
+			name:       "bootstrap",
+			handler:    handler.Bootstrap.Put,
+			method:     http.MethodPut,
+			target:     "/api/bootstrap",
+			body:       body,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "recovery",
+			handler:    handler.Recovery.Put,
+			method:     http.MethodPut,
+			target:     "/api/recovery",
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "invalid force",
+			handler:    handler.Recovery.Put,
+			method:     http.MethodPut,
+			target:     "/api/recovery?force=foo",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "forced bootstrap",
+			handler:    handler.Bootstrap.Put,
+			method:     http.MethodPut,
+			target:     "/api/bootstrap?force=true",
+			body:       body,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "forced recovery",
+			handler:    handler.Recovery.Put,
+			method:     http.MethodPut,
+			target:     "/api/recovery?force=true",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(tt.method, tt.target, bytes.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("unexpected status code: expected %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handler.GaleraState.Get(rec, httptest.NewRequest(http.MethodGet, "/api/galerastate", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: expected %d, got %d", http.StatusOK, rec.Code)
+	}
+	var galeraState GaleraStateResponse
+	if err := json.NewDecoder(rec.Body).Decode(&galeraState); err != nil {
+		t.Fatalf("error decoding galera state: %v", err)
+	}
+	if galeraState.Server == nil || !galeraState.Server.Running() || galeraState.Server.PID != 42 {
+		t.Fatalf("unexpected server status: %+v", galeraState.Server)
+	}
+}
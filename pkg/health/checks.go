@@ -0,0 +1,104 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DirCheck verifies that a directory is readable and writable by creating and deleting a temporary file.
+// It should be given the FS used to manage the config and state files, so it checks them the same way.
+func DirCheck(fsys filesystem.FS, dir string) CheckFunc {
+	return func(ctx context.Context) error {
+		if _, err := fsys.ReadDir(dir); err != nil {
+			return fmt.Errorf("error reading directory: %v", err)
+		}
+		file, err := fsys.CreateTemp(dir, ".agent-health-*")
+		if err != nil {
+			return fmt.Errorf("error writing directory: %v", err)
+		}
+		name := file.Name()
+		_, writeErr := file.Write([]byte("ok"))
+		closeErr := file.Close()
+		removeErr := fsys.Remove(name)
+		if err := errors.Join(writeErr, closeErr, removeErr); err != nil {
+			return fmt.Errorf("error writing directory: %v", err)
+		}
+		return nil
+	}
+}
+
+// KubernetesCheck verifies that the Kubernetes API server is reachable.
+func KubernetesCheck(clientset func() (kubernetes.Interface, error)) CheckFunc {
+	return func(ctx context.Context) error {
+		c, err := clientset()
+		if err != nil {
+			return fmt.Errorf("error getting clientset: %v", err)
+		}
+		if err := c.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error(); err != nil {
+			return fmt.Errorf("error reaching API server: %v", err)
+		}
+		return nil
+	}
+}
+
+// TLSCertCheck verifies that the certificate can be loaded with its key and that it is currently valid.
+func TLSCertCheck(certFile, keyFile string) CheckFunc {
+	return func(ctx context.Context) error {
+		keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("error loading certificate: %v", err)
+		}
+		if len(keyPair.Certificate) == 0 {
+			return errors.New("certificate not found")
+		}
+		cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("error parsing certificate: %v", err)
+		}
+		now := time.Now()
+		if now.Before(cert.NotBefore) {
+			return fmt.Errorf("certificate not valid before %s", cert.NotBefore.Format(time.RFC3339))
+		}
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate expired at %s", cert.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
+
+// MariaDBSocketCheck verifies that MariaDB accepts connections in its unix socket, by reading the initial
+// handshake packet sent by the server.
+func MariaDBSocketCheck(socket string) CheckFunc {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "unix", socket)
+		if err != nil {
+			return fmt.Errorf("error connecting to socket: %v", err)
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			if err := conn.SetReadDeadline(deadline); err != nil {
+				return fmt.Errorf("error setting deadline: %v", err)
+			}
+		}
+		// Packet header: 3 bytes of payload length and 1 byte of sequence number, followed by the payload.
+		// The first payload byte is the protocol version, or 0xff when the server returns an error.
+		packet := make([]byte, 5)
+		if _, err := io.ReadFull(conn, packet); err != nil {
+			return fmt.Errorf("error reading handshake: %v", err)
+		}
+		if packet[4] == 0xff {
+			return errors.New("server returned an error on handshake")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,118 @@
+// Package health checks the dependencies that the agent needs to operate.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusOK     Status = "ok"
+	StatusFailed Status = "failed"
+)
+
+type CheckFunc func(ctx context.Context) error
+
+type Check struct {
+	Name  string
+	Check CheckFunc
+}
+
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+type Report struct {
+	Status Status        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type Option func(*Checker)
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Checker) {
+		c.timeout = timeout
+	}
+}
+
+func WithCheck(name string, check CheckFunc) Option {
+	return func(c *Checker) {
+		c.checks = append(c.checks, Check{
+			Name:  name,
+			Check: check,
+		})
+	}
+}
+
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+func NewChecker(opts ...Option) *Checker {
+	checker := &Checker{
+		timeout: 5 * time.Second,
+	}
+	for _, setOpt := range opts {
+		setOpt(checker)
+	}
+	return checker
+}
+
+// Run executes all the checks concurrently, each of them bounded by the checker timeout.
+func (c *Checker) Run(ctx context.Context) *Report {
+	report := &Report{
+		Status: StatusOK,
+		Checks: make([]CheckResult, len(c.checks)),
+	}
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFailed
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- check.Check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-errChan:
+	case <-checkCtx.Done():
+		err = checkCtx.Err()
+	}
+
+	result := CheckResult{
+		Name:    check.Name,
+		Status:  StatusOK,
+		Latency: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+	return result
+}
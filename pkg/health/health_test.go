@@ -0,0 +1,99 @@
+package health
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+)
+
+func newMariaDBSocket(t *testing.T, handshake []byte) string {
+	socket := filepath.Join(t.TempDir(), "mysqld.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("error listening on socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(handshake) //nolint:errcheck
+			conn.Close()
+		}
+	}()
+	return socket
+}
+
+func TestChecker(t *testing.T) {
+	tests := []struct {
+		name       string
+		check      CheckFunc
+		wantStatus Status
+	}{
+		{
+			name:       "dir",
+			check:      DirCheck(filesystem.NewOS(), t.TempDir()),
+			wantStatus: StatusOK,
+		},
+		{
+			name:       "missing dir",
+			check:      DirCheck(filesystem.NewOS(), filepath.Join(t.TempDir(), "foo")),
+			wantStatus: StatusFailed,
+		},
+		{
+			name:       "memory dir",
+			check:      DirCheck(filesystem.NewMemory(), "/"),
+			wantStatus: StatusOK,
+		},
+		{
+			name:       "missing memory dir",
+			check:      DirCheck(filesystem.NewMemory(), "/var/lib/mysql"),
+			wantStatus: StatusFailed,
+		},
+		{
+			name:       "mariadb",
+			check:      MariaDBSocketCheck(newMariaDBSocket(t, []byte{0x0a, 0x00, 0x00, 0x00, 0x0a})),
+			wantStatus: StatusOK,
+		},
+		{
+			name:       "mariadb error",
+			check:      MariaDBSocketCheck(newMariaDBSocket(t, []byte{0x0a, 0x00, 0x00, 0x00, 0xff})),
+			wantStatus: StatusFailed,
+		},
+		{
+			name:       "mariadb not running",
+			check:      MariaDBSocketCheck(filepath.Join(t.TempDir(), "mysqld.sock")),
+			wantStatus: StatusFailed,
+		},
+		{
+			name: "timeout",
+			check: func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			},
+			wantStatus: StatusFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(
+				WithTimeout(100*time.Millisecond),
+				WithCheck(tt.name, tt.check),
+			)
+			report := checker.Run(context.Background())
+			if report.Status != tt.wantStatus {
+				t.Fatalf("unexpected status: expected %s, got %s (%+v)", tt.wantStatus, report.Status, report.Checks)
+			}
+			if len(report.Checks) != 1 || report.Checks[0].Name != tt.name || report.Checks[0].Latency == "" {
+				t.Fatalf("unexpected checks: %+v", report.Checks)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package kubeclientset
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -21,6 +22,23 @@ func NewKubeclientSet() (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
+type LazyClientset struct {
+	once      sync.Once
+	clientset *kubernetes.Clientset
+	err       error
+}
+
+func NewLazyClientset() *LazyClientset {
+	return &LazyClientset{}
+}
+
+func (l *LazyClientset) Get() (*kubernetes.Clientset, error) {
+	l.once.Do(func() {
+		l.clientset, l.err = NewKubeclientSet()
+	})
+	return l.clientset, l.err
+}
+
 func restConfig() (*rest.Config, error) {
 	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
 		return clientcmd.BuildConfigFromFlags("", kubeconfig)
@@ -0,0 +1,137 @@
+package kubernetesauth
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	authv1 "k8s.io/api/authentication/v1"
+)
+
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+type cacheEntry struct {
+	key       string
+	status    authv1.TokenReviewStatus
+	expiresAt time.Time
+}
+
+type tokenReviewCache struct {
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mux     sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newTokenReviewCache(size int, ttl, negativeTTL time.Duration) *tokenReviewCache {
+	return &tokenReviewCache{
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		entries:     make(map[string]*list.Element, size),
+		lru:         list.New(),
+	}
+}
+
+func (c *tokenReviewCache) get(token string) (*authv1.TokenReviewStatus, bool) {
+	key := tokenHash(token)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.removeElement(elem)
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	c.hits.Add(1)
+
+	status := entry.status
+	return &status, true
+}
+
+func (c *tokenReviewCache) set(token string, status *authv1.TokenReviewStatus) {
+	ttl := c.ttl
+	if !status.Authenticated {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	now := c.now()
+	expiresAt := now.Add(ttl)
+	// The expiry is not verified, it only bounds the TTL: the token itself is verified by the TokenReview API.
+	if exp, ok := authentication.TokenExpiry(token); ok {
+		if !exp.After(now) {
+			return
+		}
+		if exp.Before(expiresAt) {
+			expiresAt = exp
+		}
+	}
+	key := tokenHash(token)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.status = *status
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:       key,
+		status:    *status,
+		expiresAt: expiresAt,
+	})
+	for c.size > 0 && c.lru.Len() > c.size {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *tokenReviewCache) stats() CacheStats {
+	c.mux.Lock()
+	size := c.lru.Len()
+	c.mux.Unlock()
+
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
+
+func (c *tokenReviewCache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+}
+
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
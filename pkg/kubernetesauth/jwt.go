@@ -0,0 +1,408 @@
+package kubernetesauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	jwksPath = "/openid/v1/jwks"
+)
+
+type JWKSSource func(ctx context.Context) ([]byte, error)
+
+func FileJWKS(path string) JWKSSource {
+	return func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+func APIServerJWKS(clientset kubernetes.Interface) JWKSSource {
+	return func(ctx context.Context) ([]byte, error) {
+		return clientset.Discovery().RESTClient().Get().AbsPath(jwksPath).DoRaw(ctx)
+	}
+}
+
+type TokenValidatorOption func(*TokenValidator)
+
+func WithJWKSRefreshInterval(interval time.Duration) TokenValidatorOption {
+	return func(v *TokenValidator) {
+		v.refreshInterval = interval
+	}
+}
+
+func WithJWKSMinRefreshInterval(interval time.Duration) TokenValidatorOption {
+	return func(v *TokenValidator) {
+		v.minRefreshInterval = interval
+	}
+}
+
+func WithClockSkew(skew time.Duration) TokenValidatorOption {
+	return func(v *TokenValidator) {
+		v.clockSkew = skew
+	}
+}
+
+type TokenValidator struct {
+	issuer             string
+	audiences          []string
+	source             JWKSSource
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+	clockSkew          time.Duration
+	now                func() time.Time
+
+	mux       sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	lastFetch time.Time
+}
+
+func NewTokenValidator(issuer string, audiences []string, source JWKSSource, opts ...TokenValidatorOption) (*TokenValidator, error) {
+	if issuer == "" {
+		return nil, errors.New("issuer must be provided")
+	}
+	if len(audiences) == 0 {
+		return nil, errors.New("at least one audience must be provided")
+	}
+	if source == nil {
+		return nil, errors.New("JWKS source must be provided")
+	}
+	validator := &TokenValidator{
+		issuer:             issuer,
+		audiences:          audiences,
+		source:             source,
+		refreshInterval:    1 * time.Hour,
+		minRefreshInterval: 1 * time.Minute,
+		clockSkew:          30 * time.Second,
+		now:                time.Now,
+	}
+	for _, setOpt := range opts {
+		setOpt(validator)
+	}
+	return validator, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type kubernetesRef struct {
+	Name string `json:"name"`
+	UID  string `json:"uid"`
+}
+
+type kubernetesClaims struct {
+	Namespace      string         `json:"namespace"`
+	Pod            *kubernetesRef `json:"pod,omitempty"`
+	ServiceAccount *kubernetesRef `json:"serviceaccount"`
+}
+
+type jwtClaims struct {
+	Issuer     string            `json:"iss"`
+	Subject    string            `json:"sub"`
+	Audience   audience          `json:"aud"`
+	Expiry     *int64            `json:"exp"`
+	NotBefore  *int64            `json:"nbf"`
+	Kubernetes *kubernetesClaims `json:"kubernetes.io"`
+}
+
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (v *TokenValidator) Validate(ctx context.Context, token string) (*authv1.UserInfo, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid JWT format")
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("error decoding header: %v", err)
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("error getting key: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding signature: %v", err)
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("error verifying signature: %v", err)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("error decoding claims: %v", err)
+	}
+	if err := v.validateClaims(&claims); err != nil {
+		return nil, err
+	}
+	return userInfo(&claims), nil
+}
+
+func (v *TokenValidator) validateClaims(claims *jwtClaims) error {
+	if claims.Issuer != v.issuer {
+		return fmt.Errorf("invalid issuer '%s'", claims.Issuer)
+	}
+	if !v.validAudience(claims.Audience) {
+		return fmt.Errorf("invalid audience '%v'", []string(claims.Audience))
+	}
+	now := v.now()
+	if claims.Expiry == nil {
+		return errors.New("expiry not found")
+	}
+	if now.After(time.Unix(*claims.Expiry, 0).Add(v.clockSkew)) {
+		return errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(v.clockSkew).Before(time.Unix(*claims.NotBefore, 0)) {
+		return errors.New("token not yet valid")
+	}
+
+	k := claims.Kubernetes
+	if k == nil || k.Namespace == "" || k.ServiceAccount == nil || k.ServiceAccount.Name == "" || k.ServiceAccount.UID == "" {
+		return errors.New("invalid kubernetes.io claims")
+	}
+	subject := fmt.Sprintf("system:serviceaccount:%s:%s", k.Namespace, k.ServiceAccount.Name)
+	if claims.Subject != subject {
+		return fmt.Errorf("subject '%s' does not match kubernetes.io claims", claims.Subject)
+	}
+	return nil
+}
+
+func (v *TokenValidator) validAudience(audience audience) bool {
+	for _, a := range audience {
+		for _, expected := range v.audiences {
+			if a == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *TokenValidator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mux.RLock()
+	key, ok := v.keys[kid]
+	stale := v.now().Sub(v.lastFetch) > v.refreshInterval
+	v.mux.RUnlock()
+	if ok && !stale {
+		return key, nil
+	}
+
+	if err := v.refresh(ctx); err != nil {
+		// Keep using the previous keys when the JWKS cannot be fetched, the API server may be degraded.
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	v.mux.RLock()
+	defer v.mux.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key '%s' not found", kid)
+}
+
+func (v *TokenValidator) refresh(ctx context.Context) error {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	if v.keys != nil && v.now().Sub(v.lastFetch) < v.minRefreshInterval {
+		return nil
+	}
+	bytes, err := v.source(ctx)
+	if err != nil {
+		return fmt.Errorf("error fetching JWKS: %v", err)
+	}
+	keys, err := parseJWKS(bytes)
+	if err != nil {
+		return fmt.Errorf("error parsing JWKS: %v", err)
+	}
+	v.keys = keys
+	v.lastFetch = v.now()
+	return nil
+}
+
+func userInfo(claims *jwtClaims) *authv1.UserInfo {
+	k := claims.Kubernetes
+	user := &authv1.UserInfo{
+		Username: claims.Subject,
+		UID:      k.ServiceAccount.UID,
+		Groups: []string{
+			"system:serviceaccounts",
+			fmt.Sprintf("system:serviceaccounts:%s", k.Namespace),
+			"system:authenticated",
+		},
+	}
+	if k.Pod != nil {
+		user.Extra = map[string]authv1.ExtraValue{
+			"authentication.kubernetes.io/pod-name": {k.Pod.Name},
+			"authentication.kubernetes.io/pod-uid":  {k.Pod.UID},
+		}
+	}
+	return user
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(bytes []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(bytes, &jwks); err != nil {
+		return nil, fmt.Errorf("error decoding JWKS: %v", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key '%s': %v", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding modulus: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding exponent: %v", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding x: %v", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding y: %v", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm '%s' does not match RSA key", alg)
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("algorithm '%s' does not match EC key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return errors.New("unsupported key")
+	}
+}
+
+func decodeSegment(segment string, v any) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -0,0 +1,217 @@
+package kubernetesauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://kubernetes.default.svc.cluster.local"
+	testAudience = "mariadb-agent"
+	testKid      = "test-key"
+)
+
+func writeJWKS(t *testing.T, key *rsa.PublicKey) string {
+	jwks := map[string]any{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": testKid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		},
+	}
+	bytes, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatalf("error marshaling JWKS: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, bytes, 0600); err != nil {
+		t.Fatalf("error writing JWKS: %v", err)
+	}
+	return path
+}
+
+func signJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	encode := func(v any) string {
+		bytes, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("error marshaling JWT segment: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(bytes)
+	}
+	signed := encode(map[string]string{"alg": "RS256", "kid": kid}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("error signing JWT: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims(now time.Time) map[string]any {
+	return map[string]any{
+		"iss": testIssuer,
+		"sub": "system:serviceaccount:default:mariadb-operator",
+		"aud": []string{testAudience},
+		"exp": now.Add(time.Hour).Unix(),
+		"nbf": now.Add(-time.Minute).Unix(),
+		"kubernetes.io": map[string]any{
+			"namespace": "default",
+			"pod": map[string]string{
+				"name": "mariadb-operator-0",
+				"uid":  "a8a5c1f7-6d3c-4d65-9a4f-0a3b9c1e2f10",
+			},
+			"serviceaccount": map[string]string{
+				"name": "mariadb-operator",
+				"uid":  "3f1a7b0e-2c47-4a39-8b8e-5d0c6a9f1e22",
+			},
+		},
+	}
+}
+
+func TestTokenValidatorValidate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	now := time.Now()
+
+	validator, err := NewTokenValidator(testIssuer, []string{testAudience}, FileJWKS(writeJWKS(t, &key.PublicKey)))
+	if err != nil {
+		t.Fatalf("error creating validator: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		token     func() string
+		wantUser  string
+		wantError bool
+	}{
+		{
+			name: "valid",
+			token: func() string {
+				return signJWT(t, key, testKid, validClaims(now))
+			},
+			wantUser:  "system:serviceaccount:default:mariadb-operator",
+			wantError: false,
+		},
+		{
+			name: "single audience",
+			token: func() string {
+				claims := validClaims(now)
+				claims["aud"] = testAudience
+				return signJWT(t, key, testKid, claims)
+			},
+			wantUser:  "system:serviceaccount:default:mariadb-operator",
+			wantError: false,
+		},
+		{
+			name: "invalid signature",
+			token: func() string {
+				return signJWT(t, otherKey, testKid, validClaims(now))
+			},
+			wantError: true,
+		},
+		{
+			name: "unknown key",
+			token: func() string {
+				return signJWT(t, key, "unknown", validClaims(now))
+			},
+			wantError: true,
+		},
+		{
+			name: "invalid issuer",
+			token: func() string {
+				claims := validClaims(now)
+				claims["iss"] = "https://example.com"
+				return signJWT(t, key, testKid, claims)
+			},
+			wantError: true,
+		},
+		{
+			name: "invalid audience",
+			token: func() string {
+				claims := validClaims(now)
+				claims["aud"] = []string{"https://kubernetes.default.svc.cluster.local"}
+				return signJWT(t, key, testKid, claims)
+			},
+			wantError: true,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := validClaims(now)
+				claims["exp"] = now.Add(-time.Hour).Unix()
+				return signJWT(t, key, testKid, claims)
+			},
+			wantError: true,
+		},
+		{
+			name: "not yet valid",
+			token: func() string {
+				claims := validClaims(now)
+				claims["nbf"] = now.Add(time.Hour).Unix()
+				return signJWT(t, key, testKid, claims)
+			},
+			wantError: true,
+		},
+		{
+			name: "missing kubernetes.io claims",
+			token: func() string {
+				claims := validClaims(now)
+				delete(claims, "kubernetes.io")
+				return signJWT(t, key, testKid, claims)
+			},
+			wantError: true,
+		},
+		{
+			name: "subject mismatch",
+			token: func() string {
+				claims := validClaims(now)
+				claims["sub"] = "system:serviceaccount:kube-system:admin"
+				return signJWT(t, key, testKid, claims)
+			},
+			wantError: true,
+		},
+		{
+			name: "malformed",
+			token: func() string {
+				return "foo"
+			},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := validator.Validate(context.Background(), tt.token())
+			if tt.wantError && err == nil {
+				t.Fatal("error expected, got nil")
+			}
+			if !tt.wantError && err != nil {
+				t.Fatalf("error unexpected, got %v", err)
+			}
+			if !tt.wantError && user.Username != tt.wantUser {
+				t.Fatalf("unexpected username: expected %s, got %s", tt.wantUser, user.Username)
+			}
+		})
+	}
+}
@@ -1,19 +1,24 @@
 package kubernetesauth
 
 import (
+	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
-	agenterrors "github.com/mariadb-operator/agent/pkg/errors"
-	"github.com/mariadb-operator/agent/pkg/responsewriter"
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/authorization"
 	authv1 "k8s.io/api/authentication/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+// DefaultAudience is the audience of the tokens that the agent accepts by default.
+const DefaultAudience = "mariadb-agent"
+
 type Trusted struct {
 	ServiceAccountName      string
 	ServiceAccountNamespace string
@@ -23,69 +28,165 @@ func (t *Trusted) String() string {
 	return fmt.Sprintf("system:serviceaccount:%s:%s", t.ServiceAccountNamespace, t.ServiceAccountName)
 }
 
+func (t *Trusted) Authorize(ctx context.Context, attrs *authorization.Attributes) (bool, error) {
+	return attrs.User != nil && attrs.User.Username == t.String(), nil
+}
+
+type Option func(*KubernetesAuth)
+
+func WithCache(size int, ttl, negativeTTL time.Duration) Option {
+	return func(a *KubernetesAuth) {
+		if size > 0 && (ttl > 0 || negativeTTL > 0) {
+			a.cache = newTokenReviewCache(size, ttl, negativeTTL)
+		}
+	}
+}
+
+func WithTokenValidator(validator *TokenValidator, tokenReviewFallback bool) Option {
+	return func(a *KubernetesAuth) {
+		a.validator = validator
+		a.tokenReviewFallback = tokenReviewFallback
+	}
+}
+
+// WithAudiences sets the audiences that the tokens must be minted for. DefaultAudience is expected when none are
+// provided, so the tokens minted for the API server, like the default ServiceAccount tokens, are rejected.
+func WithAudiences(audiences []string) Option {
+	return func(a *KubernetesAuth) {
+		if len(audiences) > 0 {
+			a.audiences = audiences
+		}
+	}
+}
+
+func WithAuthorizer(authorizer authorization.Authorizer) Option {
+	return func(a *KubernetesAuth) {
+		a.authorizer = authorizer
+	}
+}
+
 type KubernetesAuth struct {
-	clientset      *kubernetes.Clientset
-	trusted        *Trusted
-	responseWriter *responsewriter.ResponseWriter
-	logger         logr.Logger
+	clientset           kubernetes.Interface
+	authorizer          authorization.Authorizer
+	audiences           []string
+	cache               *tokenReviewCache
+	validator           *TokenValidator
+	tokenReviewFallback bool
+	logger              logr.Logger
+}
+
+func NewKubernetesAuth(clientset kubernetes.Interface, trusted *Trusted, logger logr.Logger, opts ...Option) *KubernetesAuth {
+	auth := &KubernetesAuth{
+		clientset:           clientset,
+		audiences:           []string{DefaultAudience},
+		tokenReviewFallback: true,
+		logger:              logger,
+	}
+	if trusted != nil {
+		auth.authorizer = trusted
+	}
+	for _, setOpt := range opts {
+		setOpt(auth)
+	}
+	return auth
 }
 
-func NewKubernetesAuth(clientset *kubernetes.Clientset, trusted *Trusted, logger logr.Logger) *KubernetesAuth {
-	return &KubernetesAuth{
-		clientset:      clientset,
-		trusted:        trusted,
-		responseWriter: responsewriter.NewResponseWriter(&logger),
-		logger:         logger,
+func (a *KubernetesAuth) CacheStats() CacheStats {
+	if a.cache == nil {
+		return CacheStats{}
 	}
+	return a.cache.stats()
+}
+
+// CacheStatsVar reports the cache stats as an expvar variable, to be published with expvar.Publish.
+func (a *KubernetesAuth) CacheStatsVar() expvar.Var {
+	return expvar.Func(func() any {
+		return a.CacheStats()
+	})
+}
+
+func (a *KubernetesAuth) Authenticate(r *http.Request) (*authv1.UserInfo, error) {
+	token, err := authentication.BearerToken(r)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Authorization header: %v", err)
+	}
+	status, err := a.authenticate(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Authenticated {
+		return nil, errors.New("TokenReview not valid")
+	}
+	return &status.User, nil
 }
 
 func (a *KubernetesAuth) Handler(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		token, err := authToken(r)
-		if err != nil {
-			a.logger.V(1).Info("Error getting Authorization header", "err", err)
-			a.responseWriter.Write(w, agenterrors.NewAPIError("unauthorized"), http.StatusUnauthorized)
-			return
-		}
-		tokenReview := &authv1.TokenReview{
-			Spec: authv1.TokenReviewSpec{
-				Token: token,
-			},
-		}
-		tokenReviewRes, err := a.clientset.AuthenticationV1().TokenReviews().Create(r.Context(), tokenReview, metav1.CreateOptions{})
-		if err != nil {
-			a.logger.V(1).Info("Error verifying token in TokenReview API", "err", err)
-			a.responseWriter.Write(w, agenterrors.NewAPIError("unauthorized"), http.StatusUnauthorized)
-			return
-		}
-		if !tokenReviewRes.Status.Authenticated {
-			a.logger.V(1).Info("TokenReview not valid")
-			a.responseWriter.Write(w, agenterrors.NewAPIError("unauthorized"), http.StatusUnauthorized)
-			return
+	return authentication.NewMiddleware(a, a.authorizer, a.logger).Handler(next)
+}
+
+func (a *KubernetesAuth) authenticate(ctx context.Context, token string) (*authv1.TokenReviewStatus, error) {
+	if a.cache != nil {
+		if status, ok := a.cache.get(token); ok {
+			return status, nil
 		}
-		if tokenReviewRes.Status.User.Username == "" {
-			a.logger.V(1).Info("Username not found")
-			a.responseWriter.Write(w, agenterrors.NewAPIError("unauthorized"), http.StatusUnauthorized)
-			return
+	}
+	if a.validator != nil {
+		user, err := a.validator.Validate(ctx, token)
+		if err == nil {
+			status := &authv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          *user,
+			}
+			if a.cache != nil {
+				a.cache.set(token, status)
+			}
+			return status, nil
 		}
-		if a.trusted.String() != tokenReviewRes.Status.User.Username {
-			a.logger.V(1).Info("Username not allowed", "username", tokenReviewRes.Status.User.Username)
-			a.responseWriter.Write(w, agenterrors.NewAPIError("forbidden"), http.StatusForbidden)
-			return
+		if !a.tokenReviewFallback {
+			return nil, fmt.Errorf("error validating token: %v", err)
 		}
-		next.ServeHTTP(w, r)
+		a.logger.V(1).Info("Error validating token locally, falling back to TokenReview API", "err", err)
 	}
-	return http.HandlerFunc(fn)
+	status, err := a.tokenReview(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying token in TokenReview API: %v", err)
+	}
+	return status, nil
 }
 
-func authToken(r *http.Request) (string, error) {
-	auth := r.Header.Get("Authorization")
-	if auth == "" {
-		return "", errors.New("Authorization header not found")
+func (a *KubernetesAuth) tokenReview(ctx context.Context, token string) (*authv1.TokenReviewStatus, error) {
+	tokenReview := &authv1.TokenReview{
+		Spec: authv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: a.audiences,
+		},
+	}
+	tokenReviewRes, err := a.clientset.AuthenticationV1().TokenReviews().Create(ctx, tokenReview, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if tokenReviewRes.Status.Authenticated && !a.validAudience(tokenReviewRes.Status.Audiences) {
+		a.logger.V(1).Info("Token audiences not allowed", "audiences", tokenReviewRes.Status.Audiences)
+		tokenReviewRes.Status.Authenticated = false
 	}
-	parts := strings.Split(auth, "Bearer ")
-	if len(parts) != 2 {
-		return "", errors.New("invalid Authorization header")
+	if a.cache != nil {
+		a.cache.set(token, &tokenReviewRes.Status)
+	}
+	return &tokenReviewRes.Status, nil
+}
+
+// validAudience checks that the token was minted for one of the configured audiences.
+// An empty status audience means the token is only valid for the API server, so it is rejected.
+func (a *KubernetesAuth) validAudience(audiences []string) bool {
+	if len(a.audiences) == 0 {
+		return true
+	}
+	for _, audience := range audiences {
+		for _, expected := range a.audiences {
+			if audience == expected {
+				return true
+			}
+		}
 	}
-	return parts[1], nil
+	return false
 }
@@ -0,0 +1,262 @@
+package kubernetesauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	authv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var trusted = &Trusted{
+	ServiceAccountName:      "mariadb-operator",
+	ServiceAccountNamespace: "default",
+}
+
+func newFakeClientset(users map[string]string, calls *int) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*calls++
+		tokenReview := action.(k8stesting.CreateAction).GetObject().(*authv1.TokenReview)
+		username, ok := users[tokenReview.Spec.Token]
+		tokenReview.Status = authv1.TokenReviewStatus{
+			Authenticated: ok,
+			User: authv1.UserInfo{
+				Username: username,
+			},
+			Audiences: tokenReview.Spec.Audiences,
+		}
+		return true, tokenReview, nil
+	})
+	return clientset
+}
+
+func doRequest(handler http.Handler, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/galerastate", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestKubernetesAuthCache(t *testing.T) {
+	users := map[string]string{
+		"trusted":   trusted.String(),
+		"untrusted": "system:serviceaccount:default:foo",
+	}
+	tests := []struct {
+		name       string
+		opts       []Option
+		tokens     []string
+		wantCodes  []int
+		wantCalls  int
+		wantHits   uint64
+		wantMisses uint64
+	}{
+		{
+			name:      "no cache",
+			opts:      nil,
+			tokens:    []string{"trusted", "trusted", "trusted"},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			wantCalls: 3,
+		},
+		{
+			name:       "positive cache",
+			opts:       []Option{WithCache(10, time.Minute, time.Minute)},
+			tokens:     []string{"trusted", "trusted", "trusted"},
+			wantCodes:  []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			wantCalls:  1,
+			wantHits:   2,
+			wantMisses: 1,
+		},
+		{
+			name:       "negative cache",
+			opts:       []Option{WithCache(10, time.Minute, time.Minute)},
+			tokens:     []string{"invalid", "invalid"},
+			wantCodes:  []int{http.StatusUnauthorized, http.StatusUnauthorized},
+			wantCalls:  1,
+			wantHits:   1,
+			wantMisses: 1,
+		},
+		{
+			name:       "negative cache disabled",
+			opts:       []Option{WithCache(10, time.Minute, 0)},
+			tokens:     []string{"invalid", "invalid"},
+			wantCodes:  []int{http.StatusUnauthorized, http.StatusUnauthorized},
+			wantCalls:  2,
+			wantHits:   0,
+			wantMisses: 2,
+		},
+		{
+			name:       "forbidden cached",
+			opts:       []Option{WithCache(10, time.Minute, time.Minute)},
+			tokens:     []string{"untrusted", "untrusted"},
+			wantCodes:  []int{http.StatusForbidden, http.StatusForbidden},
+			wantCalls:  1,
+			wantHits:   1,
+			wantMisses: 1,
+		},
+		{
+			name:       "eviction",
+			opts:       []Option{WithCache(1, time.Minute, time.Minute)},
+			tokens:     []string{"trusted", "untrusted", "trusted"},
+			wantCodes:  []int{http.StatusOK, http.StatusForbidden, http.StatusOK},
+			wantCalls:  3,
+			wantHits:   0,
+			wantMisses: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			auth := NewKubernetesAuth(newFakeClientset(users, &calls), trusted, logr.Discard(), tt.opts...)
+			handler := auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for i, token := range tt.tokens {
+				if code := doRequest(handler, token); code != tt.wantCodes[i] {
+					t.Fatalf("unexpected status code in request %d: expected %d, got %d", i, tt.wantCodes[i], code)
+				}
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("unexpected TokenReview calls: expected %d, got %d", tt.wantCalls, calls)
+			}
+			stats := auth.CacheStats()
+			if stats.Hits != tt.wantHits {
+				t.Fatalf("unexpected cache hits: expected %d, got %d", tt.wantHits, stats.Hits)
+			}
+			if stats.Misses != tt.wantMisses {
+				t.Fatalf("unexpected cache misses: expected %d, got %d", tt.wantMisses, stats.Misses)
+			}
+			var varStats CacheStats
+			if err := json.Unmarshal([]byte(auth.CacheStatsVar().String()), &varStats); err != nil {
+				t.Fatalf("error unmarshaling cache stats var: %v", err)
+			}
+			if varStats != stats {
+				t.Fatalf("unexpected cache stats var: expected %+v, got %+v", stats, varStats)
+			}
+		})
+	}
+}
+
+func TestTokenReviewCacheExpiry(t *testing.T) {
+	now := time.Now()
+	cache := newTokenReviewCache(10, time.Hour, time.Second)
+	cache.now = func() time.Time { return now }
+
+	jwt := func(exp time.Time) string {
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+		return fmt.Sprintf("header.%s.signature", payload)
+	}
+	expiring := jwt(now.Add(10 * time.Second))
+	expired := jwt(now.Add(-10 * time.Second))
+	authenticated := &authv1.TokenReviewStatus{Authenticated: true}
+	unauthenticated := &authv1.TokenReviewStatus{Authenticated: false}
+
+	cache.set(expiring, authenticated)
+	cache.set(expired, authenticated)
+	cache.set("opaque", unauthenticated)
+
+	if _, ok := cache.get(expired); ok {
+		t.Fatal("expected expired token not to be cached")
+	}
+	if _, ok := cache.get(expiring); !ok {
+		t.Fatal("expected expiring token to be cached")
+	}
+	if _, ok := cache.get("opaque"); !ok {
+		t.Fatal("expected negative result to be cached")
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, ok := cache.get("opaque"); ok {
+		t.Fatal("expected negative result to expire after negative TTL")
+	}
+	if _, ok := cache.get(expiring); !ok {
+		t.Fatal("expected expiring token to be cached")
+	}
+
+	now = now.Add(10 * time.Second)
+	if _, ok := cache.get(expiring); ok {
+		t.Fatal("expected token to expire at its exp claim")
+	}
+}
+
+func TestKubernetesAuthAudiences(t *testing.T) {
+	tokenAudiences := map[string][]string{
+		"agent":      {"mariadb-agent"},
+		"apiserver":  nil,
+		"unexpected": {"foo"},
+	}
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tokenReview := action.(k8stesting.CreateAction).GetObject().(*authv1.TokenReview)
+		tokenReview.Status = authv1.TokenReviewStatus{
+			Authenticated: true,
+			User: authv1.UserInfo{
+				Username: trusted.String(),
+			},
+			Audiences: tokenAudiences[tokenReview.Spec.Token],
+		}
+		return true, tokenReview, nil
+	})
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "default audience",
+			opts:     nil,
+			token:    "agent",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "API server audience with default audience",
+			opts:     nil,
+			token:    "apiserver",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "matching audience",
+			opts:     []Option{WithAudiences([]string{"mariadb-agent"})},
+			token:    "agent",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "API server audience",
+			opts:     []Option{WithAudiences([]string{"mariadb-agent"})},
+			token:    "apiserver",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "unexpected audience",
+			opts:     []Option{WithAudiences([]string{"mariadb-agent"})},
+			token:    "unexpected",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewKubernetesAuth(clientset, trusted, logr.Discard(), tt.opts...)
+			handler := auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			if code := doRequest(handler, tt.token); code != tt.wantCode {
+				t.Fatalf("unexpected status code: expected %d, got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
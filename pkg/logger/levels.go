@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels holds the log level and the per-logger overrides, which can be changed at runtime.
+// An override applies to the loggers whose dot separated name contains it, for example 'bootstrap' applies
+// to 'handler.bootstrap'. The most specific override wins.
+type Levels struct {
+	mux              sync.RWMutex
+	initial          zapcore.Level
+	initialOverrides map[string]zapcore.Level
+	level            zapcore.Level
+	overrides        map[string]zapcore.Level
+	minimumLevel     zap.AtomicLevel
+}
+
+func NewLevels(level string, overrides map[string]zapcore.Level) (*Levels, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	levels := &Levels{
+		initial:          lvl,
+		initialOverrides: overrides,
+		level:            lvl,
+		minimumLevel:     zap.NewAtomicLevelAt(lvl),
+	}
+	levels.SetOverrides(overrides)
+	return levels, nil
+}
+
+func ParseLevel(level string) (zapcore.Level, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return lvl, fmt.Errorf("invalid log level '%s': %v", level, err)
+	}
+	return lvl, nil
+}
+
+// Enabled implements zapcore.LevelEnabler. It returns true if any logger has the level enabled,
+// the final decision is taken per logger name.
+func (l *Levels) Enabled(lvl zapcore.Level) bool {
+	return l.minimumLevel.Enabled(lvl)
+}
+
+func (l *Levels) Level() zapcore.Level {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	return l.level
+}
+
+func (l *Levels) SetLevel(lvl zapcore.Level) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.level = lvl
+	l.updateMinimumLevel()
+}
+
+// Reset restores the initial level and overrides.
+func (l *Levels) Reset() {
+	l.mux.Lock()
+	l.level = l.initial
+	l.mux.Unlock()
+	l.SetOverrides(l.initialOverrides)
+}
+
+func (l *Levels) Overrides() map[string]zapcore.Level {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	overrides := make(map[string]zapcore.Level, len(l.overrides))
+	for name, lvl := range l.overrides {
+		overrides[name] = lvl
+	}
+	return overrides
+}
+
+// SetOverrides replaces all the overrides.
+func (l *Levels) SetOverrides(overrides map[string]zapcore.Level) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.overrides = make(map[string]zapcore.Level, len(overrides))
+	for name, lvl := range overrides {
+		l.overrides[name] = lvl
+	}
+	l.updateMinimumLevel()
+}
+
+// HandleSignals increases the verbosity by one level on SIGUSR1 and resets the levels on SIGUSR2,
+// until the context is cancelled.
+func (l *Levels) HandleSignals(ctx context.Context, logger logr.Logger) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s := <-sig:
+				if s == syscall.SIGUSR1 {
+					l.SetLevel(l.Level() - 1)
+				} else {
+					l.Reset()
+				}
+				logger.Info("log level changed", "signal", s.String(), "level", l.Level().String())
+			}
+		}
+	}()
+}
+
+func (l *Levels) enabledFor(name string, lvl zapcore.Level) bool {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+	level := l.level
+	match := ""
+	for override, overrideLevel := range l.overrides {
+		if len(override) > len(match) && matchesName(name, override) {
+			match = override
+			level = overrideLevel
+		}
+	}
+	return level.Enabled(lvl)
+}
+
+func (l *Levels) updateMinimumLevel() {
+	minimum := l.level
+	for _, lvl := range l.overrides {
+		if lvl < minimum {
+			minimum = lvl
+		}
+	}
+	l.minimumLevel.SetLevel(minimum)
+}
+
+func matchesName(name, override string) bool {
+	return name == override ||
+		strings.HasPrefix(name, override+".") ||
+		strings.HasSuffix(name, "."+override) ||
+		strings.Contains(name, "."+override+".")
+}
+
+// levelsCore filters the entries by the level of their logger name.
+type levelsCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func (c *levelsCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelsCore{
+		Core:   c.Core.With(fields),
+		levels: c.levels,
+	}
+}
+
+func (c *levelsCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.enabledFor(entry.LoggerName, entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLevels(t *testing.T) {
+	levels, err := NewLevels("info", nil)
+	if err != nil {
+		t.Fatalf("error creating levels: %v", err)
+	}
+	core, logs := observer.New(levels)
+	logger := zap.New(&levelsCore{
+		Core:   core,
+		levels: levels,
+	})
+	handler := logger.Named("handler")
+	bootstrap := handler.Named("bootstrap")
+	recovery := handler.Named("recovery")
+	server := logger.Named("server")
+
+	logAll := func() {
+		logs.TakeAll()
+		handler.Debug("handler")
+		bootstrap.Debug("bootstrap")
+		recovery.Debug("recovery")
+		server.Debug("server")
+		server.Info("server")
+	}
+	messages := func() []string {
+		var messages []string
+		for _, entry := range logs.TakeAll() {
+			messages = append(messages, entry.Message)
+		}
+		return messages
+	}
+
+	tests := []struct {
+		name      string
+		level     zapcore.Level
+		overrides map[string]zapcore.Level
+		want      []string
+	}{
+		{
+			name:  "info",
+			level: zapcore.InfoLevel,
+			want:  []string{"server"},
+		},
+		{
+			name:  "debug",
+			level: zapcore.DebugLevel,
+			want:  []string{"handler", "bootstrap", "recovery", "server", "server"},
+		},
+		{
+			name:  "handler override",
+			level: zapcore.InfoLevel,
+			overrides: map[string]zapcore.Level{
+				"handler": zapcore.DebugLevel,
+			},
+			want: []string{"handler", "bootstrap", "recovery", "server"},
+		},
+		{
+			name:  "most specific override",
+			level: zapcore.InfoLevel,
+			overrides: map[string]zapcore.Level{
+				"handler":  zapcore.DebugLevel,
+				"recovery": zapcore.InfoLevel,
+			},
+			want: []string{"handler", "bootstrap", "server"},
+		},
+		{
+			name:  "server override",
+			level: zapcore.DebugLevel,
+			overrides: map[string]zapcore.Level{
+				"server": zapcore.ErrorLevel,
+			},
+			want: []string{"handler", "bootstrap", "recovery"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels.SetLevel(tt.level)
+			levels.SetOverrides(tt.overrides)
+			logAll()
+
+			got := messages()
+			if len(got) != len(tt.want) {
+				t.Fatalf("unexpected messages: expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("unexpected messages: expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/go-logr/logr"
+	uberzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -21,6 +22,20 @@ func WithLogLevel(level string) Option {
 	}
 }
 
+// WithLevels allows changing the log level of the loggers at runtime. Use it instead of WithLogLevel.
+func WithLevels(levels *Levels) Option {
+	return func(o *zap.Options) error {
+		o.Level = levels
+		o.ZapOpts = append(o.ZapOpts, uberzap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return &levelsCore{
+				Core:   core,
+				levels: levels,
+			}
+		}))
+		return nil
+	}
+}
+
 func WithTimeEncoder(encoder string) Option {
 	return func(o *zap.Options) error {
 		var enc zapcore.TimeEncoder
@@ -0,0 +1,26 @@
+// Package mariadbtest provides helpers to test the code that runs mariadbd without a MariaDB installation.
+package mariadbtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// NewFakeMariaDB writes a shell script standing in for mariadbd, which runs the given commands with the value of
+// the --log-error argument in $log. It returns the path of the script.
+func NewFakeMariaDB(t testing.TB, commands string) string {
+	t.Helper()
+	binary := filepath.Join(t.TempDir(), "mariadbd")
+	script := `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+		--log-error=*) log="${arg#--log-error=}" ;;
+	esac
+done
+` + commands + "\n"
+	if err := os.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatalf("error writing fake binary: %v", err)
+	}
+	return binary
+}
@@ -0,0 +1,254 @@
+package mariadb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+)
+
+type ServerState string
+
+const (
+	ServerStateRunning ServerState = "Running"
+	ServerStateStopped ServerState = "Stopped"
+)
+
+const (
+	detectedByPIDFile      = "pidFile"
+	detectedByProcessTable = "processTable"
+	detectedBySocket       = "socket"
+)
+
+var (
+	defaultProcessNames = []string{"mariadbd", "mysqld"}
+)
+
+// ServerStatus is the state of the mariadbd server running next to the agent.
+type ServerStatus struct {
+	State      ServerState `json:"state"`
+	PID        int         `json:"pid,omitempty"`
+	DetectedBy string      `json:"detectedBy,omitempty"`
+}
+
+func (s *ServerStatus) Running() bool {
+	return s.State == ServerStateRunning
+}
+
+type ServerDetectorOption func(*ServerDetector)
+
+func WithPIDFile(pidFile string) ServerDetectorOption {
+	return func(d *ServerDetector) {
+		d.pidFile = pidFile
+	}
+}
+
+// WithProcessTable looks for a mariadbd process in the process table mounted in procDir, usually /proc.
+// It requires the agent to share the process namespace with mariadbd, see SharesProcessTable.
+func WithProcessTable(procDir string) ServerDetectorOption {
+	return func(d *ServerDetector) {
+		d.procDir = procDir
+	}
+}
+
+func WithSocket(socket string) ServerDetectorOption {
+	return func(d *ServerDetector) {
+		d.socket = socket
+	}
+}
+
+func WithFS(fsys filesystem.FS) ServerDetectorOption {
+	return func(d *ServerDetector) {
+		d.fsys = fsys
+	}
+}
+
+// ServerDetector detects whether mariadbd is running by checking its pid file, the process table and its socket.
+// The server is considered to be running as soon as one of the configured sources detects it.
+type ServerDetector struct {
+	fsys         filesystem.FS
+	pidFile      string
+	procDir      string
+	socket       string
+	processNames []string
+	// sharedProcessTable caches a positive SharesProcessTable, the process namespace of a pod does not change.
+	sharedProcessTable atomic.Bool
+}
+
+func NewServerDetector(opts ...ServerDetectorOption) *ServerDetector {
+	detector := &ServerDetector{
+		fsys:         filesystem.NewOS(),
+		processNames: defaultProcessNames,
+	}
+	for _, setOpt := range opts {
+		setOpt(detector)
+	}
+	return detector
+}
+
+func (d *ServerDetector) Status(ctx context.Context) (*ServerStatus, error) {
+	if d.pidFile != "" {
+		pid, err := d.pidFromFile()
+		if err != nil {
+			return nil, fmt.Errorf("error checking pid file: %v", err)
+		}
+		if pid > 0 {
+			return &ServerStatus{State: ServerStateRunning, PID: pid, DetectedBy: detectedByPIDFile}, nil
+		}
+	}
+	if d.procDir != "" {
+		pid, err := d.pidFromProcessTable()
+		if err != nil {
+			return nil, fmt.Errorf("error checking process table: %v", err)
+		}
+		if pid > 0 {
+			return &ServerStatus{State: ServerStateRunning, PID: pid, DetectedBy: detectedByProcessTable}, nil
+		}
+	}
+	if d.socket != "" {
+		running, err := d.socketAccepting(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error checking socket: %v", err)
+		}
+		if running {
+			return &ServerStatus{State: ServerStateRunning, DetectedBy: detectedBySocket}, nil
+		}
+	}
+	return &ServerStatus{State: ServerStateStopped}, nil
+}
+
+// SharesProcessTable returns whether the process table lists the processes of other containers, meaning that the
+// agent shares the process namespace with mariadbd. The processes of other containers belong to other cgroups,
+// whereas the processes executed in the agent container, for example with kubectl exec, belong to its cgroup.
+func (d *ServerDetector) SharesProcessTable() (bool, error) {
+	if d.procDir == "" {
+		return false, nil
+	}
+	if d.sharedProcessTable.Load() {
+		return true, nil
+	}
+	selfCgroup, err := d.fsys.ReadFile(filepath.Join(d.procDir, "self", "cgroup"))
+	if err != nil {
+		return false, err
+	}
+	entries, err := d.fsys.ReadDir(d.procDir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		cgroup, err := d.fsys.ReadFile(filepath.Join(d.procDir, entry.Name(), "cgroup"))
+		if err != nil {
+			// The process may have exited after listing the process table.
+			if os.IsNotExist(err) {
+				continue
+			}
+			return false, err
+		}
+		if !bytes.Equal(cgroup, selfCgroup) {
+			d.sharedProcessTable.Store(true)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pidFromFile returns the pid contained in the pid file. Stale pid files left behind by a crash are ignored
+// when the process no longer exists in a process table shared with mariadbd. When the process table is not
+// shared, the pid belongs to another process namespace and the pid file is trusted. A pid file that cannot be
+// parsed, for example while mariadbd is writing it, is ignored, leaving the decision to the other sources.
+func (d *ServerDetector) pidFromFile() (int, error) {
+	content, err := d.fsys.ReadFile(d.pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return 0, nil
+	}
+	if d.procDir == "" {
+		return pid, nil
+	}
+	isServer, err := d.isServerProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	if isServer {
+		return pid, nil
+	}
+	shared, err := d.SharesProcessTable()
+	if err != nil {
+		return 0, err
+	}
+	if shared {
+		return 0, nil
+	}
+	return pid, nil
+}
+
+func (d *ServerDetector) pidFromProcessTable() (int, error) {
+	entries, err := d.fsys.ReadDir(d.procDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		isServer, err := d.isServerProcess(pid)
+		if err != nil {
+			return 0, err
+		}
+		if isServer {
+			return pid, nil
+		}
+	}
+	return 0, nil
+}
+
+func (d *ServerDetector) isServerProcess(pid int) (bool, error) {
+	content, err := d.fsys.ReadFile(filepath.Join(d.procDir, strconv.Itoa(pid), "comm"))
+	if err != nil {
+		// The process may have exited after listing the process table.
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	comm := strings.TrimSpace(string(content))
+	for _, name := range d.processNames {
+		if comm == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (d *ServerDetector) socketAccepting(ctx context.Context) (bool, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", d.socket)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return false, nil
+		}
+		return false, err
+	}
+	conn.Close()
+	return true, nil
+}
@@ -0,0 +1,244 @@
+package mariadb
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+)
+
+const agentCgroup = "0::/\n"
+
+// newProcFS creates a process table where the processes belong to the cgroup of the agent, unless their cgroup
+// is given in cgroups, as the processes of other containers sharing the process namespace.
+func newProcFS(t *testing.T, processes, cgroups map[string]string) *filesystem.Memory {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{"/var/lib/mysql", "/proc/self"} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	if err := memory.WriteFile("/proc/self/cgroup", []byte(agentCgroup), 0444); err != nil {
+		t.Fatalf("error writing process cgroup: %v", err)
+	}
+	for pid, comm := range processes {
+		if err := memory.MkdirAll(filepath.Join("/proc", pid), 0555); err != nil {
+			t.Fatalf("error creating process directory: %v", err)
+		}
+		if err := memory.WriteFile(filepath.Join("/proc", pid, "comm"), []byte(comm+"\n"), 0444); err != nil {
+			t.Fatalf("error writing process comm: %v", err)
+		}
+		cgroup, ok := cgroups[pid]
+		if !ok {
+			cgroup = agentCgroup
+		}
+		if err := memory.WriteFile(filepath.Join("/proc", pid, "cgroup"), []byte(cgroup), 0444); err != nil {
+			t.Fatalf("error writing process cgroup: %v", err)
+		}
+	}
+	return memory
+}
+
+func TestServerDetector(t *testing.T) {
+	tests := []struct {
+		name           string
+		processes      map[string]string
+		cgroups        map[string]string
+		pidFile        string
+		opts           []ServerDetectorOption
+		wantState      ServerState
+		wantPID        int
+		wantDetectedBy string
+		wantErr        bool
+	}{
+		{
+			name:      "no sources",
+			wantState: ServerStateStopped,
+		},
+		{
+			name:           "pid file",
+			processes:      map[string]string{"1": "tini", "42": "mariadbd"},
+			pidFile:        "42",
+			opts:           []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid"), WithProcessTable("/proc")},
+			wantState:      ServerStateRunning,
+			wantPID:        42,
+			wantDetectedBy: detectedByPIDFile,
+		},
+		{
+			name:           "pid file without process table",
+			pidFile:        "42",
+			opts:           []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid")},
+			wantState:      ServerStateRunning,
+			wantPID:        42,
+			wantDetectedBy: detectedByPIDFile,
+		},
+		{
+			name:      "stale pid file",
+			processes: map[string]string{"1": "pause", "7": "agent", "42": "bash"},
+			cgroups:   map[string]string{"1": "0::/../pause\n", "42": "0::/../mariadb\n"},
+			pidFile:   "42",
+			opts:      []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid"), WithProcessTable("/proc")},
+			wantState: ServerStateStopped,
+		},
+		{
+			name:      "pid file not visible in shared process table",
+			processes: map[string]string{"1": "pause", "7": "agent"},
+			cgroups:   map[string]string{"1": "0::/../pause\n"},
+			pidFile:   "42",
+			opts:      []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid"), WithProcessTable("/proc")},
+			wantState: ServerStateStopped,
+		},
+		{
+			name:           "pid file not visible in process table not shared",
+			processes:      map[string]string{"1": "tini", "7": "agent"},
+			pidFile:        "42",
+			opts:           []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid"), WithProcessTable("/proc")},
+			wantState:      ServerStateRunning,
+			wantPID:        42,
+			wantDetectedBy: detectedByPIDFile,
+		},
+		{
+			name:           "pid file of another process in process table not shared",
+			processes:      map[string]string{"1": "tini", "42": "bash"},
+			pidFile:        "42",
+			opts:           []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid"), WithProcessTable("/proc")},
+			wantState:      ServerStateRunning,
+			wantPID:        42,
+			wantDetectedBy: detectedByPIDFile,
+		},
+		{
+			name:      "invalid pid file",
+			pidFile:   "foo",
+			opts:      []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid")},
+			wantState: ServerStateStopped,
+		},
+		{
+			name:           "empty pid file with process table",
+			processes:      map[string]string{"1": "tini", "42": "mariadbd"},
+			pidFile:        " ",
+			opts:           []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid"), WithProcessTable("/proc")},
+			wantState:      ServerStateRunning,
+			wantPID:        42,
+			wantDetectedBy: detectedByProcessTable,
+		},
+		{
+			name:      "missing pid file",
+			opts:      []ServerDetectorOption{WithPIDFile("/var/lib/mysql/mariadb.pid")},
+			wantState: ServerStateStopped,
+		},
+		{
+			name:           "process table",
+			processes:      map[string]string{"1": "tini", "7": "mysqld"},
+			opts:           []ServerDetectorOption{WithProcessTable("/proc")},
+			wantState:      ServerStateRunning,
+			wantPID:        7,
+			wantDetectedBy: detectedByProcessTable,
+		},
+		{
+			name:      "process table without mariadbd",
+			processes: map[string]string{"1": "tini", "7": "agent"},
+			opts:      []ServerDetectorOption{WithProcessTable("/proc")},
+			wantState: ServerStateStopped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := newProcFS(t, tt.processes, tt.cgroups)
+			if tt.pidFile != "" {
+				if err := memory.WriteFile("/var/lib/mysql/mariadb.pid", []byte(tt.pidFile+"\n"), 0644); err != nil {
+					t.Fatalf("error writing pid file: %v", err)
+				}
+			}
+			detector := NewServerDetector(append(tt.opts, WithFS(memory))...)
+
+			status, err := detector.Status(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status.State != tt.wantState || status.PID != tt.wantPID || status.DetectedBy != tt.wantDetectedBy {
+				t.Fatalf("unexpected status: %+v", status)
+			}
+		})
+	}
+}
+
+func TestServerDetectorSharesProcessTable(t *testing.T) {
+	tests := []struct {
+		name       string
+		processes  map[string]string
+		cgroups    map[string]string
+		opts       []ServerDetectorOption
+		wantShared bool
+	}{
+		{
+			name:       "no process table",
+			processes:  map[string]string{"1": "pause", "7": "agent"},
+			cgroups:    map[string]string{"1": "0::/../pause\n"},
+			wantShared: false,
+		},
+		{
+			name:       "own process namespace",
+			processes:  map[string]string{"1": "tini", "7": "agent", "12": "bash"},
+			opts:       []ServerDetectorOption{WithProcessTable("/proc")},
+			wantShared: false,
+		},
+		{
+			name:       "shared process namespace",
+			processes:  map[string]string{"1": "pause", "7": "agent", "12": "mariadbd"},
+			cgroups:    map[string]string{"1": "0::/../pause\n", "12": "0::/../mariadb\n"},
+			opts:       []ServerDetectorOption{WithProcessTable("/proc")},
+			wantShared: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := newProcFS(t, tt.processes, tt.cgroups)
+			detector := NewServerDetector(append(tt.opts, WithFS(memory))...)
+
+			shared, err := detector.SharesProcessTable()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if shared != tt.wantShared {
+				t.Fatalf("unexpected shared process table: expected %v, got %v", tt.wantShared, shared)
+			}
+		})
+	}
+}
+
+func TestServerDetectorSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mysqld.sock")
+	detector := NewServerDetector(WithSocket(socket))
+
+	status, err := detector.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Running() {
+		t.Fatalf("expected server to be stopped, got %+v", status)
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("error listening on socket: %v", err)
+	}
+	defer listener.Close()
+
+	status, err = detector.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !status.Running() || status.DetectedBy != detectedBySocket {
+		t.Fatalf("expected server to be running, got %+v", status)
+	}
+}
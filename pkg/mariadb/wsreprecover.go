@@ -0,0 +1,82 @@
+package mariadb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	defaultWsrepRecoverBinary = "mariadbd"
+	maxWsrepRecoverOutput     = 4096
+)
+
+type WsrepRecoverOption func(*WsrepRecover)
+
+func WithWsrepRecoverBinary(binary string) WsrepRecoverOption {
+	return func(w *WsrepRecover) {
+		w.binary = binary
+	}
+}
+
+// WithWsrepRecoverArgs sets extra arguments passed to the binary before the recovery ones,
+// for example --defaults-file or --user.
+func WithWsrepRecoverArgs(args []string) WsrepRecoverOption {
+	return func(w *WsrepRecover) {
+		w.args = args
+	}
+}
+
+// WsrepRecover runs mariadbd with --wsrep-recover against the datadir as a subprocess, which logs the last
+// committed position and exits. This avoids restarting the container with the recovery config.
+type WsrepRecover struct {
+	dataDir string
+	logFile string
+	binary  string
+	args    []string
+}
+
+func NewWsrepRecover(dataDir, logFile string, opts ...WsrepRecoverOption) *WsrepRecover {
+	wsrepRecover := &WsrepRecover{
+		dataDir: dataDir,
+		logFile: logFile,
+		binary:  defaultWsrepRecoverBinary,
+	}
+	for _, setOpt := range opts {
+		setOpt(wsrepRecover)
+	}
+	return wsrepRecover
+}
+
+// Run runs the recovery until the process exits or the context is done. The recovered position is written to
+// the log file, to be parsed by the caller.
+func (w *WsrepRecover) Run(ctx context.Context) error {
+	args := append([]string{}, w.args...)
+	args = append(args,
+		"--wsrep-recover",
+		fmt.Sprintf("--datadir=%s", w.dataDir),
+		fmt.Sprintf("--log-error=%s", w.logFile),
+	)
+	cmd := exec.CommandContext(ctx, w.binary, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("error running %s: %v", w.binary, ctxErr)
+		}
+		return fmt.Errorf("error running %s: %v: %s", w.binary, err, truncateOutput(output.String()))
+	}
+	return nil
+}
+
+func truncateOutput(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxWsrepRecoverOutput {
+		return "..." + output[len(output)-maxWsrepRecoverOutput:]
+	}
+	return output
+}
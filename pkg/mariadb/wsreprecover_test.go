@@ -0,0 +1,75 @@
+package mariadb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mariadb-operator/agent/pkg/mariadb/mariadbtest"
+)
+
+func TestWsrepRecover(t *testing.T) {
+	tests := []struct {
+		name        string
+		commands    string
+		timeout     time.Duration
+		wantLog     string
+		wantErrText string
+	}{
+		{
+			name: "recovered",
+			commands: `echo "$@" > "$log"
+echo "[Note] WSREP: Recovered position: 05f061bd-02a3-11ee-857c-aa370ff6666b:42" >> "$log"`,
+			timeout: 5 * time.Second,
+			wantLog: "--defaults-file=/etc/mysql/my.cnf --wsrep-recover --datadir=",
+		},
+		{
+			name:        "failed",
+			commands:    `echo "[ERROR] Aborting" >&2; exit 1`,
+			timeout:     5 * time.Second,
+			wantErrText: "[ERROR] Aborting",
+		},
+		{
+			name:        "timeout",
+			commands:    `exec sleep 10`,
+			timeout:     100 * time.Millisecond,
+			wantErrText: "context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			logFile := filepath.Join(dataDir, "mariadb.err")
+			wsrepRecover := NewWsrepRecover(
+				dataDir,
+				logFile,
+				WithWsrepRecoverBinary(mariadbtest.NewFakeMariaDB(t, tt.commands)),
+				WithWsrepRecoverArgs([]string{"--defaults-file=/etc/mysql/my.cnf"}),
+			)
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			err := wsrepRecover.Run(ctx)
+			if tt.wantErrText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErrText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			bytes, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatalf("error reading log: %v", err)
+			}
+			if !strings.HasPrefix(string(bytes), tt.wantLog) {
+				t.Fatalf("unexpected log: %s", bytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+const (
+	zeroUUID = "00000000-0000-0000-0000-000000000000"
+)
+
+// ElectBootstrap picks the node to bootstrap the cluster from. A node marked as safe to bootstrap is preferred,
+// otherwise the node with the highest seqno is elected. Ties are broken by node name to be deterministic.
+func ElectBootstrap(galeraStates map[string]*galera.GaleraState, recovered map[string]*galera.Bootstrap) (string,
+	*galera.Bootstrap, error) {
+	nodes := make([]string, 0, len(galeraStates)+len(recovered))
+	positions := make(map[string]*galera.Bootstrap)
+	for node, galeraState := range galeraStates {
+		if galeraState == nil || galeraState.Seqno < 0 || galeraState.UUID == zeroUUID {
+			continue
+		}
+		positions[node] = &galera.Bootstrap{
+			UUID:  galeraState.UUID,
+			Seqno: galeraState.Seqno,
+		}
+	}
+	for node, bootstrap := range recovered {
+		if bootstrap == nil || bootstrap.Seqno < 0 || bootstrap.UUID == zeroUUID {
+			continue
+		}
+		positions[node] = bootstrap
+	}
+	for node := range positions {
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return "", nil, errors.New("no node with a valid position found")
+	}
+	sort.Strings(nodes)
+
+	uuid := positions[nodes[0]].UUID
+	for _, node := range nodes {
+		if positions[node].UUID != uuid {
+			return "", nil, fmt.Errorf("inconsistent cluster UUIDs: node '%s' has '%s', node '%s' has '%s'",
+				nodes[0], uuid, node, positions[node].UUID)
+		}
+	}
+
+	for _, node := range nodes {
+		if galeraState, ok := galeraStates[node]; ok && galeraState != nil && galeraState.SafeToBootstrap {
+			return node, positions[node], nil
+		}
+	}
+
+	elected := nodes[0]
+	for _, node := range nodes[1:] {
+		if positions[node].Compare(positions[elected]) > 0 {
+			elected = node
+		}
+	}
+	return elected, positions[elected], nil
+}
@@ -0,0 +1,88 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+func TestElectBootstrap(t *testing.T) {
+	uuid := "05f061bd-02a3-11ee-857c-aa370ff6666b"
+	tests := []struct {
+		name         string
+		galeraStates map[string]*galera.GaleraState
+		recovered    map[string]*galera.Bootstrap
+		wantNode     string
+		wantSeqno    int
+		wantErr      bool
+	}{
+		{
+			name: "safe to bootstrap",
+			galeraStates: map[string]*galera.GaleraState{
+				"mariadb-0": {UUID: uuid, Seqno: 10},
+				"mariadb-1": {UUID: uuid, Seqno: 5, SafeToBootstrap: true},
+			},
+			wantNode:  "mariadb-1",
+			wantSeqno: 5,
+		},
+		{
+			name: "highest seqno",
+			galeraStates: map[string]*galera.GaleraState{
+				"mariadb-0": {UUID: uuid, Seqno: 3},
+				"mariadb-1": {UUID: uuid, Seqno: -1},
+				"mariadb-2": {UUID: uuid, Seqno: -1},
+			},
+			recovered: map[string]*galera.Bootstrap{
+				"mariadb-1": {UUID: uuid, Seqno: 7},
+				"mariadb-2": {UUID: uuid, Seqno: 4},
+			},
+			wantNode:  "mariadb-1",
+			wantSeqno: 7,
+		},
+		{
+			name: "tie broken by name",
+			recovered: map[string]*galera.Bootstrap{
+				"mariadb-2": {UUID: uuid, Seqno: 4},
+				"mariadb-1": {UUID: uuid, Seqno: 4},
+			},
+			wantNode:  "mariadb-1",
+			wantSeqno: 4,
+		},
+		{
+			name: "inconsistent uuids",
+			recovered: map[string]*galera.Bootstrap{
+				"mariadb-0": {UUID: uuid, Seqno: 4},
+				"mariadb-1": {UUID: "6f1b2e3a-02a3-11ee-857c-aa370ff6666b", Seqno: 4},
+			},
+			wantErr: true,
+		},
+		{
+			name: "no valid position",
+			galeraStates: map[string]*galera.GaleraState{
+				"mariadb-0": {UUID: zeroUUID, Seqno: -1},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, bootstrap, err := ElectBootstrap(tt.galeraStates, tt.recovered)
+			if tt.wantErr && err == nil {
+				t.Fatal("error expected, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("error unexpected, got %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if node != tt.wantNode {
+				t.Fatalf("unexpected node: expected %s, got %s", tt.wantNode, node)
+			}
+			if bootstrap.Seqno != tt.wantSeqno {
+				t.Fatalf("unexpected seqno: expected %d, got %d", tt.wantSeqno, bootstrap.Seqno)
+			}
+		})
+	}
+}
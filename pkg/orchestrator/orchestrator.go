@@ -0,0 +1,323 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/client"
+	"github.com/mariadb-operator/agent/pkg/galera"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type RestartPodFunc func(ctx context.Context, node string) error
+
+type ProgressFunc func(state *State)
+
+type Option func(*Orchestrator)
+
+func WithProgressHook(progress ProgressFunc) Option {
+	return func(o *Orchestrator) {
+		o.progress = progress
+	}
+}
+
+func WithRecoveryTimeout(timeout time.Duration) Option {
+	return func(o *Orchestrator) {
+		o.recoveryTimeout = timeout
+	}
+}
+
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *Orchestrator) {
+		o.pollInterval = interval
+	}
+}
+
+func WithRestartAll(restartAll bool) Option {
+	return func(o *Orchestrator) {
+		o.restartAll = restartAll
+	}
+}
+
+// WithAgentRecovery recovers the nodes by letting the agents run mariadbd with --wsrep-recover themselves,
+// instead of enabling the recovery and restarting the pods.
+func WithAgentRecovery(agentRecovery bool) Option {
+	return func(o *Orchestrator) {
+		o.agentRecovery = agentRecovery
+	}
+}
+
+// WithForce enables the bootstrap even on the nodes where the agent detects a running mariadbd when recovering
+// with WithAgentRecovery. The agent recovery itself always requires mariadbd to be stopped. Without the agent
+// recovery the mutations are always forced, see mutationOptions.
+func WithForce(force bool) Option {
+	return func(o *Orchestrator) {
+		o.force = force
+	}
+}
+
+func WithLogger(logger logr.Logger) Option {
+	return func(o *Orchestrator) {
+		o.logger = logger
+	}
+}
+
+type Orchestrator struct {
+	cluster         *client.ClusterClient
+	restartPod      RestartPodFunc
+	progress        ProgressFunc
+	recoveryTimeout time.Duration
+	pollInterval    time.Duration
+	restartAll      bool
+	agentRecovery   bool
+	force           bool
+	logger          logr.Logger
+}
+
+func NewOrchestrator(cluster *client.ClusterClient, restartPod RestartPodFunc, opts ...Option) (*Orchestrator, error) {
+	if cluster == nil {
+		return nil, errors.New("cluster client must be provided")
+	}
+	if restartPod == nil {
+		return nil, errors.New("restart pod function must be provided")
+	}
+	orchestrator := &Orchestrator{
+		cluster:         cluster,
+		restartPod:      restartPod,
+		recoveryTimeout: 5 * time.Minute,
+		pollInterval:    5 * time.Second,
+		restartAll:      true,
+		logger:          logr.Discard(),
+	}
+	for _, setOpt := range opts {
+		setOpt(orchestrator)
+	}
+	return orchestrator, nil
+}
+
+// Run executes the recovery phases starting from the phase recorded in the state. A nil state starts a new recovery.
+// The state is returned even on error, so the caller can persist it and resume later.
+func (o *Orchestrator) Run(ctx context.Context, state *State) (*State, error) {
+	if state == nil {
+		state = NewState()
+	}
+	if state.GaleraStates == nil {
+		state.GaleraStates = make(map[string]*galera.GaleraState)
+	}
+	if state.Recovered == nil {
+		state.Recovered = make(map[string]*galera.Bootstrap)
+	}
+
+	for !state.Completed() {
+		o.logger.Info("running phase", "phase", state.Phase)
+		if err := o.runPhase(ctx, state); err != nil {
+			return state, fmt.Errorf("error running phase '%s': %v", state.Phase, err)
+		}
+		state.Phase = state.Phase.next()
+		o.reportProgress(state)
+	}
+	return state, nil
+}
+
+func (o *Orchestrator) runPhase(ctx context.Context, state *State) error {
+	switch state.Phase {
+	case PhaseGetGaleraState:
+		return o.getGaleraState(ctx, state)
+	case PhaseRecover:
+		return o.recover(ctx, state)
+	case PhaseElectBootstrap:
+		return o.electBootstrap(state)
+	case PhaseDisableBootstrap:
+		return o.disableBootstrap(ctx, state)
+	case PhaseEnableBootstrap:
+		return o.enableBootstrap(ctx, state)
+	case PhaseDisableRecovery:
+		return o.cluster.DisableRecovery(ctx).Err()
+	case PhaseRestart:
+		return o.restart(ctx, state)
+	default:
+		return fmt.Errorf("unknown phase '%s'", state.Phase)
+	}
+}
+
+func (o *Orchestrator) getGaleraState(ctx context.Context, state *State) error {
+	for _, result := range o.cluster.GaleraStates(ctx) {
+		if result.Err != nil {
+			if client.IsNotFound(result.Err) {
+				o.logger.Info("galera state not found, node will be recovered", "node", result.Node)
+				continue
+			}
+			return fmt.Errorf("error getting galera state from node '%s': %v", result.Node, result.Err)
+		}
+		state.GaleraStates[result.Node] = result.Value
+	}
+	return nil
+}
+
+func (o *Orchestrator) recover(ctx context.Context, state *State) error {
+	var nodes []string
+	for _, node := range o.cluster.Nodes() {
+		if state.needsRecovery(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	o.logger.Info("recovering nodes", "nodes", nodes)
+	subset, err := o.cluster.Subset(nodes)
+	if err != nil {
+		return err
+	}
+
+	var mux sync.Mutex
+	results := subset.ForEach(ctx, func(ctx context.Context, node string, c client.Interface) error {
+		bootstrap, err := o.recoverNode(ctx, node, c)
+		if err != nil {
+			return err
+		}
+		mux.Lock()
+		defer mux.Unlock()
+		state.Recovered[node] = bootstrap
+		o.reportProgress(state)
+		return nil
+	})
+	return results.Err()
+}
+
+func (o *Orchestrator) recoverNode(ctx context.Context, node string, c client.Interface) (*galera.Bootstrap, error) {
+	// A position recovered before the operator restarted is still valid as long as the agent keeps it.
+	result, err := c.RecoveryClient().Result(ctx)
+	if err != nil && !client.IsNotFound(err) {
+		o.logger.V(1).Info("error getting recovery result, recovering", "node", node, "err", err)
+	}
+	if err == nil && result != nil {
+		o.logger.Info("node already recovered", "node", node, "uuid", result.UUID, "seqno", result.Seqno,
+			"recoveredAt", result.Timestamp)
+		return &result.Bootstrap, nil
+	}
+
+	if o.agentRecovery {
+		recoveryCtx, cancel := context.WithTimeout(ctx, o.recoveryTimeout)
+		defer cancel()
+
+		// Force is never passed: the agent would launch a second mariadbd against the datadir of the running one.
+		bootstrap, err := c.RecoveryClient().Run(recoveryCtx)
+		if err != nil {
+			return nil, fmt.Errorf("error running recovery: %v", err)
+		}
+		o.logger.Info("node recovered", "node", node, "uuid", bootstrap.UUID, "seqno", bootstrap.Seqno)
+		return bootstrap, nil
+	}
+	if err := c.RecoveryClient().Enable(ctx, o.mutationOptions()...); err != nil {
+		return nil, fmt.Errorf("error enabling recovery: %v", err)
+	}
+	if err := o.restartPod(ctx, node); err != nil {
+		return nil, fmt.Errorf("error restarting pod: %v", err)
+	}
+
+	recoveryCtx, cancel := context.WithTimeout(ctx, o.recoveryTimeout)
+	defer cancel()
+
+	var bootstrap *galera.Bootstrap
+	err = wait.PollUntilContextCancel(recoveryCtx, o.pollInterval, true, func(ctx context.Context) (bool, error) {
+		b, err := c.RecoveryClient().Start(ctx)
+		if err != nil {
+			o.logger.V(1).Info("error starting recovery, retrying", "node", node, "err", err)
+			return false, nil
+		}
+		bootstrap = b
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error recovering node: %v", err)
+	}
+	o.logger.Info("node recovered", "node", node, "uuid", bootstrap.UUID, "seqno", bootstrap.Seqno)
+	return bootstrap, nil
+}
+
+func (o *Orchestrator) electBootstrap(state *State) error {
+	node, bootstrap, err := ElectBootstrap(state.GaleraStates, state.Recovered)
+	if err != nil {
+		return err
+	}
+	o.logger.Info("bootstrap node elected", "node", node, "uuid", bootstrap.UUID, "seqno", bootstrap.Seqno)
+	state.BootstrapNode = node
+	state.Bootstrap = bootstrap
+	return nil
+}
+
+// disableBootstrap disables the bootstrap on every node but the elected one. Nodes without bootstrap config are
+// skipped, as the cluster client ignores the not found errors.
+func (o *Orchestrator) disableBootstrap(ctx context.Context, state *State) error {
+	if state.BootstrapNode == "" {
+		return errors.New("bootstrap node not elected")
+	}
+	var nodes []string
+	for _, node := range o.cluster.Nodes() {
+		if node != state.BootstrapNode {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	subset, err := o.cluster.Subset(nodes)
+	if err != nil {
+		return err
+	}
+	return subset.DisableBootstrap(ctx).Err()
+}
+
+func (o *Orchestrator) enableBootstrap(ctx context.Context, state *State) error {
+	if state.BootstrapNode == "" || state.Bootstrap == nil {
+		return errors.New("bootstrap node not elected")
+	}
+	c, err := o.cluster.Node(state.BootstrapNode)
+	if err != nil {
+		return err
+	}
+	return c.BootstrapClient().Enable(ctx, state.Bootstrap, o.mutationOptions()...)
+}
+
+// mutationOptions forces the mutations when recovering by restarting the pods: mariadbd is usually running,
+// waiting for a primary component that will never come, and the pod is restarted right after the mutation.
+func (o *Orchestrator) mutationOptions() []client.MutationOption {
+	if o.force || !o.agentRecovery {
+		return []client.MutationOption{client.WithForce()}
+	}
+	return nil
+}
+
+func (o *Orchestrator) restart(ctx context.Context, state *State) error {
+	nodes := []string{state.BootstrapNode}
+	if o.restartAll {
+		for _, node := range o.cluster.Nodes() {
+			if node != state.BootstrapNode {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	for _, node := range nodes {
+		if state.restarted(node) {
+			continue
+		}
+		o.logger.Info("restarting pod", "node", node)
+		if err := o.restartPod(ctx, node); err != nil {
+			return fmt.Errorf("error restarting pod '%s': %v", node, err)
+		}
+		state.Restarted = append(state.Restarted, node)
+		o.reportProgress(state)
+	}
+	return nil
+}
+
+func (o *Orchestrator) reportProgress(state *State) {
+	if o.progress != nil {
+		o.progress(state)
+	}
+}
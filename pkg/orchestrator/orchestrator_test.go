@@ -0,0 +1,331 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/agenttest"
+	"github.com/mariadb-operator/agent/pkg/client"
+	"github.com/mariadb-operator/agent/pkg/client/mock"
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+func TestRecoverNode(t *testing.T) {
+	var restarted []string
+	orchestrator := &Orchestrator{
+		restartPod: func(ctx context.Context, node string) error {
+			restarted = append(restarted, node)
+			return nil
+		},
+		recoveryTimeout: time.Second,
+		pollInterval:    time.Millisecond,
+		logger:          logr.Discard(),
+	}
+
+	c := mock.NewClient()
+	c.Recovery.StartFunc = func(ctx context.Context) (*galera.Bootstrap, error) {
+		if c.Recovery.Calls("Start") < 3 {
+			return nil, errors.New("recovery log not found")
+		}
+		return &galera.Bootstrap{UUID: "05f061bd-02a3-11ee-857c-aa370ff6666b", Seqno: 5}, nil
+	}
+
+	bootstrap, err := orchestrator.recoverNode(context.Background(), "mariadb-0", c)
+	if err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+	if bootstrap.Seqno != 5 {
+		t.Fatalf("unexpected seqno: expected 5, got %d", bootstrap.Seqno)
+	}
+	if n := c.Recovery.Calls("Enable"); n != 1 {
+		t.Fatalf("unexpected recovery enable calls: expected 1, got %d", n)
+	}
+	if n := c.Recovery.Calls("Start"); n != 3 {
+		t.Fatalf("unexpected recovery start calls: expected 3, got %d", n)
+	}
+	if len(restarted) != 1 || restarted[0] != "mariadb-0" {
+		t.Fatalf("unexpected restarted pods: %v", restarted)
+	}
+}
+
+func TestRecoverNodeByAgent(t *testing.T) {
+	orchestrator := &Orchestrator{
+		restartPod: func(ctx context.Context, node string) error {
+			t.Fatalf("unexpected pod restart: %s", node)
+			return nil
+		},
+		recoveryTimeout: time.Second,
+		agentRecovery:   true,
+		logger:          logr.Discard(),
+	}
+
+	c := mock.NewClient()
+	c.Recovery.RunFunc = func(ctx context.Context) (*galera.Bootstrap, error) {
+		return &galera.Bootstrap{UUID: "05f061bd-02a3-11ee-857c-aa370ff6666b", Seqno: 7}, nil
+	}
+
+	bootstrap, err := orchestrator.recoverNode(context.Background(), "mariadb-0", c)
+	if err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+	if bootstrap.Seqno != 7 {
+		t.Fatalf("unexpected seqno: expected 7, got %d", bootstrap.Seqno)
+	}
+	if n := c.Recovery.Calls("Run"); n != 1 {
+		t.Fatalf("unexpected recovery run calls: expected 1, got %d", n)
+	}
+	if n := c.Recovery.Calls("Enable"); n != 0 {
+		t.Fatalf("unexpected recovery enable calls: expected 0, got %d", n)
+	}
+}
+
+func TestRecoverNodeResult(t *testing.T) {
+	orchestrator := &Orchestrator{
+		restartPod: func(ctx context.Context, node string) error {
+			t.Fatalf("unexpected pod restart: %s", node)
+			return nil
+		},
+		recoveryTimeout: time.Second,
+		logger:          logr.Discard(),
+	}
+
+	c := mock.NewClient()
+	c.Recovery.ResultFunc = func(ctx context.Context) (*galera.RecoveryResult, error) {
+		return &galera.RecoveryResult{
+			Bootstrap: galera.Bootstrap{UUID: "05f061bd-02a3-11ee-857c-aa370ff6666b", Seqno: 9},
+			Timestamp: time.Now(),
+		}, nil
+	}
+
+	bootstrap, err := orchestrator.recoverNode(context.Background(), "mariadb-0", c)
+	if err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+	if bootstrap.Seqno != 9 {
+		t.Fatalf("unexpected seqno: expected 9, got %d", bootstrap.Seqno)
+	}
+	for _, method := range []string{"Enable", "Start", "Run"} {
+		if n := c.Recovery.Calls(method); n != 0 {
+			t.Fatalf("unexpected recovery %s calls: expected 0, got %d", method, n)
+		}
+	}
+}
+
+func TestRunMock(t *testing.T) {
+	uuid := "05f061bd-02a3-11ee-857c-aa370ff6666b"
+	seqnos := map[string]int{
+		"mariadb-0": 10,
+		"mariadb-1": -1,
+		"mariadb-2": 5,
+	}
+	clients := make(map[string]*mock.Client)
+	for node, seqno := range seqnos {
+		seqno := seqno
+		c := mock.NewClient()
+		c.GaleraState.GetFunc = func(ctx context.Context) (*galera.GaleraState, error) {
+			return &galera.GaleraState{Version: "2.1", UUID: uuid, Seqno: seqno}, nil
+		}
+		c.Recovery.StartFunc = func(ctx context.Context) (*galera.Bootstrap, error) {
+			return &galera.Bootstrap{UUID: uuid, Seqno: 12}, nil
+		}
+		clients[node] = c
+	}
+	var forced bool
+	clients["mariadb-1"].Bootstrap.EnableFunc = func(ctx context.Context, bootstrap *galera.Bootstrap,
+		opts ...client.MutationOption) error {
+		if bootstrap.Seqno != 12 {
+			t.Errorf("unexpected bootstrap seqno: expected 12, got %d", bootstrap.Seqno)
+		}
+		forced = len(opts) > 0
+		return nil
+	}
+
+	var restarted []string
+	orchestrator, err := NewOrchestrator(
+		client.NewClusterClientFromClients(clients),
+		func(ctx context.Context, node string) error {
+			restarted = append(restarted, node)
+			return nil
+		},
+		WithPollInterval(time.Millisecond),
+		WithRecoveryTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("error creating orchestrator: %v", err)
+	}
+	state, err := orchestrator.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+	if !state.Completed() || state.BootstrapNode != "mariadb-1" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	if !forced {
+		t.Fatal("expected bootstrap to be forced")
+	}
+	for node, c := range clients {
+		if n := c.Recovery.Calls("Enable"); (node == "mariadb-1") != (n == 1) {
+			t.Fatalf("unexpected recovery enable calls in node '%s': %d", node, n)
+		}
+		if n := c.Recovery.Calls("Disable"); n != 1 {
+			t.Fatalf("unexpected recovery disable calls in node '%s': expected 1, got %d", node, n)
+		}
+		wantBootstrap := node == "mariadb-1"
+		if n := c.Bootstrap.Calls("Enable"); (n == 1) != wantBootstrap {
+			t.Fatalf("unexpected bootstrap enable calls in node '%s': %d", node, n)
+		}
+		if n := c.Bootstrap.Calls("Disable"); (n == 1) == wantBootstrap {
+			t.Fatalf("unexpected bootstrap disable calls in node '%s': %d", node, n)
+		}
+	}
+	// The recovered node is restarted to recover it, then every node to bootstrap the cluster.
+	if len(restarted) != 4 || restarted[0] != "mariadb-1" || restarted[1] != "mariadb-1" {
+		t.Fatalf("unexpected restarted pods: %v", restarted)
+	}
+}
+
+func TestRunResumeDisablesBootstrap(t *testing.T) {
+	uuid := "05f061bd-02a3-11ee-857c-aa370ff6666b"
+	seqnos := map[string]int{
+		"mariadb-0": 10,
+		"mariadb-1": 5,
+		"mariadb-2": 3,
+	}
+	servers := make(map[string]*agenttest.Server)
+	clients := make(map[string]*client.Client)
+	galeraStates := make(map[string]*galera.GaleraState)
+	for node, seqno := range seqnos {
+		galeraState := &galera.GaleraState{Version: "2.1", UUID: uuid, Seqno: seqno}
+		server, err := agenttest.NewServer(agenttest.WithGaleraState(galeraState))
+		if err != nil {
+			t.Fatalf("error creating server: %v", err)
+		}
+		t.Cleanup(server.Close)
+		c, err := server.Client()
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+		servers[node] = server
+		clients[node] = c
+		galeraStates[node] = galeraState
+	}
+	// A previous run elected mariadb-1 and was interrupted after enabling its bootstrap.
+	if err := clients["mariadb-1"].Bootstrap.Enable(context.Background(), &galera.Bootstrap{UUID: uuid, Seqno: 5}); err != nil {
+		t.Fatalf("error enabling bootstrap: %v", err)
+	}
+
+	var restarted []string
+	orchestrator, err := NewOrchestrator(
+		client.NewClusterClientFromClients(clients),
+		func(ctx context.Context, node string) error {
+			restarted = append(restarted, node)
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("error creating orchestrator: %v", err)
+	}
+	state, err := orchestrator.Run(context.Background(), &State{
+		Phase:        PhaseElectBootstrap,
+		GaleraStates: galeraStates,
+	})
+	if err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+	if !state.Completed() || state.BootstrapNode != "mariadb-0" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	for node, server := range servers {
+		wantBootstrap := node == "mariadb-0"
+		if bootstrap := server.FS().ConfigFileExists(galera.BootstrapFileName); bootstrap != wantBootstrap {
+			t.Fatalf("unexpected bootstrap config in node '%s': expected %v, got %v", node, wantBootstrap, bootstrap)
+		}
+	}
+	if len(restarted) != 3 || restarted[0] != "mariadb-0" {
+		t.Fatalf("unexpected restarted pods: %v", restarted)
+	}
+}
+
+func TestRunRestartsRunningNodes(t *testing.T) {
+	uuid := "05f061bd-02a3-11ee-857c-aa370ff6666b"
+	seqnos := map[string]int{
+		"mariadb-0": 3,
+		"mariadb-1": 10,
+		"mariadb-2": 5,
+	}
+	servers := make(map[string]*agenttest.Server)
+	clients := make(map[string]*client.Client)
+	for node := range seqnos {
+		// mariadbd keeps running after losing the quorum, waiting for a primary component.
+		server, err := agenttest.NewServer(agenttest.WithGaleraState(&galera.GaleraState{Version: "2.1", UUID: uuid, Seqno: -1}))
+		if err != nil {
+			t.Fatalf("error creating server: %v", err)
+		}
+		t.Cleanup(server.Close)
+		if err := server.SetServerRunning(true); err != nil {
+			t.Fatalf("error setting server running: %v", err)
+		}
+		c, err := server.Client()
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+		servers[node] = server
+		clients[node] = c
+	}
+
+	var mux sync.Mutex
+	var restarted []string
+	restartPod := func(ctx context.Context, node string) error {
+		mux.Lock()
+		restarted = append(restarted, node)
+		mux.Unlock()
+
+		server := servers[node]
+		if !server.FS().ConfigFileExists(galera.RecoveryFileName) {
+			return nil
+		}
+		log := fmt.Sprintf("[Note] WSREP: Recovered position: %s:%d\n", uuid, seqnos[node])
+		return server.SetRecoveryLog([]byte(log))
+	}
+	orchestrator, err := NewOrchestrator(
+		client.NewClusterClientFromClients(clients),
+		restartPod,
+		WithPollInterval(10*time.Millisecond),
+		WithRecoveryTimeout(5*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("error creating orchestrator: %v", err)
+	}
+	state, err := orchestrator.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("error unexpected, got %v", err)
+	}
+	if !state.Completed() || state.BootstrapNode != "mariadb-1" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	for node, server := range servers {
+		for _, route := range []agenttest.Route{agenttest.RouteEnableRecovery, agenttest.RouteEnableBootstrap} {
+			for _, call := range server.CallsTo(route) {
+				if call.StatusCode != http.StatusOK {
+					t.Fatalf("unexpected status code in node '%s' calling %s %s: %d", node, route.Method, route.Path, call.StatusCode)
+				}
+			}
+		}
+		wantBootstrap := node == "mariadb-1"
+		if bootstrap := server.FS().ConfigFileExists(galera.BootstrapFileName); bootstrap != wantBootstrap {
+			t.Fatalf("unexpected bootstrap config in node '%s': expected %v, got %v", node, wantBootstrap, bootstrap)
+		}
+	}
+	if n := len(servers["mariadb-1"].CallsTo(agenttest.RouteEnableBootstrap)); n != 1 {
+		t.Fatalf("unexpected bootstrap enable calls: expected 1, got %d", n)
+	}
+	if len(restarted) != 6 {
+		t.Fatalf("unexpected restarted pods: %v", restarted)
+	}
+}
@@ -0,0 +1,80 @@
+package orchestrator
+
+import (
+	"github.com/mariadb-operator/agent/pkg/galera"
+)
+
+type Phase string
+
+const (
+	PhaseGetGaleraState Phase = "GetGaleraState"
+	PhaseRecover        Phase = "Recover"
+	PhaseElectBootstrap Phase = "ElectBootstrap"
+	// PhaseDisableBootstrap removes the bootstrap config left on the other nodes by a previous run, which may have
+	// elected a different node. Two nodes with wsrep_new_cluster would start separate clusters.
+	PhaseDisableBootstrap Phase = "DisableBootstrap"
+	PhaseEnableBootstrap  Phase = "EnableBootstrap"
+	PhaseDisableRecovery  Phase = "DisableRecovery"
+	PhaseRestart          Phase = "Restart"
+	PhaseCompleted        Phase = "Completed"
+)
+
+var phases = []Phase{
+	PhaseGetGaleraState,
+	PhaseRecover,
+	PhaseElectBootstrap,
+	PhaseDisableBootstrap,
+	PhaseEnableBootstrap,
+	PhaseDisableRecovery,
+	PhaseRestart,
+	PhaseCompleted,
+}
+
+func (p Phase) next() Phase {
+	for i, phase := range phases {
+		if phase == p && i+1 < len(phases) {
+			return phases[i+1]
+		}
+	}
+	return PhaseCompleted
+}
+
+// State is the progress of a cluster recovery. It can be persisted by the caller after every phase
+// and passed back to Run to resume the recovery where it was left.
+type State struct {
+	Phase         Phase                          `json:"phase"`
+	GaleraStates  map[string]*galera.GaleraState `json:"galeraStates,omitempty"`
+	Recovered     map[string]*galera.Bootstrap   `json:"recovered,omitempty"`
+	BootstrapNode string                         `json:"bootstrapNode,omitempty"`
+	Bootstrap     *galera.Bootstrap              `json:"bootstrap,omitempty"`
+	Restarted     []string                       `json:"restarted,omitempty"`
+}
+
+func NewState() *State {
+	return &State{
+		Phase:        PhaseGetGaleraState,
+		GaleraStates: make(map[string]*galera.GaleraState),
+		Recovered:    make(map[string]*galera.Bootstrap),
+	}
+}
+
+func (s *State) Completed() bool {
+	return s.Phase == PhaseCompleted
+}
+
+func (s *State) needsRecovery(node string) bool {
+	if _, ok := s.Recovered[node]; ok {
+		return false
+	}
+	galeraState, ok := s.GaleraStates[node]
+	return !ok || galeraState == nil || galeraState.Seqno < 0
+}
+
+func (s *State) restarted(node string) bool {
+	for _, n := range s.Restarted {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
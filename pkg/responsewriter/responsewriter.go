@@ -2,10 +2,12 @@ package responsewriter
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/go-logr/logr"
 	"github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/requestid"
 )
 
 type ResponseWriter struct {
@@ -18,7 +20,25 @@ func NewResponseWriter(logger *logr.Logger) *ResponseWriter {
 	}
 }
 
+// Write encodes v as the JSON response. Server errors are logged along with the request ID, so they can be
+// correlated with the response received by the client.
 func (r *ResponseWriter) Write(w http.ResponseWriter, v any, statusCode int) {
+	requestID := w.Header().Get(requestid.Header)
+	if apiErr, ok := v.(*errors.APIError); ok && apiErr.RequestID == "" {
+		apiErr.RequestID = requestID
+	}
+	if statusCode >= http.StatusInternalServerError {
+		err, ok := v.(error)
+		if !ok {
+			err = fmt.Errorf("%v", v)
+		}
+		r.logger.Error(err, "error processing request", "statusCode", statusCode, "requestId", requestID)
+	}
+	r.WriteJSON(w, v, statusCode)
+}
+
+// WriteJSON encodes v as the JSON response without logging server errors, for handlers that log them already.
+func (r *ResponseWriter) WriteJSON(w http.ResponseWriter, v any, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	if err := json.NewEncoder(w).Encode(v); err != nil {
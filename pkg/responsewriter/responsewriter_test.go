@@ -0,0 +1,82 @@
+package responsewriter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/requestid"
+)
+
+func TestWriteLogsServerErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		wantLog    bool
+	}{
+		{
+			name:       "ok",
+			statusCode: http.StatusOK,
+			wantLog:    false,
+		},
+		{
+			name:       "client error",
+			statusCode: http.StatusConflict,
+			wantLog:    false,
+		},
+		{
+			name:       "server error",
+			statusCode: http.StatusInternalServerError,
+			wantLog:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs []string
+			logger := funcr.New(func(prefix, args string) {
+				logs = append(logs, args)
+			}, funcr.Options{})
+			responseWriter := NewResponseWriter(&logger)
+
+			rec := httptest.NewRecorder()
+			rec.Header().Set(requestid.Header, "test-request-id")
+			responseWriter.Write(rec, errors.NewAPIError("error recovering galera"), tt.statusCode)
+
+			if !tt.wantLog {
+				if len(logs) != 0 {
+					t.Fatalf("unexpected logs: %v", logs)
+				}
+				return
+			}
+			if len(logs) != 1 {
+				t.Fatalf("expected 1 log, got %v", logs)
+			}
+			for _, want := range []string{"error recovering galera", "test-request-id"} {
+				if !strings.Contains(logs[0], want) {
+					t.Fatalf("expected log to contain '%s', got %s", want, logs[0])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteJSONDoesNotLog(t *testing.T) {
+	var logs []string
+	logger := funcr.New(func(prefix, args string) {
+		logs = append(logs, args)
+	}, funcr.Options{})
+	responseWriter := NewResponseWriter(&logger)
+
+	rec := httptest.NewRecorder()
+	responseWriter.WriteJSON(rec, errors.NewAPIError("unhealthy"), http.StatusServiceUnavailable)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status code: expected %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if len(logs) != 0 {
+		t.Fatalf("unexpected logs: %v", logs)
+	}
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	middleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/requestid"
+)
+
+type accessLogEntry struct {
+	caller string
+}
+
+type accessLogContextKey struct{}
+
+// accessLog logs every request once it has been served. The caller is recorded by recordCaller,
+// which must be used after the authentication middleware.
+func accessLog(logger logr.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			entry := &accessLogEntry{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), accessLogContextKey{}, entry)))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := ""
+			if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil {
+				route = routeCtx.RoutePattern()
+			}
+			logger.Info("request",
+				"requestId", requestid.FromContext(r.Context()),
+				"method", r.Method,
+				"route", route,
+				"path", r.URL.Path,
+				"status", status,
+				"bytes", ww.BytesWritten(),
+				"latency", time.Since(start).String(),
+				"caller", entry.caller,
+				"remoteAddr", r.RemoteAddr,
+			)
+		})
+	}
+}
+
+func recordCaller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry, ok := r.Context().Value(accessLogContextKey{}).(*accessLogEntry)
+		if user, authenticated := authentication.UserFromContext(r.Context()); ok && authenticated {
+			entry.caller = user.Username
+		}
+		next.ServeHTTP(w, r)
+	})
+}
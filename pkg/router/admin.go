@@ -0,0 +1,82 @@
+package router
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+
+	chi "github.com/go-chi/chi/v5"
+	middleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/handler"
+	"github.com/mariadb-operator/agent/pkg/requestid"
+)
+
+// NewProbesRouter serves the unauthenticated endpoints used by the kubelet probes and metric scrapers.
+// The detailed health checks expose internal state, so they are only served by the authenticated /api/health.
+func NewProbesRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+
+	r.Get("/health", health)
+	r.Get("/metrics", metrics)
+
+	return r
+}
+
+// excludedMetrics are the default expvar variables that are not served to the unauthenticated scrapers:
+// cmdline exposes the agent flags and memstats is only useful for debugging. Both are still served by
+// /debug/vars in the authenticated admin router.
+var excludedMetrics = map[string]bool{
+	"cmdline":  true,
+	"memstats": true,
+}
+
+// metrics serves the expvar variables like expvar.Handler, without the excluded ones.
+func metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if excludedMetrics[kv.Key] {
+			return
+		}
+		if !first {
+			fmt.Fprintf(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
+
+// NewAdminRouter serves the log level and debug endpoints. They expose internal state, so they are authenticated
+// with the same options as the API.
+func NewAdminRouter(logLevel *handler.LogLevel, logger logr.Logger, opts ...Option) http.Handler {
+	routerOpts := Options{}
+	for _, setOpt := range opts {
+		setOpt(&routerOpts)
+	}
+	r := chi.NewRouter()
+	r.Use(middleware.Recoverer)
+	r.Use(requestid.Middleware)
+	r.Use(accessLog(logger.WithName("access")))
+	if routerOpts.Authenticator != nil {
+		r.Use(authentication.NewMiddleware(routerOpts.Authenticator, routerOpts.Authorizer, logger).Handler)
+		r.Use(recordCaller)
+	}
+
+	r.Route("/loglevel", func(r chi.Router) {
+		r.Get("/", logLevel.Get)
+		r.Put("/", logLevel.Put)
+		r.Delete("/", logLevel.Delete)
+	})
+	r.Mount("/debug", middleware.Profiler())
+
+	return r
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
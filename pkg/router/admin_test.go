@@ -0,0 +1,35 @@
+package router
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testRequests is published once, expvar panics when a variable is published twice.
+var testRequests = expvar.NewInt("router_test_requests")
+
+func TestProbesRouterMetrics(t *testing.T) {
+	testRequests.Set(3)
+	router := NewProbesRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: expected %d, got %d", http.StatusOK, rec.Code)
+	}
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&vars); err != nil {
+		t.Fatalf("error decoding metrics: %v", err)
+	}
+	if string(vars["router_test_requests"]) != "3" {
+		t.Fatalf("unexpected metric value: %s", vars["router_test_requests"])
+	}
+	for name := range excludedMetrics {
+		if _, ok := vars[name]; ok {
+			t.Fatalf("unexpected metric '%s'", name)
+		}
+	}
+}
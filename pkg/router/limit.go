@@ -0,0 +1,85 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/httprate"
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/errors"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+)
+
+func rateLimitAll(requests int, duration time.Duration, logger logr.Logger) func(http.Handler) http.Handler {
+	return httprate.Limit(
+		requests,
+		duration,
+		httprate.WithKeyFuncs(func(r *http.Request) (string, error) {
+			return "*", nil
+		}),
+		httprate.WithLimitHandler(limitHandler(duration, logger)),
+	)
+}
+
+func rateLimitByCaller(requests int, duration time.Duration, logger logr.Logger) func(http.Handler) http.Handler {
+	return httprate.Limit(
+		requests,
+		duration,
+		httprate.WithKeyFuncs(keyByCaller),
+		httprate.WithLimitHandler(limitHandler(duration, logger)),
+	)
+}
+
+func keyByCaller(r *http.Request) (string, error) {
+	if user, ok := authentication.UserFromContext(r.Context()); ok {
+		return "user:" + user.Username, nil
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip, nil
+}
+
+func limitHandler(retryAfter time.Duration, logger logr.Logger) http.HandlerFunc {
+	responseWriter := responsewriter.NewResponseWriter(&logger)
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, _ := keyByCaller(r)
+		logger.V(1).Info("rate limit exceeded", "caller", key, "path", r.URL.Path)
+		setRetryAfter(w, retryAfter)
+		responseWriter.Write(w, errors.NewAPIError("too many requests"), http.StatusTooManyRequests)
+	}
+}
+
+func concurrencyLimit(limit int, retryAfter time.Duration, logger logr.Logger) func(http.Handler) http.Handler {
+	responseWriter := responsewriter.NewResponseWriter(&logger)
+	// The semaphore is shared by all the handlers wrapped by the returned middleware.
+	sem := make(chan struct{}, limit)
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				next.ServeHTTP(w, r)
+			default:
+				key, _ := keyByCaller(r)
+				logger.V(1).Info("concurrency limit exceeded", "caller", key, "path", r.URL.Path, "limit", limit)
+				setRetryAfter(w, retryAfter)
+				responseWriter.Write(w, errors.NewAPIError("too many concurrent requests"), http.StatusTooManyRequests)
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+}
@@ -6,19 +6,24 @@ import (
 
 	chi "github.com/go-chi/chi/v5"
 	middleware "github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/httprate"
 	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authentication"
+	"github.com/mariadb-operator/agent/pkg/authorization"
 	"github.com/mariadb-operator/agent/pkg/handler"
-	"github.com/mariadb-operator/agent/pkg/kubernetesauth"
-	"k8s.io/client-go/kubernetes"
+	"github.com/mariadb-operator/agent/pkg/requestid"
 )
 
 type Options struct {
-	CompressLevel     int
-	RateLimitRequests *int
-	RateLimitDuration *time.Duration
-	KubernetesAuth    bool
-	KubernetesTrusted *kubernetesauth.Trusted
+	CompressLevel           int
+	RateLimitRequests       *int
+	RateLimitDuration       *time.Duration
+	CallerRateLimitRequests *int
+	CallerRateLimitDuration *time.Duration
+	ConcurrencyLimits       map[string]int
+	ConcurrencyRetryAfter   time.Duration
+	Authenticator           authentication.Authenticator
+	Authorizer              authorization.Authorizer
+	Health                  *handler.Health
 }
 
 type Option func(*Options)
@@ -38,18 +43,42 @@ func WithRateLimit(requests int, duration time.Duration) Option {
 	}
 }
 
-func WithKubernetesAuth(auth bool, trusted *kubernetesauth.Trusted) Option {
+func WithCallerRateLimit(requests int, duration time.Duration) Option {
 	return func(o *Options) {
-		o.KubernetesAuth = auth
-		o.KubernetesTrusted = trusted
+		if requests != 0 && duration != 0 {
+			o.CallerRateLimitRequests = &requests
+			o.CallerRateLimitDuration = &duration
+		}
+	}
+}
+
+func WithConcurrencyLimits(limits map[string]int, retryAfter time.Duration) Option {
+	return func(o *Options) {
+		o.ConcurrencyLimits = limits
+		o.ConcurrencyRetryAfter = retryAfter
+	}
+}
+
+func WithAuth(authenticator authentication.Authenticator, authorizer authorization.Authorizer) Option {
+	return func(o *Options) {
+		o.Authenticator = authenticator
+		o.Authorizer = authorizer
+	}
+}
+
+// WithHealth serves the detailed health checks in the authenticated /api/health endpoint.
+func WithHealth(health *handler.Health) Option {
+	return func(o *Options) {
+		o.Health = health
 	}
 }
 
-func NewRouter(handler *handler.Handler, clientset *kubernetes.Clientset, logger logr.Logger, opts ...Option) http.Handler {
+func NewRouter(handler *handler.Handler, logger logr.Logger, opts ...Option) http.Handler {
 	routerOpts := Options{
-		CompressLevel:     5,
-		KubernetesAuth:    false,
-		KubernetesTrusted: nil,
+		CompressLevel:         5,
+		ConcurrencyRetryAfter: 5 * time.Second,
+		Authenticator:         nil,
+		Authorizer:            nil,
 	}
 	for _, setOpt := range opts {
 		setOpt(&routerOpts)
@@ -57,36 +86,60 @@ func NewRouter(handler *handler.Handler, clientset *kubernetes.Clientset, logger
 	r := chi.NewRouter()
 	r.Use(middleware.Compress(routerOpts.CompressLevel))
 	r.Use(middleware.Recoverer)
+	r.Use(requestid.Middleware)
 
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
-	r.Mount("/api", apiRouter(handler, clientset, logger, &routerOpts))
+	r.Get("/health", health)
+	r.Mount("/api", apiRouter(handler, logger, &routerOpts))
 
 	return r
 }
 
-func apiRouter(h *handler.Handler, clientset *kubernetes.Clientset, logger logr.Logger, opts *Options) http.Handler {
+func apiRouter(h *handler.Handler, logger logr.Logger, opts *Options) http.Handler {
 	r := chi.NewRouter()
+	r.Use(accessLog(logger.WithName("access")))
 	if opts.RateLimitRequests != nil && opts.RateLimitDuration != nil {
-		r.Use(httprate.LimitAll(*opts.RateLimitRequests, *opts.RateLimitDuration))
+		r.Use(rateLimitAll(*opts.RateLimitRequests, *opts.RateLimitDuration, logger))
+	}
+	if opts.Authenticator != nil {
+		r.Use(authentication.NewMiddleware(opts.Authenticator, opts.Authorizer, logger).Handler)
+		r.Use(recordCaller)
 	}
-	r.Use(middleware.Logger)
-	if opts.KubernetesAuth && opts.KubernetesTrusted != nil {
-		kauth := kubernetesauth.NewKubernetesAuth(clientset, opts.KubernetesTrusted, logger)
-		r.Use(kauth.Handler)
+	if opts.CallerRateLimitRequests != nil && opts.CallerRateLimitDuration != nil {
+		r.Use(rateLimitByCaller(*opts.CallerRateLimitRequests, *opts.CallerRateLimitDuration, logger))
 	}
 
 	r.Route("/bootstrap", func(r chi.Router) {
-		r.Put("/", h.Bootstrap.Put)
+		r.With(concurrencyLimiter("bootstrap", logger, opts)).Put("/", h.Bootstrap.Put)
 		r.Delete("/", h.Bootstrap.Delete)
 	})
-	r.Get("/galerastate", h.GaleraState.Get)
+	r.Route("/galerastate", func(r chi.Router) {
+		r.Get("/", h.GaleraState.Get)
+		r.Get("/history", h.GaleraStateHistory.Get)
+		r.With(concurrencyLimiter("galerastate", logger, opts)).Post("/rollback/{version}", h.GaleraStateHistory.Rollback)
+	})
+	if opts.Health != nil {
+		r.Get("/health", opts.Health.Get)
+	}
 	r.Route("/recovery", func(r chi.Router) {
+		// Starting and running the recovery share the limit, as both wait until the node is recovered.
+		limit := concurrencyLimiter("recovery", logger, opts)
 		r.Put("/", h.Recovery.Put)
-		r.Post("/", h.Recovery.Post)
+		r.With(limit).Post("/", h.Recovery.Post)
+		r.With(limit).Post("/run", h.Recovery.Run)
+		r.Get("/result", h.Recovery.Result)
 		r.Delete("/", h.Recovery.Delete)
 	})
 
 	return r
 }
+
+// concurrencyLimiter limits the concurrent requests to the operations of a route that recover or mutate the galera
+// state. Reads and deletes are not limited: they wait for the handler lock instead of being rejected.
+func concurrencyLimiter(route string, logger logr.Logger, opts *Options) func(http.Handler) http.Handler {
+	if limit, ok := opts.ConcurrencyLimits[route]; ok && limit > 0 {
+		return concurrencyLimit(limit, opts.ConcurrencyRetryAfter, logger)
+	}
+	return func(next http.Handler) http.Handler {
+		return next
+	}
+}
@@ -0,0 +1,195 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+	"github.com/mariadb-operator/agent/pkg/galera"
+	"github.com/mariadb-operator/agent/pkg/handler"
+	agenthealth "github.com/mariadb-operator/agent/pkg/health"
+	"github.com/mariadb-operator/agent/pkg/responsewriter"
+)
+
+const (
+	testConfigDir = "/etc/mysql/mariadb.conf.d"
+	testStateDir  = "/var/lib/mysql"
+)
+
+// statNotifier notifies when a file is checked, to know when a handler has gone past the router middlewares.
+type statNotifier struct {
+	filesystem.FS
+	name    string
+	once    sync.Once
+	checked chan struct{}
+}
+
+func (s *statNotifier) Stat(name string) (fs.FileInfo, error) {
+	if name == s.name {
+		s.once.Do(func() { close(s.checked) })
+	}
+	return s.FS.Stat(name)
+}
+
+func newTestHandler(t *testing.T, fsys filesystem.FS) *handler.Handler {
+	fileManager, err := filemanager.NewFileManager(testConfigDir, testStateDir, filemanager.WithFS(fsys))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	logger := logr.Discard()
+	return handler.NewHandler(
+		fileManager,
+		nil,
+		&logger,
+		handler.WithRecoveryTimeout(10*time.Second),
+		handler.WithRecoveryPollInterval(10*time.Millisecond),
+	)
+}
+
+func newTestMemory(t *testing.T) *filesystem.Memory {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{testConfigDir, testStateDir} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	return memory
+}
+
+func doRequest(t *testing.T, url, method, path string) *http.Response {
+	req, err := http.NewRequestWithContext(context.Background(), method, url+path, nil)
+	if err != nil {
+		t.Errorf("error creating request: %v", err)
+		return nil
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("error doing request: %v", err)
+		return nil
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestRateLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           []Option
+		wantRetryAfter string
+	}{
+		{
+			name:           "rate limit",
+			opts:           []Option{WithRateLimit(1, time.Minute)},
+			wantRetryAfter: "60",
+		},
+		{
+			name:           "caller rate limit",
+			opts:           []Option{WithCallerRateLimit(1, 30*time.Second)},
+			wantRetryAfter: "30",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(NewRouter(newTestHandler(t, newTestMemory(t)), logr.Discard(), tt.opts...))
+			defer server.Close()
+
+			res := doRequest(t, server.URL, http.MethodGet, "/api/galerastate")
+			if res == nil || res.StatusCode == http.StatusTooManyRequests {
+				t.Fatalf("unexpected response in first request: %v", res)
+			}
+			res = doRequest(t, server.URL, http.MethodGet, "/api/galerastate")
+			if res == nil || res.StatusCode != http.StatusTooManyRequests {
+				t.Fatalf("expected status code %d, got %v", http.StatusTooManyRequests, res)
+			}
+			if retryAfter := res.Header.Get("Retry-After"); retryAfter != tt.wantRetryAfter {
+				t.Fatalf("unexpected Retry-After: expected %s, got %s", tt.wantRetryAfter, retryAfter)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	memory := newTestMemory(t)
+	if err := memory.WriteFile(filepath.Join(testConfigDir, galera.RecoveryFileName), []byte(galera.RecoveryFile), 0644); err != nil {
+		t.Fatalf("error writing recovery config: %v", err)
+	}
+	notifier := &statNotifier{
+		FS:      memory,
+		name:    filepath.Join(testConfigDir, galera.RecoveryFileName),
+		checked: make(chan struct{}),
+	}
+	router := NewRouter(
+		newTestHandler(t, notifier),
+		logr.Discard(),
+		WithConcurrencyLimits(map[string]int{"recovery": 1}, 3*time.Second),
+	)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// The recovery waits for the recovery log, holding the concurrency limit.
+	recovered := make(chan *http.Response)
+	go func() {
+		recovered <- doRequest(t, server.URL, http.MethodPost, "/api/recovery")
+	}()
+	<-notifier.checked
+
+	for _, path := range []string{"/api/recovery", "/api/recovery/run"} {
+		res := doRequest(t, server.URL, http.MethodPost, path)
+		if res == nil || res.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d in %s, got %v", http.StatusTooManyRequests, path, res)
+		}
+		if retryAfter := res.Header.Get("Retry-After"); retryAfter != "3" {
+			t.Fatalf("unexpected Retry-After in %s: expected 3, got %s", path, retryAfter)
+		}
+	}
+
+	// Disabling the recovery is not limited, it waits for the recovery to release the handler lock.
+	disabled := make(chan *http.Response)
+	go func() {
+		disabled <- doRequest(t, server.URL, http.MethodDelete, "/api/recovery")
+	}()
+	select {
+	case res := <-disabled:
+		t.Fatalf("unexpected response disabling recovery while recovering: %v", res)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	log := []byte("[Note] WSREP: Recovered position: 05f061bd-02a3-11ee-857c-aa370ff6666b:42\n")
+	if err := memory.AppendFile(filepath.Join(testStateDir, galera.RecoveryLogFileName), log, 0644); err != nil {
+		t.Fatalf("error writing recovery log: %v", err)
+	}
+	if res := <-recovered; res == nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response recovering: %v", res)
+	}
+	if res := <-disabled; res == nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response disabling recovery: %v", res)
+	}
+}
+
+func TestHealthUnavailable(t *testing.T) {
+	logger := logr.Discard()
+	healthHandler := handler.NewHealth(
+		agenthealth.NewChecker(agenthealth.WithCheck("failing", func(ctx context.Context) error {
+			return errors.New("failing")
+		})),
+		responsewriter.NewResponseWriter(&logger),
+		&logger,
+	)
+	server := httptest.NewServer(NewRouter(newTestHandler(t, newTestMemory(t)), logger, WithHealth(healthHandler)))
+	defer server.Close()
+
+	res := doRequest(t, server.URL, http.MethodGet, "/api/health")
+	if res == nil || res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected status code %d, got %v", http.StatusServiceUnavailable, res)
+	}
+}
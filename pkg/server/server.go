@@ -2,14 +2,21 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/authentication"
 )
 
 type Option func(*Server)
@@ -20,17 +27,84 @@ func WithGracefulShutdownTimeout(timeout time.Duration) Option {
 	}
 }
 
+func WithTLS(certFile, keyFile string) Option {
+	return func(s *Server) {
+		s.tlsCertFile = certFile
+		s.tlsKeyFile = keyFile
+	}
+}
+
+func WithTLSClientCA(caFile string) Option {
+	return func(s *Server) {
+		s.tlsClientCAFile = caFile
+	}
+}
+
+// WithUnixSocket serves handler on a unix domain socket created with the given file mode.
+// Requests received through it can be authenticated with authentication.UnixSocketAuthenticator.
+func WithUnixSocket(path string, mode fs.FileMode, handler http.Handler) Option {
+	return func(s *Server) {
+		if path == "" {
+			return
+		}
+		s.listeners = append(s.listeners, &listener{
+			name:    "unix",
+			network: "unix",
+			mode:    mode,
+			httpServer: &http.Server{
+				Addr:        path,
+				Handler:     handler,
+				ConnContext: authentication.UnixSocketConnContext,
+			},
+		})
+	}
+}
+
+// WithProbesListener serves handler on a separate address without TLS, so the kubelet probes can reach it
+// without being exposed to the API.
+func WithProbesListener(addr string, handler http.Handler) Option {
+	return func(s *Server) {
+		s.addTCPListener("probes", addr, handler, false)
+	}
+}
+
+// WithAdminListener serves handler on a separate address, using TLS when it is enabled for the API.
+func WithAdminListener(addr string, handler http.Handler) Option {
+	return func(s *Server) {
+		s.addTCPListener("admin", addr, handler, true)
+	}
+}
+
+type listener struct {
+	name       string
+	network    string
+	mode       fs.FileMode
+	tls        bool
+	allowTLS   bool
+	httpServer *http.Server
+}
+
 type Server struct {
-	httpServer              *http.Server
+	listeners               []*listener
 	logger                  *logr.Logger
 	gracefulShutdownTimeout time.Duration
+	tlsCertFile             string
+	tlsKeyFile              string
+	tlsClientCAFile         string
 }
 
 func NewServer(addr string, handler http.Handler, logger *logr.Logger, opts ...Option) *Server {
 	srv := &Server{
-		httpServer: &http.Server{
-			Addr:    addr,
-			Handler: handler,
+		listeners: []*listener{
+			{
+				name:     "api",
+				network:  "tcp",
+				allowTLS: true,
+				httpServer: &http.Server{
+					Addr:    addr,
+					Handler: handler,
+				},
+			},
 		},
 		logger:                  logger,
 		gracefulShutdownTimeout: 30 * time.Second,
@@ -42,8 +116,24 @@ func NewServer(addr string, handler http.Handler, logger *logr.Logger, opts ...O
 }
 
 func (s *Server) Start(ctx context.Context) error {
+	if err := s.configureTLS(); err != nil {
+		return fmt.Errorf("error configuring TLS: %v", err)
+	}
 	serverContext, stopServer := context.WithCancel(ctx)
-	errChan := make(chan error)
+	errChan := make(chan error, len(s.listeners)+1)
+
+	netListeners := make([]net.Listener, len(s.listeners))
+	for i, l := range s.listeners {
+		netListener, err := l.listen()
+		if err != nil {
+			for _, nl := range netListeners[:i] {
+				nl.Close()
+			}
+			stopServer()
+			return fmt.Errorf("error listening on %s listener: %v", l.name, err)
+		}
+		netListeners[i] = netListener
+	}
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -60,17 +150,27 @@ func (s *Server) Start(ctx context.Context) error {
 		}()
 
 		s.logger.Info("shutting down server")
-		if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
-			errChan <- fmt.Errorf("error shutting down server: %v", err)
+		var wg sync.WaitGroup
+		for _, l := range s.listeners {
+			wg.Add(1)
+			go func(l *listener) {
+				defer wg.Done()
+				if err := l.httpServer.Shutdown(shutdownCtx); err != nil {
+					errChan <- fmt.Errorf("error shutting down %s listener: %v", l.name, err)
+				}
+			}(l)
 		}
+		wg.Wait()
 	}()
 
-	go func() {
-		s.logger.Info("server listening", "addr", s.httpServer.Addr)
-		if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
-			errChan <- fmt.Errorf("error starting server: %v", err)
-		}
-	}()
+	for i, l := range s.listeners {
+		go func(l *listener, netListener net.Listener) {
+			s.logger.Info("server listening", "listener", l.name, "addr", l.httpServer.Addr, "tls", l.tls)
+			if err := l.serve(netListener, s.tlsCertFile, s.tlsKeyFile); err != http.ErrServerClosed {
+				errChan <- fmt.Errorf("error starting %s listener: %v", l.name, err)
+			}
+		}(l, netListeners[i])
+	}
 
 	select {
 	case <-serverContext.Done():
@@ -79,3 +179,96 @@ func (s *Server) Start(ctx context.Context) error {
 		return err
 	}
 }
+
+func (s *Server) tlsEnabled() bool {
+	return s.tlsCertFile != "" && s.tlsKeyFile != ""
+}
+
+func (s *Server) configureTLS() error {
+	if !s.tlsEnabled() {
+		if s.tlsClientCAFile != "" {
+			return errors.New("TLS certificate and key must be provided to verify client certificates")
+		}
+		return nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if s.tlsClientCAFile != "" {
+		bytes, err := os.ReadFile(s.tlsClientCAFile)
+		if err != nil {
+			return fmt.Errorf("error reading client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bytes) {
+			return errors.New("no certificates found in client CA")
+		}
+		tlsConfig.ClientCAs = pool
+		// Client certificates are optional at the TLS level so unauthenticated endpoints like /health keep working,
+		// the authenticator rejects requests without a verified certificate.
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	for _, l := range s.listeners {
+		if l.allowTLS {
+			l.tls = true
+			l.httpServer.TLSConfig = tlsConfig
+		}
+	}
+	return nil
+}
+
+func (s *Server) addTCPListener(name, addr string, handler http.Handler, allowTLS bool) {
+	if addr == "" {
+		return
+	}
+	s.listeners = append(s.listeners, &listener{
+		name:     name,
+		network:  "tcp",
+		allowTLS: allowTLS,
+		httpServer: &http.Server{
+			Addr:    addr,
+			Handler: handler,
+		},
+	})
+}
+
+func (l *listener) listen() (net.Listener, error) {
+	if l.network != "unix" {
+		addr := l.httpServer.Addr
+		if addr == "" {
+			addr = ":http"
+		}
+		return net.Listen(l.network, addr)
+	}
+	if info, err := os.Lstat(l.httpServer.Addr); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("'%s' already exists and it is not a socket", l.httpServer.Addr)
+		}
+		if err := os.Remove(l.httpServer.Addr); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %v", err)
+		}
+	}
+	// The socket is created with the umask restricting it to the configured mode, otherwise it would be reachable
+	// with the default permissions until it is chmoded.
+	var netListener net.Listener
+	err := withUmask(l.mode, func() error {
+		var err error
+		netListener, err = net.Listen(l.network, l.httpServer.Addr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(l.httpServer.Addr, l.mode); err != nil {
+		netListener.Close()
+		return nil, fmt.Errorf("error setting socket permissions: %v", err)
+	}
+	return netListener, nil
+}
+
+func (l *listener) serve(netListener net.Listener, certFile, keyFile string) error {
+	if l.tls {
+		return l.httpServer.ServeTLS(netListener, certFile, keyFile)
+	}
+	return l.httpServer.Serve(netListener)
+}
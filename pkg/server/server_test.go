@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/mariadb-operator/agent/pkg/client"
+	"github.com/mariadb-operator/agent/pkg/filemanager"
+	"github.com/mariadb-operator/agent/pkg/filesystem"
+	"github.com/mariadb-operator/agent/pkg/handler"
+	"github.com/mariadb-operator/agent/pkg/router"
+)
+
+func TestUnixSocketMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	l := &listener{
+		name:       "unix",
+		network:    "unix",
+		mode:       0600,
+		httpServer: &http.Server{Addr: path},
+	}
+	netListener, err := l.listen()
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer netListener.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("error getting socket info: %v", err)
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		t.Fatalf("expected a socket, got mode %v", info.Mode())
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("unexpected socket permissions: expected %v, got %v", fs.FileMode(0600), perm)
+	}
+}
+
+func TestServerRetryAfter(t *testing.T) {
+	memory := filesystem.NewMemory()
+	for _, dir := range []string{"/config", "/state"} {
+		if err := memory.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+	}
+	fileManager, err := filemanager.NewFileManager("/config", "/state", filemanager.WithFS(memory))
+	if err != nil {
+		t.Fatalf("error creating file manager: %v", err)
+	}
+	logger := logr.Discard()
+	apiRouter := router.NewRouter(
+		handler.NewHandler(fileManager, nil, &logger),
+		logger,
+		router.WithRateLimit(1, time.Second),
+	)
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	server := NewServer("127.0.0.1:0", apiRouter, &logger, WithUnixSocket(socket, 0600, apiRouter))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start(ctx)
+	}()
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		select {
+		case err := <-errChan:
+			t.Fatalf("error starting server: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	c, err := client.NewClient("http://localhost", client.WithUnixSocket(socket), client.WithRetryAfter(3, 5*time.Second))
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	if _, err := c.GaleraState.Get(ctx); !client.IsNotFound(err) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	// The rate limit is exceeded, the client waits for the Retry-After returned with the 429 and retries.
+	start := time.Now()
+	if _, err := c.GaleraState.Get(ctx); !client.IsNotFound(err) {
+		t.Fatalf("expected not found error after retrying, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected the request to be retried after the Retry-After, took %v", elapsed)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package server
+
+import "io/fs"
+
+func withUmask(mode fs.FileMode, fn func() error) error {
+	return fn()
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package server
+
+import (
+	"io/fs"
+	"sync"
+	"syscall"
+)
+
+// umaskMux serializes the umask changes, as the umask is shared by the whole process.
+var umaskMux sync.Mutex
+
+// withUmask runs fn with a umask that creates files with the given mode at most.
+func withUmask(mode fs.FileMode, fn func() error) error {
+	umaskMux.Lock()
+	defer umaskMux.Unlock()
+	old := syscall.Umask(int(^mode & fs.ModePerm))
+	defer syscall.Umask(old)
+	return fn()
+}